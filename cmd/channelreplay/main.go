@@ -0,0 +1,49 @@
+// channelreplay feeds a channel capture written by a worker Channel (see
+// mediasoup.captureDir) back through Channel.processMessage, so response
+// matching and notification dispatch can be reproduced offline.
+//
+// To replay a capture against the controller instead, start it with the fake
+// worker and FAKEWORKER_REPLAY pointing at the capture.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"mediasoup-signal-controller/service"
+	"os"
+)
+
+func main() {
+	realtime := flag.Bool("realtime", false, "keep the original pacing between messages")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: %s [-realtime] capture.jsonl\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	records, err := service.ReadChannelCapture(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+		os.Exit(1)
+	}
+
+	// The channel is never started, processMessage is driven by the capture.
+	channel := service.CreateNewChannel("", "")
+	report := channel.Replay(records, *realtime)
+
+	fmt.Printf("requests:%d accepted:%d rejected:%d notifications:%d\n",
+		report.Requests, report.Accepted, report.Rejected, report.Notifications)
+
+	for _, pending := range report.Pending {
+		fmt.Printf("no response for %s\n", pending)
+	}
+
+	if len(report.Pending) > 0 {
+		os.Exit(1)
+	}
+}
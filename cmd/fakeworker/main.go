@@ -0,0 +1,139 @@
+// fakeworker stands in for the mediasoup-worker C++ binary so the controller
+// can be run without it. Point mediasoup.workerPath at the built binary: it
+// takes the same command line, connects to the controller's unix sockets,
+// emits "running" and answers channel requests with realistic data.
+//
+// Notifications such as "score" and "layerschange" are injected after the
+// requests that create their targets. The default script can be replaced by
+// pointing FAKEWORKER_SCRIPT at a JSON file, see script.go. With
+// FAKEWORKER_REPLAY pointing at a channel capture, the captured responses and
+// notifications are replayed instead, see replay.go.
+//
+// SIGTERM and SIGINT make it exit cleanly like mediasoup-worker, unless
+// FAKEWORKER_IGNORE_SIGTERM is set to test the controller's kill timeout.
+// Requests for the comma separated methods in FAKEWORKER_STALL are never
+// answered, as if the worker were stuck, those in FAKEWORKER_REJECT are
+// rejected.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"mediasoup-signal-controller/service"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+var (
+	logLevel               = flag.String("logLevel", "error", "log level")
+	rtcMinPort             = flag.Int("rtcMinPort", 10000, "minimum RTC port")
+	rtcMaxPort             = flag.Int("rtcMaxPort", 59999, "maximum RTC port")
+	dtlsCertificateFile    = flag.String("dtlsCertificateFile", "", "DTLS certificate file")
+	dtlsPrivateKeyFile     = flag.String("dtlsPrivateKeyFile", "", "DTLS private key file")
+	seq                    = flag.Int("seq", 0, "worker sequence number")
+	channelProducer        = flag.String("channelProducer", "", "unix socket the worker writes channel messages to")
+	channelConsumer        = flag.String("channelConsumer", "", "unix socket the worker reads channel requests from")
+	channelPayloadProducer = flag.String("channelPayloadProducer", "", "unix socket the worker writes payload messages to")
+	channelPayloadConsumer = flag.String("channelPayloadConsumer", "", "unix socket the worker reads payload messages from")
+)
+
+func dial(path string) *net.UnixConn {
+	addr, err := net.ResolveUnixAddr("unix", path)
+	if err != nil {
+		log.Fatalf("cannot resolve %s: %s", path, err.Error())
+	}
+
+	conn, err := net.DialUnix("unix", nil, addr)
+	if err != nil {
+		log.Fatalf("cannot connect %s: %s", path, err.Error())
+	}
+
+	return conn
+}
+
+func main() {
+	flag.Parse()
+
+	// Log like mediasoup-worker does so the controller can parse our output.
+	log.SetFlags(0)
+	log.SetOutput(os.Stdout)
+	log.SetPrefix("FakeWorker::main() | ")
+
+	if len(*channelProducer) == 0 || len(*channelConsumer) == 0 {
+		log.Fatalf("--channelProducer and --channelConsumer are required")
+	}
+
+	versionStr := os.Getenv("MEDIASOUP_VERSION")
+	if len(versionStr) == 0 {
+		log.Fatalf("you don't seem to be my real father! (MEDIASOUP_VERSION is not set)")
+	}
+
+	version, err := service.ParseWorkerVersion(versionStr)
+	if err != nil {
+		log.Fatalf("%s", err.Error())
+	}
+
+	script := defaultScript()
+	if path := os.Getenv("FAKEWORKER_SCRIPT"); len(path) > 0 {
+		script, err = loadScript(path)
+		if err != nil {
+			log.Fatalf("cannot load script %s: %s", path, err.Error())
+		}
+	}
+
+	worker := newFakeWorker(version, script)
+
+	worker.stalled = make(map[string]bool)
+	for _, method := range strings.Split(os.Getenv("FAKEWORKER_STALL"), ",") {
+		if len(method) > 0 {
+			worker.stalled[method] = true
+		}
+	}
+
+	worker.rejected = make(map[string]bool)
+	for _, method := range strings.Split(os.Getenv("FAKEWORKER_REJECT"), ",") {
+		if len(method) > 0 {
+			worker.rejected[method] = true
+		}
+	}
+
+	if path := os.Getenv("FAKEWORKER_REPLAY"); len(path) > 0 {
+		worker.replayer, err = loadReplay(path)
+		if err != nil {
+			log.Fatalf("cannot load capture %s: %s", path, err.Error())
+		}
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		for sig := range signals {
+			if len(os.Getenv("FAKEWORKER_IGNORE_SIGTERM")) > 0 {
+				log.Printf("%s received, ignoring it", sig)
+				continue
+			}
+			log.Printf("%s received, exiting", sig)
+			os.Exit(0)
+		}
+	}()
+
+	worker.producer = dial(*channelProducer)
+	consumer := dial(*channelConsumer)
+
+	// The payload channel is unused but the controller expects a connection.
+	if len(*channelPayloadProducer) > 0 && len(*channelPayloadConsumer) > 0 {
+		defer dial(*channelPayloadProducer).Close()
+		defer dial(*channelPayloadConsumer).Close()
+	}
+
+	log.Printf("running [version:%s, logLevel:%s, ports:%d-%d, cert:%s, key:%s]",
+		version, *logLevel, *rtcMinPort, *rtcMaxPort, *dtlsCertificateFile, *dtlsPrivateKeyFile)
+
+	worker.notify(fmt.Sprintf("%d", os.Getpid()), "running", nil)
+
+	worker.readLoop(consumer)
+}
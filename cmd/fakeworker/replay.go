@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log"
+	"mediasoup-signal-controller/service"
+)
+
+// replayer answers requests with the responses and notifications of a
+// channel capture (FAKEWORKER_REPLAY) instead of synthesizing them. Requests
+// are matched by method in capture order, and the ids the controller
+// generated in the capture (router, transport, producer...) are rewritten to
+// the ones it generates now.
+type replayer struct {
+	records []service.ChannelRecord
+	used    []bool
+	ids     map[string]string
+}
+
+func loadReplay(path string) (*replayer, error) {
+	records, err := service.ReadChannelCapture(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &replayer{
+		records: records,
+		used:    make([]bool, len(records)),
+		ids:     make(map[string]string),
+	}, nil
+}
+
+type recordedRequest struct {
+	Id       int               `json:"id"`
+	Method   string            `json:"method"`
+	Internal map[string]string `json:"internal"`
+}
+
+func (rp *replayer) rewrite(message []byte) []byte {
+	for recorded, live := range rp.ids {
+		message = bytes.ReplaceAll(message, []byte(`"`+recorded+`"`), []byte(`"`+live+`"`))
+	}
+	return message
+}
+
+// answer replays the captured outcome of req, it returns false when the
+// capture has nothing left for this method.
+func (rp *replayer) answer(worker *fakeWorker, req *request) bool {
+
+	var live map[string]string
+	_ = json.Unmarshal(req.Internal, &live)
+
+	for i, record := range rp.records {
+		if rp.used[i] || record.Direction != service.RecordRequest {
+			continue
+		}
+
+		var recorded recordedRequest
+		if json.Unmarshal(record.Message, &recorded) != nil || recorded.Method != req.Method {
+			continue
+		}
+		rp.used[i] = true
+
+		for key, id := range recorded.Internal {
+			if liveId, ok := live[key]; ok && len(id) > 0 {
+				rp.ids[id] = liveId
+			}
+		}
+
+		// The response, then every notification up to the next request.
+		responded := false
+		for j := i + 1; j < len(rp.records); j++ {
+			next := rp.records[j]
+			if rp.used[j] {
+				continue
+			}
+
+			if next.Direction == service.RecordResponse {
+				var response struct {
+					Id int `json:"id"`
+				}
+				_ = json.Unmarshal(next.Message, &response)
+				if response.Id != recorded.Id {
+					continue
+				}
+
+				var msg map[string]json.RawMessage
+				_ = json.Unmarshal(rp.rewrite(next.Message), &msg)
+				msg["id"], _ = json.Marshal(req.Id)
+				worker.write(msg)
+
+				rp.used[j] = true
+				responded = true
+			} else if next.Direction == service.RecordNotification && responded {
+				worker.write(json.RawMessage(rp.rewrite(next.Message)))
+				rp.used[j] = true
+			} else if next.Direction == service.RecordRequest && responded {
+				break
+			}
+		}
+
+		if !responded {
+			log.Printf("capture has no response for %s [id:%d]", recorded.Method, recorded.Id)
+			worker.reject(req.Id, "Error", "no response in capture")
+		}
+		return true
+	}
+
+	return false
+}
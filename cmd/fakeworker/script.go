@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+/*
+A script is a JSON array of notifications, each one fired after a request with
+the given method succeeded:
+
+	[
+		{ "after": "transport.produce", "event": "score", "delayMs": 1000 },
+		{ "after": "transport.consume", "kind": "video", "event": "layerschange",
+		  "delayMs": 2000, "intervalMs": 5000, "count": 3,
+		  "data": { "spatialLayer": 1, "temporalLayer": 2 } }
+	]
+
+The notification targets the entity created by the request (the router,
+transport, producer or consumer id in its internal) unless targetId is given.
+Without data, a realistic payload for the event is generated.
+*/
+type ScriptEntry struct {
+	After      string          `json:"after"`
+	Kind       string          `json:"kind"`
+	TargetId   string          `json:"targetId"`
+	Event      string          `json:"event"`
+	Data       json.RawMessage `json:"data"`
+	DelayMs    int             `json:"delayMs"`
+	IntervalMs int             `json:"intervalMs"`
+	Count      int             `json:"count"`
+}
+
+func defaultScript() []ScriptEntry {
+	return []ScriptEntry{
+		{After: "transport.produce", Event: "score", DelayMs: 1000},
+		{After: "transport.consume", Event: "score", DelayMs: 1000},
+		{After: "transport.consume", Kind: "video", Event: "layerschange", DelayMs: 1500},
+	}
+}
+
+func loadScript(path string) ([]ScriptEntry, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var script []ScriptEntry
+	err = json.Unmarshal(data, &script)
+	return script, err
+}
+
+func (worker *fakeWorker) runScript(method string, in *internal, result interface{}) {
+
+	var targetId, kind string
+	switch method {
+	case "worker.createRouter":
+		targetId = in.RouterId
+	case "router.createWebRtcTransport":
+		targetId = in.TransportId
+	case "transport.produce":
+		targetId = in.ProducerId
+		kind = worker.producers[targetId].kind
+	case "transport.consume":
+		targetId = in.ConsumerId
+		kind = worker.consumers[targetId].kind
+	case "transport.produceData":
+		targetId = in.DataProducerId
+	}
+
+	for _, entry := range worker.script {
+		if entry.After != method || (len(entry.Kind) > 0 && entry.Kind != kind) {
+			continue
+		}
+
+		target := targetId
+		if len(entry.TargetId) > 0 {
+			target = entry.TargetId
+		}
+
+		var data interface{}
+		if len(entry.Data) > 0 {
+			data = entry.Data
+		} else {
+			data = worker.eventData(method, target, entry.Event)
+		}
+
+		go func(entry ScriptEntry, target string, data interface{}) {
+			time.Sleep(time.Duration(entry.DelayMs) * time.Millisecond)
+
+			count := entry.Count
+			if count <= 0 {
+				count = 1
+			}
+
+			for i := 0; i < count; i++ {
+				if i > 0 {
+					time.Sleep(time.Duration(entry.IntervalMs) * time.Millisecond)
+				}
+				worker.notify(target, entry.Event, data)
+			}
+		}(entry, target, data)
+	}
+}
+
+func (worker *fakeWorker) eventData(method string, targetId string, event string) interface{} {
+	switch event {
+	case "score":
+		if producer, ok := worker.producers[targetId]; ok && method == "transport.produce" {
+			scores := make([]map[string]interface{}, 0)
+			for i, ssrc := range producer.ssrcs {
+				scores = append(scores, map[string]interface{}{
+					"encodingIdx": i,
+					"ssrc":        ssrc,
+					"score":       10,
+				})
+			}
+			return scores
+		}
+		if consumer, ok := worker.consumers[targetId]; ok {
+			return consumerScore(len(worker.producers[consumer.producerId].ssrcs))
+		}
+	case "layerschange":
+		if consumer, ok := worker.consumers[targetId]; ok {
+			return map[string]int{
+				"spatialLayer":  len(worker.producers[consumer.producerId].ssrcs) - 1,
+				"temporalLayer": 2,
+			}
+		}
+	}
+
+	return nil
+}
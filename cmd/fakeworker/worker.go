@@ -0,0 +1,769 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"mediasoup-signal-controller/common"
+	"mediasoup-signal-controller/service"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type request struct {
+	Id       int             `json:"id"`
+	Method   string          `json:"method"`
+	Internal json.RawMessage `json:"internal"`
+	Data     json.RawMessage `json:"data"`
+}
+
+type internal struct {
+	RouterId       string `json:"routerId"`
+	TransportId    string `json:"transportId"`
+	ProducerId     string `json:"producerId"`
+	ConsumerId     string `json:"consumerId"`
+	DataProducerId string `json:"dataProducerId"`
+	RtpObserverId  string `json:"rtpObserverId"`
+}
+
+type fakeTransport struct {
+	routerId    string
+	producerIds []string
+	consumerIds []string
+	plain       *fakePlainTransport
+}
+
+type fakePlainTransport struct {
+	rtcpMux   bool
+	tuple     map[string]interface{}
+	rtcpTuple map[string]interface{}
+}
+
+type fakeProducer struct {
+	kind      string
+	encodings []json.RawMessage
+	ssrcs     []int
+}
+
+type fakeConsumer struct {
+	kind       string
+	producerId string
+	ssrc       int
+}
+
+type fakeWorker struct {
+	version        service.WorkerVersion
+	lengthPrefixed bool
+	script         []ScriptEntry
+	replayer       *replayer
+	stalled        map[string]bool
+	rejected       map[string]bool
+
+	mutex    sync.Mutex
+	producer *net.UnixConn
+
+	routers    map[string][]string
+	transports map[string]*fakeTransport
+	producers  map[string]*fakeProducer
+	consumers  map[string]*fakeConsumer
+	startedAt  time.Time
+}
+
+func newFakeWorker(version service.WorkerVersion, script []ScriptEntry) *fakeWorker {
+	return &fakeWorker{
+		version:        version,
+		lengthPrefixed: version.Supports(service.FeatureLengthPrefixedChannel),
+		script:         script,
+		routers:        make(map[string][]string),
+		transports:     make(map[string]*fakeTransport),
+		producers:      make(map[string]*fakeProducer),
+		consumers:      make(map[string]*fakeConsumer),
+		startedAt:      time.Now(),
+	}
+}
+
+func (worker *fakeWorker) readLoop(conn *net.UnixConn) {
+	buffer := make([]byte, 0)
+	buf := make([]byte, 65536)
+
+	for {
+		nlen, err := conn.Read(buf)
+		if err != nil {
+			if err != io.EOF {
+				log.Printf("channel read failed: %s", err.Error())
+			}
+			log.Printf("channel closed, exiting")
+			os.Exit(0)
+		}
+
+		buffer = append(buffer, buf[:nlen]...)
+
+		pos := 0
+		for pos < len(buffer) {
+			var payload []byte
+			var plen, mlen int
+
+			if worker.lengthPrefixed {
+				payload, plen = common.LpPayload(buffer, pos)
+				mlen = common.LpHeaderLength + plen
+			} else {
+				payload, plen = common.NsPayload(buffer, pos)
+				mlen = common.NsWriteLength(plen)
+			}
+
+			if payload == nil {
+				break
+			}
+			pos += mlen
+
+			var req request
+			if err := json.Unmarshal(payload, &req); err != nil {
+				log.Printf("invalid request: %s", err.Error())
+				continue
+			}
+			worker.handleRequest(&req)
+		}
+
+		buffer = buffer[pos:]
+	}
+}
+
+func (worker *fakeWorker) write(msg interface{}) {
+	data, _ := json.Marshal(msg)
+
+	var frame []byte
+	if worker.lengthPrefixed {
+		frame = common.LpWrite(data)
+	} else {
+		frame, _ = common.NsWrite(data, 0, len(data)-1)
+	}
+
+	worker.mutex.Lock()
+	defer worker.mutex.Unlock()
+
+	if _, err := worker.producer.Write(frame); err != nil {
+		log.Printf("channel write failed: %s", err.Error())
+	}
+}
+
+func (worker *fakeWorker) accept(id int, data interface{}) {
+	worker.write(struct {
+		Id       int         `json:"id"`
+		Accepted bool        `json:"accepted"`
+		Data     interface{} `json:"data,omitempty"`
+	}{id, true, data})
+}
+
+func (worker *fakeWorker) reject(id int, errorName string, reason string) {
+	worker.write(struct {
+		Id     int    `json:"id"`
+		Error  string `json:"error"`
+		Reason string `json:"reason"`
+	}{id, errorName, reason})
+}
+
+func (worker *fakeWorker) notify(targetId string, event string, data interface{}) {
+	worker.write(struct {
+		TargetId string      `json:"targetId"`
+		Event    string      `json:"event"`
+		Data     interface{} `json:"data,omitempty"`
+	}{targetId, event, data})
+}
+
+func (worker *fakeWorker) handleRequest(req *request) {
+	if worker.stalled[req.Method] {
+		log.Printf("stalling %s [id:%d]", req.Method, req.Id)
+		return
+	}
+	if worker.rejected[req.Method] {
+		worker.reject(req.Id, "Error", "rejected by FAKEWORKER_REJECT")
+		return
+	}
+
+	if worker.replayer != nil && worker.replayer.answer(worker, req) {
+		return
+	}
+
+	var in internal
+	_ = json.Unmarshal(req.Internal, &in)
+
+	data, err := worker.dispatch(req.Method, &in, req.Data)
+	if err != nil {
+		worker.reject(req.Id, "Error", err.Error())
+		return
+	}
+
+	worker.accept(req.Id, data)
+
+	// Notifications always follow the response that created their target.
+	worker.runScript(req.Method, &in, data)
+}
+
+func (worker *fakeWorker) dispatch(method string, in *internal, reqData json.RawMessage) (interface{}, error) {
+
+	switch method {
+	case "worker.createRouter":
+		worker.routers[in.RouterId] = make([]string, 0)
+		return nil, nil
+
+	case "worker.dump":
+		routerIds := make([]string, 0)
+		for id := range worker.routers {
+			routerIds = append(routerIds, id)
+		}
+		return map[string]interface{}{
+			"pid":       os.Getpid(),
+			"routerIds": routerIds,
+			"channelMessageHandlers": map[string]interface{}{
+				"channelRequestHandlers":             routerIds,
+				"payloadChannelRequestHandlers":      []string{},
+				"payloadChannelNotificationHandlers": []string{},
+			},
+		}, nil
+
+	case "worker.getResourceUsage":
+		elapsed := time.Since(worker.startedAt)
+		return map[string]interface{}{
+			"ru_utime":    float64(elapsed.Milliseconds()) / 50,
+			"ru_stime":    float64(elapsed.Milliseconds()) / 200,
+			"ru_maxrss":   48000 + 1000*len(worker.transports),
+			"ru_ixrss":    0,
+			"ru_idrss":    0,
+			"ru_isrss":    0,
+			"ru_minflt":   4000,
+			"ru_majflt":   0,
+			"ru_nswap":    0,
+			"ru_inblock":  0,
+			"ru_oublock":  0,
+			"ru_msgsnd":   0,
+			"ru_msgrcv":   0,
+			"ru_nsignals": 0,
+			"ru_nvcsw":    1200,
+			"ru_nivcsw":   30,
+		}, nil
+
+	case "worker.updateSettings":
+		return nil, nil
+
+	case "router.close":
+		delete(worker.routers, in.RouterId)
+		return nil, nil
+
+	case "router.dump":
+		transportIds, ok := worker.routers[in.RouterId]
+		if !ok {
+			return nil, fmt.Errorf("Router not found")
+		}
+		return map[string]interface{}{
+			"id":             in.RouterId,
+			"transportIds":   transportIds,
+			"rtpObserverIds": []string{},
+		}, nil
+
+	case "router.createWebRtcTransport":
+		return worker.createWebRtcTransport(in, reqData)
+
+	case "router.createPlainTransport":
+		return worker.createPlainTransport(in, reqData)
+
+	case "router.createActiveSpeakerObserver", "router.createAudioLevelObserver",
+		"rtpObserver.addProducer", "rtpObserver.removeProducer", "rtpObserver.close":
+		return nil, nil
+
+	case "transport.connect":
+		if transport := worker.transports[in.TransportId]; transport != nil && transport.plain != nil {
+			return worker.connectPlainTransport(transport.plain, reqData)
+		}
+
+		var params struct {
+			DtlsParameters struct {
+				Role string `json:"role"`
+			} `json:"dtlsParameters"`
+		}
+		_ = json.Unmarshal(reqData, &params)
+
+		role := "client"
+		if params.DtlsParameters.Role == "client" {
+			role = "server"
+		}
+		return map[string]string{"dtlsLocalRole": role}, nil
+
+	case "transport.restartIce":
+		return map[string]interface{}{
+			"iceParameters": iceParameters(),
+		}, nil
+
+	case "transport.close":
+		worker.closeTransport(in.TransportId)
+		return nil, nil
+
+	case "transport.dump":
+		transport := worker.transports[in.TransportId]
+		if transport == nil {
+			return nil, fmt.Errorf("Transport not found")
+		}
+		return map[string]interface{}{
+			"id":          in.TransportId,
+			"producerIds": transport.producerIds,
+			"consumerIds": transport.consumerIds,
+		}, nil
+
+	case "transport.getStats":
+		if worker.transports[in.TransportId] == nil {
+			return nil, fmt.Errorf("Transport not found")
+		}
+		return transportStats(in.TransportId), nil
+
+	case "transport.produce":
+		return worker.produce(in, reqData)
+
+	case "transport.consume":
+		return worker.consume(in, reqData)
+
+	case "transport.produceData":
+		var params map[string]interface{}
+		_ = json.Unmarshal(reqData, &params)
+		params["id"] = in.DataProducerId
+		return params, nil
+
+	case "producer.getStats":
+		producer := worker.producers[in.ProducerId]
+		if producer == nil {
+			return nil, fmt.Errorf("Producer not found")
+		}
+		stats := make([]interface{}, 0)
+		for _, ssrc := range producer.ssrcs {
+			stats = append(stats, rtpStreamStats("inbound-rtp", producer.kind, ssrc))
+		}
+		return stats, nil
+
+	case "consumer.getStats":
+		consumer := worker.consumers[in.ConsumerId]
+		if consumer == nil {
+			return nil, fmt.Errorf("Consumer not found")
+		}
+		return []interface{}{rtpStreamStats("outbound-rtp", consumer.kind, consumer.ssrc)}, nil
+
+	case "producer.close":
+		delete(worker.producers, in.ProducerId)
+		return nil, nil
+
+	case "consumer.close":
+		delete(worker.consumers, in.ConsumerId)
+		return nil, nil
+
+	case "producer.pause", "producer.resume", "consumer.pause", "consumer.resume",
+		"consumer.requestKeyFrame", "consumer.setPriority", "dataProducer.close":
+		return nil, nil
+
+	case "consumer.setPreferredLayers":
+		var layers map[string]interface{}
+		_ = json.Unmarshal(reqData, &layers)
+		return layers, nil
+	}
+
+	return nil, fmt.Errorf("unknown method '%s'", method)
+}
+
+func iceParameters() map[string]interface{} {
+	return map[string]interface{}{
+		"iceLite":          true,
+		"usernameFragment": randomString(16),
+		"password":         randomString(32),
+	}
+}
+
+func (worker *fakeWorker) createWebRtcTransport(in *internal, reqData json.RawMessage) (interface{}, error) {
+	var params struct {
+		ListenIps []struct {
+			Ip          string `json:"ip"`
+			AnnouncedIp string `json:"announcedIp"`
+		} `json:"listenIps"`
+		EnableUdp          bool `json:"enableUdp"`
+		EnableTcp          bool `json:"enableTcp"`
+		EnableSctp         bool `json:"enableSctp"`
+		NumSctpStreams     common.NumStreams_t
+		MaxSctpMessageSize int `json:"maxSctpMessageSize"`
+		SctpSendBufferSize int `json:"sctpSendBufferSize"`
+	}
+	_ = json.Unmarshal(reqData, &params)
+
+	if _, ok := worker.routers[in.RouterId]; !ok {
+		return nil, fmt.Errorf("Router not found")
+	}
+
+	candidates := make([]map[string]interface{}, 0)
+	for _, listenIp := range params.ListenIps {
+		ip := listenIp.Ip
+		if len(listenIp.AnnouncedIp) > 0 {
+			ip = listenIp.AnnouncedIp
+		}
+
+		protocols := make([]string, 0)
+		if params.EnableUdp {
+			protocols = append(protocols, "udp")
+		}
+		if params.EnableTcp {
+			protocols = append(protocols, "tcp")
+		}
+
+		for _, protocol := range protocols {
+			candidate := map[string]interface{}{
+				"foundation": fmt.Sprintf("%scandidate", protocol),
+				"ip":         ip,
+				"port":       *rtcMinPort + rand.Intn(*rtcMaxPort-*rtcMinPort+1),
+				"priority":   1076302079,
+				"protocol":   protocol,
+				"type":       "host",
+			}
+			if protocol == "tcp" {
+				candidate["tcpType"] = "passive"
+			}
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	data := map[string]interface{}{
+		"id":            in.TransportId,
+		"direct":        false,
+		"iceRole":       "controlled",
+		"iceParameters": iceParameters(),
+		"iceCandidates": candidates,
+		"iceState":      "new",
+		"dtlsParameters": map[string]interface{}{
+			"role": "auto",
+			"fingerprints": []map[string]string{
+				{"algorithm": "sha-256", "value": randomFingerprint(32)},
+				{"algorithm": "sha-512", "value": randomFingerprint(64)},
+			},
+		},
+		"dtlsState":       "new",
+		"producerIds":     []string{},
+		"consumerIds":     []string{},
+		"dataProducerIds": []string{},
+		"dataConsumerIds": []string{},
+		"sctpState":       "closed",
+	}
+
+	if params.EnableSctp {
+		data["sctpParameters"] = map[string]interface{}{
+			"MIS":                params.NumSctpStreams.MIS,
+			"OS":                 params.NumSctpStreams.OS,
+			"isDataChannel":      true,
+			"maxMessageSize":     params.MaxSctpMessageSize,
+			"port":               5000,
+			"sctpBufferedAmount": 0,
+			"sendBufferSize":     params.SctpSendBufferSize,
+		}
+		data["sctpState"] = "new"
+	}
+
+	worker.transports[in.TransportId] = &fakeTransport{
+		routerId:    in.RouterId,
+		producerIds: make([]string, 0),
+		consumerIds: make([]string, 0),
+	}
+	worker.routers[in.RouterId] = append(worker.routers[in.RouterId], in.TransportId)
+
+	return data, nil
+}
+
+func (worker *fakeWorker) createPlainTransport(in *internal, reqData json.RawMessage) (interface{}, error) {
+	var params struct {
+		ListenIp struct {
+			Ip          string `json:"ip"`
+			AnnouncedIp string `json:"announcedIp"`
+		} `json:"listenIp"`
+		RtcpMux bool `json:"rtcpMux"`
+		Comedia bool `json:"comedia"`
+	}
+	_ = json.Unmarshal(reqData, &params)
+
+	if _, ok := worker.routers[in.RouterId]; !ok {
+		return nil, fmt.Errorf("Router not found")
+	}
+
+	ip := params.ListenIp.Ip
+	if len(params.ListenIp.AnnouncedIp) > 0 {
+		ip = params.ListenIp.AnnouncedIp
+	}
+
+	plain := &fakePlainTransport{
+		rtcpMux: params.RtcpMux,
+		tuple: map[string]interface{}{
+			"localIp":   ip,
+			"localPort": *rtcMinPort + rand.Intn(*rtcMaxPort-*rtcMinPort+1),
+			"protocol":  "udp",
+		},
+	}
+
+	data := map[string]interface{}{
+		"id":          in.TransportId,
+		"rtcpMux":     params.RtcpMux,
+		"comedia":     params.Comedia,
+		"tuple":       plain.tuple,
+		"producerIds": []string{},
+		"consumerIds": []string{},
+		"sctpState":   "closed",
+	}
+	if !params.RtcpMux {
+		plain.rtcpTuple = map[string]interface{}{
+			"localIp":   ip,
+			"localPort": *rtcMinPort + rand.Intn(*rtcMaxPort-*rtcMinPort+1),
+			"protocol":  "udp",
+		}
+		data["rtcpTuple"] = plain.rtcpTuple
+	}
+
+	worker.transports[in.TransportId] = &fakeTransport{
+		routerId:    in.RouterId,
+		producerIds: make([]string, 0),
+		consumerIds: make([]string, 0),
+		plain:       plain,
+	}
+	worker.routers[in.RouterId] = append(worker.routers[in.RouterId], in.TransportId)
+
+	return data, nil
+}
+
+func (worker *fakeWorker) connectPlainTransport(plain *fakePlainTransport, reqData json.RawMessage) (interface{}, error) {
+	var params struct {
+		Ip       string `json:"ip"`
+		Port     int    `json:"port"`
+		RtcpPort int    `json:"rtcpPort"`
+	}
+	_ = json.Unmarshal(reqData, &params)
+
+	if len(params.Ip) == 0 || params.Port == 0 {
+		return nil, fmt.Errorf("missing ip or port")
+	}
+	if !plain.rtcpMux && params.RtcpPort == 0 {
+		return nil, fmt.Errorf("missing rtcpPort (required as rtcpMux is not set)")
+	}
+
+	plain.tuple["remoteIp"] = params.Ip
+	plain.tuple["remotePort"] = params.Port
+	data := map[string]interface{}{
+		"tuple": plain.tuple,
+	}
+	if plain.rtcpTuple != nil {
+		plain.rtcpTuple["remoteIp"] = params.Ip
+		plain.rtcpTuple["remotePort"] = params.RtcpPort
+		data["rtcpTuple"] = plain.rtcpTuple
+	}
+
+	return data, nil
+}
+
+func (worker *fakeWorker) produce(in *internal, reqData json.RawMessage) (interface{}, error) {
+	var params struct {
+		Kind          string `json:"kind"`
+		RtpParameters struct {
+			Encodings []json.RawMessage `json:"encodings"`
+		} `json:"rtpParameters"`
+		RtpMapping struct {
+			Encodings []struct {
+				MappedSsrc      int    `json:"mappedSsrc"`
+				ScalabilityMode string `json:"scalabilityMode"`
+			} `json:"encodings"`
+		} `json:"rtpMapping"`
+	}
+	_ = json.Unmarshal(reqData, &params)
+
+	transport := worker.transports[in.TransportId]
+	if transport == nil {
+		return nil, fmt.Errorf("Transport not found")
+	}
+
+	if params.Kind != "audio" && params.Kind != "video" {
+		return nil, fmt.Errorf("invalid kind")
+	}
+
+	if len(params.RtpParameters.Encodings) == 0 {
+		return nil, fmt.Errorf("empty rtpParameters.encodings")
+	}
+
+	producer := &fakeProducer{
+		kind:      params.Kind,
+		encodings: params.RtpParameters.Encodings,
+		ssrcs:     make([]int, 0),
+	}
+	for _, encoding := range params.RtpMapping.Encodings {
+		producer.ssrcs = append(producer.ssrcs, encoding.MappedSsrc)
+	}
+
+	worker.producers[in.ProducerId] = producer
+	transport.producerIds = append(transport.producerIds, in.ProducerId)
+
+	producerType := "simple"
+	if len(params.RtpParameters.Encodings) > 1 {
+		producerType = "simulcast"
+	} else if len(params.RtpMapping.Encodings) == 1 && len(params.RtpMapping.Encodings[0].ScalabilityMode) > 0 {
+		producerType = "svc"
+	}
+
+	return map[string]string{"type": producerType}, nil
+}
+
+// closeTransport drops the transport along with its producers and consumers.
+// Consumers of its producers on other transports get "producerclose", as with
+// mediasoup.
+func (worker *fakeWorker) closeTransport(transportId string) {
+	transport := worker.transports[transportId]
+	if transport == nil {
+		return
+	}
+	delete(worker.transports, transportId)
+
+	for _, consumerId := range transport.consumerIds {
+		delete(worker.consumers, consumerId)
+	}
+	for _, producerId := range transport.producerIds {
+		delete(worker.producers, producerId)
+		for consumerId, consumer := range worker.consumers {
+			if consumer.producerId == producerId {
+				delete(worker.consumers, consumerId)
+				worker.notify(consumerId, "producerclose", nil)
+			}
+		}
+	}
+}
+
+func (worker *fakeWorker) consume(in *internal, reqData json.RawMessage) (interface{}, error) {
+	var params struct {
+		Kind          string `json:"kind"`
+		Paused        bool   `json:"paused"`
+		RtpParameters struct {
+			Encodings []struct {
+				Ssrc int `json:"ssrc"`
+			} `json:"encodings"`
+		} `json:"rtpParameters"`
+		Type string `json:"type"`
+	}
+	_ = json.Unmarshal(reqData, &params)
+
+	transport := worker.transports[in.TransportId]
+	if transport == nil {
+		return nil, fmt.Errorf("Transport not found")
+	}
+
+	producer := worker.producers[in.ProducerId]
+	if producer == nil {
+		return nil, fmt.Errorf("Producer not found")
+	}
+
+	consumer := &fakeConsumer{
+		kind:       params.Kind,
+		producerId: in.ProducerId,
+	}
+	if len(params.RtpParameters.Encodings) > 0 {
+		consumer.ssrc = params.RtpParameters.Encodings[0].Ssrc
+	}
+
+	worker.consumers[in.ConsumerId] = consumer
+	transport.consumerIds = append(transport.consumerIds, in.ConsumerId)
+
+	data := map[string]interface{}{
+		"paused":         params.Paused,
+		"producerPaused": false,
+		"score":          consumerScore(len(producer.ssrcs)),
+	}
+	if params.Type == "simulcast" || params.Type == "svc" {
+		data["preferredLayers"] = map[string]int{
+			"spatialLayer":  len(producer.ssrcs) - 1,
+			"temporalLayer": 2,
+		}
+	}
+
+	return data, nil
+}
+
+func consumerScore(numStreams int) map[string]interface{} {
+	producerScores := make([]int, 0)
+	for i := 0; i < numStreams; i++ {
+		producerScores = append(producerScores, 10)
+	}
+
+	return map[string]interface{}{
+		"score":          10,
+		"producerScore":  10,
+		"producerScores": producerScores,
+	}
+}
+
+func transportStats(transportId string) []interface{} {
+	now := time.Now().UnixNano() / int64(time.Millisecond)
+
+	return []interface{}{
+		map[string]interface{}{
+			"type":                     "webrtc-transport",
+			"transportId":              transportId,
+			"timestamp":                now,
+			"iceRole":                  "controlled",
+			"iceState":                 "completed",
+			"dtlsState":                "connected",
+			"bytesReceived":            rand.Intn(10000000),
+			"bytesSent":                rand.Intn(10000000),
+			"recvBitrate":              rand.Intn(2000000),
+			"sendBitrate":              rand.Intn(2000000),
+			"rtpBytesReceived":         rand.Intn(10000000),
+			"rtpBytesSent":             rand.Intn(10000000),
+			"availableOutgoingBitrate": 1000000,
+			"maxIncomingBitrate":       1500000,
+		},
+	}
+}
+
+func rtpStreamStats(statsType string, kind string, ssrc int) map[string]interface{} {
+	mimeType := "audio/opus"
+	if kind == "video" {
+		mimeType = "video/VP8"
+	}
+
+	return map[string]interface{}{
+		"type":                 statsType,
+		"timestamp":            time.Now().UnixNano() / int64(time.Millisecond),
+		"ssrc":                 ssrc,
+		"kind":                 kind,
+		"mimeType":             mimeType,
+		"packetsLost":          rand.Intn(10),
+		"fractionLost":         0,
+		"packetsDiscarded":     0,
+		"packetsRetransmitted": rand.Intn(5),
+		"packetsRepaired":      0,
+		"nackCount":            rand.Intn(5),
+		"nackPacketCount":      rand.Intn(5),
+		"pliCount":             rand.Intn(3),
+		"firCount":             0,
+		"score":                10,
+		"packetCount":          rand.Intn(100000),
+		"byteCount":            rand.Intn(100000000),
+		"bitrate":              rand.Intn(2000000),
+		"roundTripTime":        float64(rand.Intn(50)) + 0.5,
+	}
+}
+
+func randomString(n int) string {
+	const letters = "abcdefghijklmnopqrstuvwxyz0123456789"
+
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = letters[rand.Intn(len(letters))]
+	}
+	return string(b)
+}
+
+func randomFingerprint(n int) string {
+	str := ""
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			str += ":"
+		}
+		str += fmt.Sprintf("%02X", rand.Intn(256))
+	}
+	return str
+}
@@ -78,6 +78,13 @@ type WebRtcTransportOptions struct {
 	SctpSendBufferSize     int
 }
 
+type PlainTransportOptions struct {
+	PlainTransportOptions conf.PlainTransportOptions_t
+	RtcpMux               bool
+	Comedia               bool
+	AppData               TransportAppData
+}
+
 type IP struct {
 	ListenIp string `json:"ip"`
 }
@@ -152,6 +159,7 @@ type IceCandidate_t struct {
 	Priority   int    `json:"priority"`
 	Protocol   string `json:"protocol"`
 	Type       string `json:"type"`
+	TcpType    string `json:"tcpType,omitempty"`
 }
 
 type IceSelectedTuple_t struct {
@@ -276,6 +284,49 @@ type WebRtcTransportAccept struct {
 	SctpParameter  json.RawMessage `json:"sctpParameters"`
 }
 
+type PlainTransport_ReqData struct {
+	ListenIp           ListenIp_t   `json:"listenIp"`
+	RtcpMux            bool         `json:"rtcpMux"`
+	Comedia            bool         `json:"comedia"`
+	EnableSctp         bool         `json:"enableSctp"`
+	NumSctpStreams     NumStreams_t `json:"numSctpStreams"`
+	MaxSctpMessageSize int          `json:"maxSctpMessageSize"`
+	SctpSendBufferSize int          `json:"sctpSendBufferSize"`
+	IsDataChannel      bool         `json:"isDataChannel"`
+	EnableSrtp         bool         `json:"enableSrtp"`
+}
+
+type TransportTuple struct {
+	LocalIp    string `json:"localIp"`
+	LocalPort  int    `json:"localPort"`
+	RemoteIp   string `json:"remoteIp,omitempty"`
+	RemotePort int    `json:"remotePort,omitempty"`
+	Protocol   string `json:"protocol"`
+}
+
+type PlainTransportData struct {
+	Id             string          `json:"id"`
+	RtcpMux        bool            `json:"rtcpMux"`
+	Comedia        bool            `json:"comedia"`
+	Tuple          TransportTuple  `json:"tuple"`
+	RtcpTuple      *TransportTuple `json:"rtcpTuple,omitempty"`
+	SctpParameters json.RawMessage `json:"sctpParameters,omitempty"`
+	SctpState      string          `json:"sctpState,omitempty"`
+	SrtpParameters json.RawMessage `json:"srtpParameters,omitempty"`
+}
+
+type PlainTransportConnectData struct {
+	Ip       string `json:"ip"`
+	Port     int    `json:"port"`
+	RtcpPort int    `json:"rtcpPort,omitempty"`
+}
+
+type PlainTransportConnectFB struct {
+	Tuple          TransportTuple  `json:"tuple"`
+	RtcpTuple      *TransportTuple `json:"rtcpTuple,omitempty"`
+	SrtpParameters json.RawMessage `json:"srtpParameters,omitempty"`
+}
+
 ////////////////////////////////////////////////////////////////////
 type NilAccept struct {
 }
@@ -295,6 +346,10 @@ type DtlsRoleFB struct {
 	DtlsLocalRole string `json:"dtlsLocalRole"`
 }
 
+type RestartIceFB struct {
+	IceParameters IceParameter_t `json:"iceParameters"`
+}
+
 // produce
 
 type ClientProduceData struct {
@@ -365,11 +420,23 @@ type ConsumeData struct {
 	Paused                 bool                        `json:"paused"`
 }
 
+type ConsumerLayers struct {
+	SpatialLayer  int `json:"spatialLayer"`
+	TemporalLayer int `json:"temporalLayer"`
+}
+
+// Score of the consumer and of the producer streams it consumes.
+type ConsumerScore struct {
+	Score          int   `json:"score"`
+	ProducerScore  int   `json:"producerScore"`
+	ProducerScores []int `json:"producerScores"`
+}
+
 type ConsumeFB struct {
-	Paused          bool `json:"paused"`
-	ProducerPaused  bool `json:"producerPaused"`
-	Score           int  `json:"score"`
-	PreferredLayers int  `json:"preferredLayers"`
+	Paused          bool            `json:"paused"`
+	ProducerPaused  bool            `json:"producerPaused"`
+	Score           ConsumerScore   `json:"score"`
+	PreferredLayers *ConsumerLayers `json:"preferredLayers,omitempty"`
 }
 
 type NewConsumerAppData struct {
@@ -386,6 +453,12 @@ type NewConsumerData struct {
 	ProducerPaused bool                    `json:"producerPaused"`
 }
 
+// Sent to the producing peer when a peer in the room has no matching codec.
+type ProducerNotConsumableData struct {
+	ProducerId string `json:"producerId"`
+	PeerId     string `json:"peerId"`
+}
+
 ////////////////////////////
 //data consumer
 type DataConsumer struct {
@@ -415,3 +488,67 @@ type ScoreDataResp struct {
 	ProducerId string          `json:"producerId"`
 	Score      json.RawMessage `json:"score"`
 }
+
+// rtp observer
+type RtpObserverInternal struct {
+	Internal_t
+	RtpObserverId string `json:"rtpObserverId"`
+}
+
+type RtpObserverProducerInternal struct {
+	RtpObserverInternal
+	ProducerId string `json:"producerId"`
+}
+
+// worker
+type WorkerResourceUsage struct {
+	Utime    float64 `json:"ru_utime"`
+	Stime    float64 `json:"ru_stime"`
+	Maxrss   int64   `json:"ru_maxrss"`
+	Ixrss    int64   `json:"ru_ixrss"`
+	Idrss    int64   `json:"ru_idrss"`
+	Isrss    int64   `json:"ru_isrss"`
+	Minflt   int64   `json:"ru_minflt"`
+	Majflt   int64   `json:"ru_majflt"`
+	Nswap    int64   `json:"ru_nswap"`
+	Inblock  int64   `json:"ru_inblock"`
+	Oublock  int64   `json:"ru_oublock"`
+	Msgsnd   int64   `json:"ru_msgsnd"`
+	Msgrcv   int64   `json:"ru_msgrcv"`
+	Nsignals int64   `json:"ru_nsignals"`
+	Nvcsw    int64   `json:"ru_nvcsw"`
+	Nivcsw   int64   `json:"ru_nivcsw"`
+}
+
+type ChannelMessageHandlers_t struct {
+	ChannelRequestHandlers             []string `json:"channelRequestHandlers"`
+	PayloadChannelRequestHandlers      []string `json:"payloadChannelRequestHandlers"`
+	PayloadChannelNotificationHandlers []string `json:"payloadChannelNotificationHandlers"`
+}
+
+type WorkerDump struct {
+	Pid                    int                      `json:"pid"`
+	RouterIds              []string                 `json:"routerIds"`
+	ChannelMessageHandlers ChannelMessageHandlers_t `json:"channelMessageHandlers"`
+}
+
+type WorkerHandlerCounts struct {
+	ChannelRequestHandlers             int `json:"channelRequestHandlers"`
+	PayloadChannelRequestHandlers      int `json:"payloadChannelRequestHandlers"`
+	PayloadChannelNotificationHandlers int `json:"payloadChannelNotificationHandlers"`
+}
+
+func (dump *WorkerDump) HandlerCounts() WorkerHandlerCounts {
+	return WorkerHandlerCounts{
+		ChannelRequestHandlers:             len(dump.ChannelMessageHandlers.ChannelRequestHandlers),
+		PayloadChannelRequestHandlers:      len(dump.ChannelMessageHandlers.PayloadChannelRequestHandlers),
+		PayloadChannelNotificationHandlers: len(dump.ChannelMessageHandlers.PayloadChannelNotificationHandlers),
+	}
+}
+
+// Sent to every peer of a room whose router had to be recreated, the peer
+// must create new transports and produce again.
+type MediaResetData struct {
+	Reason                string              `json:"reason"`
+	RouterRtpCapabilities rtp.RtpCapabilities `json:"routerRtpCapabilities"`
+}
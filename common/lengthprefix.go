@@ -0,0 +1,38 @@
+package common
+
+import "encoding/binary"
+
+/*
+length prefixed message example:------[0b 00 00 00]{data:data},  0x0b = len({data:data}) as uint32 little endian
+used by mediasoup-worker >= 3.9.0 instead of netstrings
+*/
+const LpHeaderLength = 4
+
+// Maximum message size accepted from the worker, same as mediasoup's
+// MESSAGE_MAX_LEN.
+const LpMaxMessageLength = 4194308
+
+func LpPayload(buffer []byte, off int) ([]byte, int) {
+	if len(buffer)-off < LpHeaderLength {
+		return nil, -1
+	}
+
+	nlen := int(binary.LittleEndian.Uint32(buffer[off : off+LpHeaderLength]))
+	if nlen > LpMaxMessageLength {
+		return nil, -2
+	}
+
+	if len(buffer)-off-LpHeaderLength < nlen {
+		return nil, -1
+	}
+
+	start := off + LpHeaderLength
+	return buffer[start : start+nlen], nlen
+}
+
+func LpWrite(payload []byte) []byte {
+	retB := make([]byte, LpHeaderLength, LpHeaderLength+len(payload))
+	binary.LittleEndian.PutUint32(retB, uint32(len(payload)))
+
+	return append(retB, payload...)
+}
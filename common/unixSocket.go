@@ -2,8 +2,10 @@ package common
 
 import (
 	"container/list"
+	"errors"
 	"net"
 	"os"
+	"sync"
 
 	"github.com/cloudwebrtc/go-protoo/logger"
 )
@@ -27,6 +29,10 @@ type UnixSocketServer struct {
 	listener     *net.UnixListener
 	connListener UnixConnListener
 	Handlers     *list.List //*UnixSocketHandler->ChannelHandler, PayloadHandler
+	closed       bool
+	// Guards Handlers and closed, the accept goroutine, the handler loops and
+	// the writers all use them.
+	mutex sync.Mutex
 }
 
 type UnixSocketClient struct {
@@ -44,6 +50,7 @@ type UnixSocketHandler struct {
 	UdListener UnixDataListener
 	Buffer     []byte
 	Running    bool
+	mutex      sync.Mutex
 }
 
 func NewUnixSocketHandler(conn *net.UnixConn, listener UnixDataListener) *UnixSocketHandler {
@@ -63,9 +70,8 @@ func (ush *UnixSocketHandler) Loop() {
 		return
 	}
 	for {
-		if !ush.Running {
+		if !ush.IsRunning() {
 			ush.Conn.Close()
-			ush.Conn = nil
 			return
 		}
 
@@ -76,7 +82,7 @@ func (ush *UnixSocketHandler) Loop() {
 
 func (ush *UnixSocketHandler) Send(buffer []byte) (n int, err error) {
 
-	if !ush.Running {
+	if !ush.IsRunning() {
 		n = -1
 		err = nil
 		return
@@ -86,7 +92,17 @@ func (ush *UnixSocketHandler) Send(buffer []byte) (n int, err error) {
 	return
 }
 
+func (ush *UnixSocketHandler) IsRunning() bool {
+	ush.mutex.Lock()
+	defer ush.mutex.Unlock()
+
+	return ush.Running
+}
+
 func (ush *UnixSocketHandler) Stop() {
+	ush.mutex.Lock()
+	defer ush.mutex.Unlock()
+
 	ush.Running = false
 }
 
@@ -122,7 +138,9 @@ func (uss *UnixSocketServer) createServer() error {
 	go func() {
 		for {
 			c, err := uss.listener.Accept()
-			if err != nil {
+			if err != nil && uss.isClosed() {
+				return
+			} else if err != nil {
 				logger.Errorf("Unix socket accept exception: %s", err.Error())
 				continue
 			}
@@ -139,21 +157,30 @@ func (uss *UnixSocketServer) StartServer() error {
 	return uss.createServer()
 }
 
-func (uss *UnixSocketServer) Stop() {
+func (uss *UnixSocketServer) isClosed() bool {
+	uss.mutex.Lock()
+	defer uss.mutex.Unlock()
 
-	for {
-		if uss.Handlers.Len() <= 0 {
-			break
-		}
+	return uss.closed
+}
 
-		el := uss.Handlers.Front()
-		uss.connListener.Stop(el.Value)
+func (uss *UnixSocketServer) Stop() {
+	uss.mutex.Lock()
+	uss.closed = true
+	handlers := make([]interface{}, 0, uss.Handlers.Len())
+	for el := uss.Handlers.Front(); el != nil; el = el.Next() {
+		handlers = append(handlers, el.Value)
+	}
+	uss.Handlers.Init()
+	uss.mutex.Unlock()
 
-		uss.Handlers.Remove(el)
+	for _, handler := range handlers {
+		uss.connListener.Stop(handler)
 	}
 	if uss.listener != nil {
 		uss.listener.Close()
 	}
+	os.Remove(uss.FileName)
 }
 
 func (uss *UnixSocketServer) HandleUnixConn(c *net.UnixConn) {
@@ -161,11 +188,42 @@ func (uss *UnixSocketServer) HandleUnixConn(c *net.UnixConn) {
 	uss.connListener.HandleUnixConn(c, uss)
 }
 
+// AddHandler registers the handler of an accepted connection, its element is
+// given back to RemoveHandler.
+func (uss *UnixSocketServer) AddHandler(handler interface{}) *list.Element {
+	uss.mutex.Lock()
+	defer uss.mutex.Unlock()
+
+	return uss.Handlers.PushBack(handler)
+}
+
+func (uss *UnixSocketServer) RemoveHandler(el *list.Element) {
+	uss.mutex.Lock()
+	defer uss.mutex.Unlock()
+
+	uss.Handlers.Remove(el)
+}
+
+func (uss *UnixSocketServer) HandlerCount() int {
+	uss.mutex.Lock()
+	defer uss.mutex.Unlock()
+
+	return uss.Handlers.Len()
+}
+
 func (uss *UnixSocketServer) Write(data []byte) (int, error) {
 	// just sent to first client, because one worker one producer
+	uss.mutex.Lock()
 	el := uss.Handlers.Front()
 	logger.Debugf("Handlers len:%d", uss.Handlers.Len())
-	return uss.connListener.Send(el.Value, data)
+	if el == nil {
+		uss.mutex.Unlock()
+		return 0, errors.New("no connection on " + uss.FileName)
+	}
+	handler := el.Value
+	uss.mutex.Unlock()
+
+	return uss.connListener.Send(handler, data)
 }
 
 func NewUnixSocketClient(fileName string) *UnixSocketClient {
@@ -11,27 +11,50 @@ type Https_t struct {
 	Tls        Tls_t  `json:"tls"`
 }
 
+// Operator HTTP endpoints, disabled when listenPort is 0.
+type Admin_t struct {
+	ListenIp   string `json:"listenIp"`
+	ListenPort int    `json:"listenPort"`
+}
+
+// Worker restart and liveness probe settings, 0 uses the default.
+type Supervisor_t struct {
+	ProbeInterval int `json:"probeInterval"` // seconds, 10
+	ProbeTimeout  int `json:"probeTimeout"`  // seconds, 5
+	StartTimeout  int `json:"startTimeout"`  // seconds, 10
+	MaxRestarts   int `json:"maxRestarts"`   // per restartWindow, 5
+	RestartWindow int `json:"restartWindow"` // seconds, 300
+	MinBackoff    int `json:"minBackoff"`    // milliseconds, 1000
+	MaxBackoff    int `json:"maxBackoff"`    // milliseconds, 60000
+}
+
 type WorkerSettings_t struct {
 	LogLevel   string `json:"logLevel"`
 	RtcMinPort int    `json:"rtcMinPort"`
 	RtcMaxPort int    `json:"rtcMaxPort"`
+	// Worker output lines kept to print when a worker dies, 100 when unset.
+	LogTail int `json:"logTail"`
 }
 
-type MediaCodecs_Param_t struct {
-	X_google_start_bitrate  int    `json:"x-google-start-bitrate,omitempty"`
-	Packetization_mode      int    `json:"packetization_mode,omitempty"`
-	Profile_level_id        string `json:"profile-level-id"`
-	Profile_id              int    `json:"profile-id,omitempty"`
-	Level_asymmetry_allowed int    `json:"level_asymmetry_allowed,omitempty"`
+type RtcpFeedback_t struct {
+	Type      string `json:"type"`
+	Parameter string `json:"parameter"`
 }
 
 type MediaCodec_t struct {
-	Kind                 string              `json:"kind"`
-	MimeType             string              `json:"mimeType"`
-	ClockRate            int                 `json:"clockRate"`
-	Channels             int                 `json:"channels"`
-	PreferredPayloadType int                 `json:"preferredPayloadType"`
-	Parameters           MediaCodecs_Param_t `json:"parameters"`
+	Kind                 string `json:"kind"`
+	MimeType             string `json:"mimeType"`
+	ClockRate            int    `json:"clockRate"`
+	Channels             int    `json:"channels"`
+	PreferredPayloadType int    `json:"preferredPayloadType"`
+	// Codec parameters (fmtp) merged into those of the supported codec, e.g.
+	// "packetization-mode", "profile-level-id" or "x-google-start-bitrate".
+	Parameters map[string]interface{} `json:"parameters"`
+	// Replaces the RTCP feedback of the supported codec when given.
+	RtcpFeedback []RtcpFeedback_t `json:"rtcpFeedback"`
+	// Audio codec parameters overriding those of the producer in consumers,
+	// e.g. "stereo" for music or "useinbandfec" and "usedtx" for voice.
+	ConsumerParameters map[string]interface{} `json:"consumerParameters"`
 }
 
 type ListenIp_t struct {
@@ -52,16 +75,27 @@ type PlainTransportOptions_t struct {
 	MaxSctpMessageSize int        `json:"maxSctpMessageSize"`
 }
 
+type ActiveSpeakerObserverOptions_t struct {
+	Interval int `json:"interval"`
+}
+
 type RouterOptions_t struct {
-	MediaCodecs            []MediaCodec_t           `json:"mediaCodecs"`
-	WebRtcTransportOptions WebRtcTransportOptions_t `json:"webRtcTransportOptions"`
+	MediaCodecs            []MediaCodec_t                  `json:"mediaCodecs"`
+	WebRtcTransportOptions WebRtcTransportOptions_t        `json:"webRtcTransportOptions"`
+	ActiveSpeakerObserver  *ActiveSpeakerObserverOptions_t `json:"activeSpeakerObserver,omitempty"`
 }
 type MediaSoup_t struct {
-	NumWorkers int    `json:"numWorkers"`
-	WorkerPath string `json:"workerPath"`
-	UnixPath   string `json:"unixPath"`
+	NumWorkers    int    `json:"numWorkers"`
+	WorkerPath    string `json:"workerPath"`
+	WorkerVersion string `json:"workerVersion"`
+	UnixPath      string `json:"unixPath"`
+	// roundRobin (default), leastRouters, leastConsumers or lowestCpu.
+	WorkerSelection string `json:"workerSelection"`
+	// Directory to write channel captures to, disabled when empty.
+	CaptureDir string `json:"captureDir"`
 
 	WorkerSettings WorkerSettings_t `json:"workerSettings"`
+	Supervisor     Supervisor_t     `json:"supervisor"`
 	RouterOptions  RouterOptions_t  `json:"routerOptions"`
 
 	WebRtcTransportOptions WebRtcTransportOptions_t `json:"webRtcTransportOptions"`
@@ -71,5 +105,8 @@ type MediaSoup_t struct {
 type Config struct {
 	Domain    string      `json:"domain"`
 	Https     Https_t     `json:"https"`
+	Admin     Admin_t     `json:"admin"`
 	Mediasoup MediaSoup_t `json:"mediasoup"`
+	// Seconds a draining controller or worker waits for its rooms, 600 when unset.
+	DrainTimeout int `json:"drainTimeout"`
 }
@@ -1,6 +1,7 @@
 package libs
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 
@@ -44,6 +45,29 @@ type ProfileLevelId struct {
 	level   int
 }
 
+// Default ProfileLevelId.
+//
+// TODO: The default should really be profile Baseline and level 1 according to
+// the spec: https://tools.ietf.org/html/rfc6184#section-8.1. In order to not
+// break backwards compatibility with older versions of WebRTC where external
+// codecs don't have any parameters, use profile ConstrainedBaseline level 3_1
+// instead. This workaround will only be done in an interim period to allow
+// external clients to update their code.
+//
+// http://crbug/webrtc/6337.
+var DefaultProfileLevelId = ProfileLevelId{
+	profile: ProfileConstrainedBaseline,
+	level:   Level3_1,
+}
+
+func (profileLevelId *ProfileLevelId) Profile() int {
+	return profileLevelId.profile
+}
+
+func (profileLevelId *ProfileLevelId) Level() int {
+	return profileLevelId.level
+}
+
 type BitPattern struct {
 	mask        byte
 	maskedValue byte
@@ -160,20 +184,21 @@ func btoi(b bool) byte {
  *
  * @returns {ProfileLevelId}
  */
-func parseProfileLevelId(str string) *ProfileLevelId {
+func ParseProfileLevelId(str string) *ProfileLevelId {
 	// The string should consist of 3 bytes in hexadecimal format.
 	if len(str) != 6 {
 		return nil
 	}
 
-	profile_level_id_numeric, _ := strconv.Atoi(str)
+	profile_level_id_numeric, err := strconv.ParseUint(str, 16, 32)
 
-	if profile_level_id_numeric == 0 {
+	// If string is not a valid hex string, or the value is 0, return nil.
+	if err != nil || profile_level_id_numeric == 0 {
 		return nil
 	}
 
 	// Separate into three bytes.
-	level_idc := profile_level_id_numeric & 0xFF
+	level_idc := int(profile_level_id_numeric & 0xFF)
 	profile_iop := byte(profile_level_id_numeric>>8) & 0xFF
 	profile_idc := byte(profile_level_id_numeric>>16) & 0xFF
 
@@ -182,48 +207,23 @@ func parseProfileLevelId(str string) *ProfileLevelId {
 
 	switch level_idc {
 	case Level1_1:
-		{
-			if (profile_iop & ConstraintSet3Flag) != 0 {
-				level = Level1_b
-			} else {
-				level = Level1_1
-			}
-			break
-		}
-	case Level1:
-	case Level1_2:
-	case Level1_3:
-	case Level2:
-	case Level2_1:
-	case Level2_2:
-	case Level3:
-	case Level3_1:
-	case Level3_2:
-	case Level4:
-	case Level4_1:
-	case Level4_2:
-	case Level5:
-	case Level5_1:
-	case Level5_2:
-		{
-			level = level_idc
-			break
+		if (profile_iop & ConstraintSet3Flag) != 0 {
+			level = Level1_b
+		} else {
+			level = Level1_1
 		}
+	case Level1, Level1_2, Level1_3, Level2, Level2_1, Level2_2, Level3,
+		Level3_1, Level3_2, Level4, Level4_1, Level4_2, Level5, Level5_1, Level5_2:
+		level = level_idc
 	// Unrecognized level_idc.
 	default:
-		{
-			// debug('parseProfileLevelId() | unrecognized level_idc:%s', level_idc);
-			logger.Debugf("parseProfileLevelId() | unrecognized level_idc:%d", level_idc)
-			return nil
-		}
+		logger.Debugf("parseProfileLevelId() | unrecognized level_idc:%d", level_idc)
+		return nil
 	}
 
 	// Parse profile_idc/profile_iop into a Profile enum.
-	//for (const pattern of ProfilePatterns)
-	ProfilePatterns := CreateProfilePatterns()
-	for _, pattern := range ProfilePatterns {
+	for _, pattern := range CreateProfilePatterns() {
 		if profile_idc == pattern.profile_idc && pattern.profile_iop.isMatch(profile_iop) {
-
 			return &ProfileLevelId{
 				profile: pattern.profile,
 				level:   level,
@@ -231,36 +231,11 @@ func parseProfileLevelId(str string) *ProfileLevelId {
 		}
 	}
 
-	logger.Errorf("parseProfileLevelId() | unrecognized profile_idc/profile_iop combination")
+	logger.Debugf("parseProfileLevelId() | unrecognized profile_idc/profile_iop combination")
 
 	return nil
 }
 
-func isLessLevel(a int, b int) bool {
-	if a == Level1_b {
-		return b != Level1 && b != Level1_b
-	}
-
-	if b == Level1_b {
-		return a != Level1
-	}
-
-	return a < b
-}
-
-func minLevel(a int, b int) int {
-
-	ret := isLessLevel(a, b)
-	if ret {
-		return a
-	}
-	return b
-}
-
-func isLevelAsymmetryAllowed(level_asymmetry_allowed int) bool {
-	return level_asymmetry_allowed == 1
-}
-
 /**
  * Returns canonical string representation as three hex bytes of the profile
  * level id, or returns nothing for invalid profile level ids.
@@ -269,75 +244,42 @@ func isLevelAsymmetryAllowed(level_asymmetry_allowed int) bool {
  *
  * @returns {String}
  */
-func profileLevelIdToString(profileLevelId *ProfileLevelId) string {
+func ProfileLevelIdToString(profile_level_id *ProfileLevelId) string {
 	// Handle special case level == 1b.
-	if profileLevelId.level == Level1_b {
-		switch profileLevelId.profile {
-
+	if profile_level_id.level == Level1_b {
+		switch profile_level_id.profile {
 		case ProfileConstrainedBaseline:
-			{
-				return "42f00b"
-			}
+			return "42f00b"
 		case ProfileBaseline:
-			{
-				return "42100b"
-			}
+			return "42100b"
 		case ProfileMain:
-			{
-				return "4d100b"
-			}
+			return "4d100b"
 		// Level 1_b is not allowed for other profiles.
 		default:
-			{
-				logger.Debugf("profileLevelIdToString() | Level 1_b not is allowed for profile:%d", profileLevelId.profile)
-				return ""
-			}
+			logger.Debugf("profileLevelIdToString() | Level 1_b not is allowed for profile:%d", profile_level_id.profile)
+			return ""
 		}
 	}
 
 	var profile_idc_iop_string string
 
-	switch profileLevelId.profile {
+	switch profile_level_id.profile {
 	case ProfileConstrainedBaseline:
-		{
-			profile_idc_iop_string = "42e0"
-			break
-		}
+		profile_idc_iop_string = "42e0"
 	case ProfileBaseline:
-		{
-			profile_idc_iop_string = "4200"
-			break
-		}
+		profile_idc_iop_string = "4200"
 	case ProfileMain:
-		{
-			profile_idc_iop_string = "4d00"
-			break
-		}
+		profile_idc_iop_string = "4d00"
 	case ProfileConstrainedHigh:
-		{
-			profile_idc_iop_string = "640c"
-			break
-		}
+		profile_idc_iop_string = "640c"
 	case ProfileHigh:
-		{
-			profile_idc_iop_string = "6400"
-			break
-		}
+		profile_idc_iop_string = "6400"
 	default:
-		{
-			logger.Debugf("profileLevelIdToString() | unrecognized profile:%d", profileLevelId.profile)
-
-			return ""
-		}
-	}
-
-	levelStr := strconv.Itoa(int(profileLevelId.level))
-
-	if len(levelStr) == 1 {
-		levelStr = fmt.Sprintf("0%s", levelStr)
+		logger.Debugf("profileLevelIdToString() | unrecognized profile:%d", profile_level_id.profile)
+		return ""
 	}
 
-	return fmt.Sprintf("%s%s", profile_idc_iop_string, levelStr)
+	return fmt.Sprintf("%s%02x", profile_idc_iop_string, profile_level_id.level)
 }
 
 /**
@@ -350,16 +292,20 @@ func profileLevelIdToString(profileLevelId *ProfileLevelId) string {
  *
  * @returns {ProfileLevelId}
  */
-func parseSdpProfileLevelId(profile_level_id string) *ProfileLevelId {
-	if len(profile_level_id) == 0 {
+func ParseSdpProfileLevelId(params map[string]interface{}) *ProfileLevelId {
+	value, ok := params["profile-level-id"]
+	if !ok || value == nil || value == "" {
+		default_profile_level_id := DefaultProfileLevelId
+		return &default_profile_level_id
+	}
 
-		return &ProfileLevelId{
-			profile: ProfileConstrainedBaseline,
-			level:   Level3_1,
-		}
-	} else {
-		return parseProfileLevelId(profile_level_id)
+	// It must be a string, as in SDP.
+	profile_level_id, ok := value.(string)
+	if !ok {
+		return nil
 	}
+
+	return ParseProfileLevelId(profile_level_id)
 }
 
 /**
@@ -371,12 +317,13 @@ func parseSdpProfileLevelId(profile_level_id string) *ProfileLevelId {
  *
  * @returns {Boolean}
  */
-func IsSameProfile(profile_level_id1 string, profile_level_id12 string) bool {
-	profile_level_id_1 := parseSdpProfileLevelId(profile_level_id1)
-	profile_level_id_2 := parseSdpProfileLevelId(profile_level_id12)
+func IsSameProfile(params1 map[string]interface{}, params2 map[string]interface{}) bool {
+	profile_level_id_1 := ParseSdpProfileLevelId(params1)
+	profile_level_id_2 := ParseSdpProfileLevelId(params2)
 
 	// Compare H264 profiles, but not levels.
-	return profile_level_id_1.profile == profile_level_id_2.profile
+	return profile_level_id_1 != nil && profile_level_id_2 != nil &&
+		profile_level_id_1.profile == profile_level_id_2.profile
 }
 
 /**
@@ -401,40 +348,40 @@ func IsSameProfile(profile_level_id1 string, profile_level_id12 string) bool {
  * @param {Object} [remote_offered_params={}]
  *
  * @returns {String} Canonical string representation as three hex bytes of the
- *   profile level id, or null if no one of the params have profile-level-id.
+ *   profile level id, or empty if no one of the params have profile-level-id.
  *
- * @throws {TypeError} If Profile mismatch or invalid params.
+ * @returns {error} If Profile mismatch or invalid params.
  */
-func GenerateProfileLevelIdForAnswer(local_supported_profile_level_id string, remote_offered_params_profile_level_id string) (string, bool) {
+func GenerateProfileLevelIdForAnswer(local_supported_params map[string]interface{}, remote_offered_params map[string]interface{}) (string, error) {
 	// If both local and remote params do not contain profile-level-id, they are
 	// both using the default profile. In this case, don't return anything.
+	_, local_has := local_supported_params["profile-level-id"]
+	_, remote_has := remote_offered_params["profile-level-id"]
+	if !local_has && !remote_has {
+		logger.Debugf("generateProfileLevelIdForAnswer() | no profile-level-id in local and remote params")
+		return "", nil
+	}
 
 	// Parse profile-level-ids.
-	n_local_supported_profile_level_id, _ := strconv.Atoi(local_supported_profile_level_id)
-	n_remote_offered_params_profile_level_id, _ := strconv.Atoi(remote_offered_params_profile_level_id)
-	local_profile_level_id := parseSdpProfileLevelId(local_supported_profile_level_id)
-	remote_profile_level_id := parseSdpProfileLevelId(remote_offered_params_profile_level_id)
+	local_profile_level_id := ParseSdpProfileLevelId(local_supported_params)
+	remote_profile_level_id := ParseSdpProfileLevelId(remote_offered_params)
 
 	// The local and remote codec must have valid and equal H264 Profiles.
 	if local_profile_level_id == nil {
-		logger.Errorf("invalid local_profile_level_id")
-
-		return "", false
+		return "", errors.New("invalid local_profile_level_id")
 	}
 
 	if remote_profile_level_id == nil {
-		logger.Errorf("invalid remote_profile_level_id")
-		return "", false
+		return "", errors.New("invalid remote_profile_level_id")
 	}
 
 	if local_profile_level_id.profile != remote_profile_level_id.profile {
-		logger.Errorf("H264 Profile mismatch")
-		return "", false
+		return "", errors.New("H264 Profile mismatch")
 	}
 
 	// Parse level information.
-	level_asymmetry_allowed := isLevelAsymmetryAllowed(n_local_supported_profile_level_id) &&
-		isLevelAsymmetryAllowed(n_remote_offered_params_profile_level_id)
+	level_asymmetry_allowed := isLevelAsymmetryAllowed(local_supported_params) &&
+		isLevelAsymmetryAllowed(remote_offered_params)
 
 	local_level := local_profile_level_id.level
 	remote_level := remote_profile_level_id.level
@@ -443,9 +390,9 @@ func GenerateProfileLevelIdForAnswer(local_supported_profile_level_id string, re
 	// Determine answer level. When level asymmetry is not allowed, level upgrade
 	// is not allowed, i.e., the level in the answer must be equal to or lower
 	// than the level in the offer.
-	answer_level := n_local_supported_profile_level_id
-	if !level_asymmetry_allowed {
-		answer_level = min_level
+	answer_level := min_level
+	if level_asymmetry_allowed {
+		answer_level = local_level
 	}
 
 	logger.Debugf(
@@ -453,9 +400,95 @@ func GenerateProfileLevelIdForAnswer(local_supported_profile_level_id string, re
 		local_profile_level_id.profile, answer_level)
 
 	// Return the resulting profile-level-id for the answer parameters.
-	return profileLevelIdToString(
+	return ProfileLevelIdToString(
 		&ProfileLevelId{
 			profile: local_profile_level_id.profile,
 			level:   answer_level,
-		}), true
+		}), nil
+}
+
+type levelConstraint struct {
+	max_macroblocks_per_second int
+	max_macroblock_frame_size  int
+	level                      int
+}
+
+// This is from ITU-T H.264 (02/2016) Table A-1 – Level limits.
+var levelConstraints = []levelConstraint{
+	{1485, 99, Level1},
+	{1485, 99, Level1_b},
+	{3000, 396, Level1_1},
+	{6000, 396, Level1_2},
+	{11880, 396, Level1_3},
+	{11880, 396, Level2},
+	{19800, 792, Level2_1},
+	{20250, 1620, Level2_2},
+	{40500, 1620, Level3},
+	{108000, 3600, Level3_1},
+	{216000, 5120, Level3_2},
+	{245760, 8192, Level4},
+	{245760, 8192, Level4_1},
+	{522240, 8704, Level4_2},
+	{589824, 22080, Level5},
+	{983040, 36864, Level5_1},
+	{2073600, 36864, Level5_2},
+}
+
+/**
+ * Given that a decoder supports up to a given frame size (in pixels) at up to
+ * a given number of frames per second, return the highest H264 level where it
+ * can guarantee that it will be able to support all valid encoded streams that
+ * are within that level.
+ *
+ * @param {Number} max_frame_pixel_count
+ * @param {Number} max_fps
+ *
+ * @returns {Number} The level, false when none.
+ */
+func SupportedLevel(max_frame_pixel_count int, max_fps int) (int, bool) {
+	const PixelsPerMacroblock = 16 * 16
+
+	for i := len(levelConstraints) - 1; i >= 0; i-- {
+		level_constraint := levelConstraints[i]
+
+		if level_constraint.max_macroblock_frame_size*PixelsPerMacroblock <= max_frame_pixel_count &&
+			level_constraint.max_macroblocks_per_second <= max_fps*level_constraint.max_macroblock_frame_size {
+			return level_constraint.level, true
+		}
+	}
+
+	// No level supported.
+	return 0, false
+}
+
+func isLessLevel(a int, b int) bool {
+	if a == Level1_b {
+		return b != Level1 && b != Level1_b
+	}
+
+	if b == Level1_b {
+		return a != Level1
+	}
+
+	return a < b
+}
+
+func minLevel(a int, b int) int {
+	if isLessLevel(a, b) {
+		return a
+	}
+	return b
+}
+
+func isLevelAsymmetryAllowed(params map[string]interface{}) bool {
+	switch level_asymmetry_allowed := params["level-asymmetry-allowed"].(type) {
+	case int:
+		return level_asymmetry_allowed == 1
+	case float64:
+		return level_asymmetry_allowed == 1
+	case string:
+		return level_asymmetry_allowed == "1"
+	}
+
+	return false
 }
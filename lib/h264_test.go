@@ -0,0 +1,251 @@
+package libs
+
+import "testing"
+
+// Test vectors of the h264-profile-level-id module used by mediasoup.
+
+func TestParsingInvalid(t *testing.T) {
+	for _, str := range []string{
+		// Malformed strings.
+		"",
+		" 42e01f",
+		"4242e01f",
+		"e01f",
+		"gggggg",
+		// Invalid level.
+		"42e000",
+		"42e00f",
+		"42e0ff",
+		// Invalid profile.
+		"42e11f",
+		"58601f",
+		"64e01f",
+	} {
+		if profile_level_id := ParseProfileLevelId(str); profile_level_id != nil {
+			t.Errorf("ParseProfileLevelId(%q) = %+v, want nil", str, *profile_level_id)
+		}
+	}
+}
+
+func TestParsingLevel(t *testing.T) {
+	for _, tc := range []struct {
+		str   string
+		level int
+	}{
+		{"42e01f", Level3_1},
+		{"42e00b", Level1_1},
+		{"42f00b", Level1_b},
+		{"42C02A", Level4_2},
+		{"640c34", Level5_2},
+	} {
+		profile_level_id := ParseProfileLevelId(tc.str)
+		if profile_level_id == nil || profile_level_id.level != tc.level {
+			t.Errorf("ParseProfileLevelId(%q) = %+v, want level %d", tc.str, profile_level_id, tc.level)
+		}
+	}
+}
+
+func TestParsingConstrainedBaseline(t *testing.T) {
+	for _, str := range []string{"42e01f", "42C02A", "4de01f", "58f01f"} {
+		profile_level_id := ParseProfileLevelId(str)
+		if profile_level_id == nil || profile_level_id.profile != ProfileConstrainedBaseline {
+			t.Errorf("ParseProfileLevelId(%q) = %+v, want ConstrainedBaseline", str, profile_level_id)
+		}
+	}
+}
+
+func TestParsingProfile(t *testing.T) {
+	for _, tc := range []struct {
+		str     string
+		profile int
+	}{
+		{"42a01f", ProfileBaseline},
+		{"58A01F", ProfileBaseline},
+		{"4D401f", ProfileMain},
+		{"64001f", ProfileHigh},
+		{"640c1f", ProfileConstrainedHigh},
+	} {
+		profile_level_id := ParseProfileLevelId(tc.str)
+		if profile_level_id == nil || profile_level_id.profile != tc.profile {
+			t.Errorf("ParseProfileLevelId(%q) = %+v, want profile %d", tc.str, profile_level_id, tc.profile)
+		}
+	}
+}
+
+func TestParsingSdpProfileLevelIdEmpty(t *testing.T) {
+	profile_level_id := ParseSdpProfileLevelId(map[string]interface{}{})
+	if profile_level_id == nil || *profile_level_id != DefaultProfileLevelId {
+		t.Errorf("ParseSdpProfileLevelId({}) = %+v, want %+v", profile_level_id, DefaultProfileLevelId)
+	}
+}
+
+func TestParsingSdpProfileLevelIdConstrainedHigh(t *testing.T) {
+	profile_level_id := ParseSdpProfileLevelId(map[string]interface{}{"profile-level-id": "640c2a"})
+	if profile_level_id == nil || profile_level_id.profile != ProfileConstrainedHigh || profile_level_id.level != Level4_2 {
+		t.Errorf("ParseSdpProfileLevelId(640c2a) = %+v, want ConstrainedHigh 4.2", profile_level_id)
+	}
+}
+
+func TestParsingSdpProfileLevelIdInvalid(t *testing.T) {
+	if profile_level_id := ParseSdpProfileLevelId(map[string]interface{}{"profile-level-id": "foobar"}); profile_level_id != nil {
+		t.Errorf("ParseSdpProfileLevelId(foobar) = %+v, want nil", *profile_level_id)
+	}
+}
+
+func TestToString(t *testing.T) {
+	for _, tc := range []struct {
+		profile int
+		level   int
+		str     string
+	}{
+		{ProfileConstrainedBaseline, Level3_1, "42e01f"},
+		{ProfileBaseline, Level1, "42000a"},
+		{ProfileMain, Level3_1, "4d001f"},
+		{ProfileConstrainedHigh, Level4_2, "640c2a"},
+		{ProfileHigh, Level4_2, "64002a"},
+		// Level 1b.
+		{ProfileConstrainedBaseline, Level1_b, "42f00b"},
+		{ProfileBaseline, Level1_b, "42100b"},
+		{ProfileMain, Level1_b, "4d100b"},
+		// Invalid.
+		{ProfileHigh, Level1_b, ""},
+		{ProfileConstrainedHigh, Level1_b, ""},
+		{255, Level3_1, ""},
+	} {
+		str := ProfileLevelIdToString(&ProfileLevelId{profile: tc.profile, level: tc.level})
+		if str != tc.str {
+			t.Errorf("ProfileLevelIdToString(%d, %d) = %q, want %q", tc.profile, tc.level, str, tc.str)
+		}
+	}
+}
+
+func TestToStringRoundTrip(t *testing.T) {
+	for _, tc := range []struct {
+		str  string
+		want string
+	}{
+		{"42e01f", "42e01f"},
+		{"42E01F", "42e01f"},
+		{"4d100b", "4d100b"},
+		{"4D100B", "4d100b"},
+		{"640c2a", "640c2a"},
+		{"640C2A", "640c2a"},
+	} {
+		profile_level_id := ParseProfileLevelId(tc.str)
+		if profile_level_id == nil {
+			t.Errorf("ParseProfileLevelId(%q) = nil", tc.str)
+			continue
+		}
+		if str := ProfileLevelIdToString(profile_level_id); str != tc.want {
+			t.Errorf("round trip of %q = %q, want %q", tc.str, str, tc.want)
+		}
+	}
+}
+
+func TestIsSameProfile(t *testing.T) {
+	for _, tc := range []struct {
+		params1 map[string]interface{}
+		params2 map[string]interface{}
+	}{
+		{map[string]interface{}{"foo": "foo"}, map[string]interface{}{"bar": "bar"}},
+		{map[string]interface{}{"profile-level-id": "42e01f"}, map[string]interface{}{"profile-level-id": "42C02A"}},
+		{map[string]interface{}{"profile-level-id": "42a01f"}, map[string]interface{}{"profile-level-id": "58A01F"}},
+		{map[string]interface{}{"profile-level-id": "42e01f"}, map[string]interface{}{}},
+	} {
+		if !IsSameProfile(tc.params1, tc.params2) {
+			t.Errorf("IsSameProfile(%v, %v) = false, want true", tc.params1, tc.params2)
+		}
+	}
+}
+
+func TestIsNotSameProfile(t *testing.T) {
+	for _, tc := range []struct {
+		params1 map[string]interface{}
+		params2 map[string]interface{}
+	}{
+		{map[string]interface{}{}, map[string]interface{}{"profile-level-id": "4d001f"}},
+		{map[string]interface{}{"profile-level-id": "42a01f"}, map[string]interface{}{"profile-level-id": "640c1f"}},
+		{map[string]interface{}{"profile-level-id": "42000a"}, map[string]interface{}{"profile-level-id": "64002a"}},
+	} {
+		if IsSameProfile(tc.params1, tc.params2) {
+			t.Errorf("IsSameProfile(%v, %v) = true, want false", tc.params1, tc.params2)
+		}
+	}
+}
+
+func TestGenerateProfileLevelIdForAnswerEmpty(t *testing.T) {
+	answer, err := GenerateProfileLevelIdForAnswer(map[string]interface{}{}, map[string]interface{}{})
+	if err != nil || answer != "" {
+		t.Errorf("GenerateProfileLevelIdForAnswer({}, {}) = %q, %v, want empty", answer, err)
+	}
+}
+
+func TestGenerateProfileLevelIdForAnswerLevelSymmetryCapped(t *testing.T) {
+	low_level := map[string]interface{}{"profile-level-id": "42e015"}
+	high_level := map[string]interface{}{"profile-level-id": "42e01f"}
+
+	if answer, err := GenerateProfileLevelIdForAnswer(low_level, high_level); err != nil || answer != "42e015" {
+		t.Errorf("GenerateProfileLevelIdForAnswer(low, high) = %q, %v, want 42e015", answer, err)
+	}
+	if answer, err := GenerateProfileLevelIdForAnswer(high_level, low_level); err != nil || answer != "42e015" {
+		t.Errorf("GenerateProfileLevelIdForAnswer(high, low) = %q, %v, want 42e015", answer, err)
+	}
+}
+
+func TestGenerateProfileLevelIdForAnswerConstrainedBaselineLevelAsymmetry(t *testing.T) {
+	local_params := map[string]interface{}{
+		"profile-level-id":        "42e01f",
+		"level-asymmetry-allowed": "1",
+	}
+	remote_params := map[string]interface{}{
+		"profile-level-id":        "42e015",
+		"level-asymmetry-allowed": 1,
+	}
+
+	if answer, err := GenerateProfileLevelIdForAnswer(local_params, remote_params); err != nil || answer != "42e01f" {
+		t.Errorf("GenerateProfileLevelIdForAnswer() = %q, %v, want 42e01f", answer, err)
+	}
+}
+
+func TestGenerateProfileLevelIdForAnswerProfileMismatch(t *testing.T) {
+	local_params := map[string]interface{}{"profile-level-id": "42e01f"}
+	remote_params := map[string]interface{}{"profile-level-id": "640c1f"}
+
+	if answer, err := GenerateProfileLevelIdForAnswer(local_params, remote_params); err == nil {
+		t.Errorf("GenerateProfileLevelIdForAnswer() = %q, want an error", answer)
+	}
+}
+
+func TestSupportedLevel(t *testing.T) {
+	for _, tc := range []struct {
+		max_frame_pixel_count int
+		max_fps               int
+		level                 int
+	}{
+		{640 * 480, 25, Level2_1},
+		{1280 * 720, 30, Level3_1},
+		{1920 * 1280, 60, Level4_2},
+	} {
+		level, ok := SupportedLevel(tc.max_frame_pixel_count, tc.max_fps)
+		if !ok || level != tc.level {
+			t.Errorf("SupportedLevel(%d, %d) = %d, %t, want %d", tc.max_frame_pixel_count, tc.max_fps, level, ok, tc.level)
+		}
+	}
+}
+
+func TestSupportedLevelInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		max_frame_pixel_count int
+		max_fps               int
+	}{
+		{0, 0},
+		// All levels support fps > 5.
+		{1280 * 720, 5},
+		// All levels support frame sizes > 183 * 137.
+		{183 * 137, 30},
+	} {
+		if level, ok := SupportedLevel(tc.max_frame_pixel_count, tc.max_fps); ok {
+			t.Errorf("SupportedLevel(%d, %d) = %d, want none", tc.max_frame_pixel_count, tc.max_fps, level)
+		}
+	}
+}
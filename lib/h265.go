@@ -0,0 +1,189 @@
+package libs
+
+import "strconv"
+
+const (
+	H265ProfileMain                              = 1
+	H265ProfileMain10                            = 2
+	H265ProfileMainStill                         = 3
+	H265ProfileRangeExtensions                   = 4
+	H265ProfileHighThroughput                    = 5
+	H265ProfileMultiviewMain                     = 6
+	H265ProfileScalableMain                      = 7
+	H265Profile3dMain                            = 8
+	H265ProfileScreenContentCoding               = 9
+	H265ProfileScalableRangeExtensions           = 10
+	H265ProfileHighThroughputScreenContentCoding = 11
+
+	H265TierMain = 0
+	H265TierHigh = 1
+
+	// All values are equal to 30 times the level number.
+	H265Level1   = 30
+	H265Level2   = 60
+	H265Level2_1 = 63
+	H265Level3   = 90
+	H265Level3_1 = 93
+	H265Level4   = 120
+	H265Level4_1 = 123
+	H265Level5   = 150
+	H265Level5_1 = 153
+	H265Level5_2 = 156
+	H265Level6   = 180
+	H265Level6_1 = 183
+	H265Level6_2 = 186
+)
+
+// Default transmission mode, single RTP stream on a single media transport.
+const H265DefaultTxMode = "SRST"
+
+type H265ProfileTierLevel struct {
+	profile int
+	tier    int
+	level   int
+}
+
+// Defaults of RFC 7798 section 7.1 when the parameters are not present.
+var DefaultH265ProfileTierLevel = H265ProfileTierLevel{
+	profile: H265ProfileMain,
+	tier:    H265TierMain,
+	level:   H265Level3_1,
+}
+
+func (profileTierLevel *H265ProfileTierLevel) Profile() int {
+	return profileTierLevel.profile
+}
+
+func (profileTierLevel *H265ProfileTierLevel) Tier() int {
+	return profileTierLevel.tier
+}
+
+func (profileTierLevel *H265ProfileTierLevel) Level() int {
+	return profileTierLevel.level
+}
+
+/**
+ * Parse profile-id, tier-flag and level-id from the given codec parameters,
+ * missing ones take their default value.
+ *
+ * @param {Object} [params={}] - Codec parameters object.
+ *
+ * @returns {H265ProfileTierLevel} nil if any of them is invalid.
+ */
+func ParseSdpH265ProfileTierLevel(params map[string]interface{}) *H265ProfileTierLevel {
+	profile_tier_level := DefaultH265ProfileTierLevel
+
+	if profile, ok, valid := h265Param(params, "profile-id"); !valid {
+		return nil
+	} else if ok {
+		if profile < H265ProfileMain || profile > H265ProfileHighThroughputScreenContentCoding {
+			return nil
+		}
+		profile_tier_level.profile = profile
+	}
+
+	if tier, ok, valid := h265Param(params, "tier-flag"); !valid {
+		return nil
+	} else if ok {
+		if tier != H265TierMain && tier != H265TierHigh {
+			return nil
+		}
+		profile_tier_level.tier = tier
+	}
+
+	if level, ok, valid := h265Param(params, "level-id"); !valid {
+		return nil
+	} else if ok {
+		if !isValidH265Level(level) {
+			return nil
+		}
+		profile_tier_level.level = level
+	}
+
+	return &profile_tier_level
+}
+
+/**
+ * Parse tx-mode from the given codec parameters.
+ *
+ * @param {Object} [params={}] - Codec parameters object.
+ *
+ * @returns {String} empty if it is invalid.
+ */
+func ParseSdpH265TxMode(params map[string]interface{}) string {
+	value, ok := params["tx-mode"]
+	if !ok || value == nil || value == "" {
+		return H265DefaultTxMode
+	}
+
+	switch tx_mode, _ := value.(string); tx_mode {
+	case "SRST", "MRST", "MRMT":
+		return tx_mode
+	}
+
+	return ""
+}
+
+/**
+ * Returns true if the parameters have the same H265 profile and tier.
+ *
+ * @param {Object} [params1={}] - Codec parameters object.
+ * @param {Object} [params2={}] - Codec parameters object.
+ *
+ * @returns {Boolean}
+ */
+func IsSameH265Profile(params1 map[string]interface{}, params2 map[string]interface{}) bool {
+	profile_tier_level_1 := ParseSdpH265ProfileTierLevel(params1)
+	profile_tier_level_2 := ParseSdpH265ProfileTierLevel(params2)
+
+	// Compare H265 profiles and tiers, but not levels.
+	return profile_tier_level_1 != nil && profile_tier_level_2 != nil &&
+		profile_tier_level_1.profile == profile_tier_level_2.profile &&
+		profile_tier_level_1.tier == profile_tier_level_2.tier
+}
+
+/**
+ * Returns true if the parameters have the same, valid, tx-mode.
+ *
+ * @param {Object} [params1={}] - Codec parameters object.
+ * @param {Object} [params2={}] - Codec parameters object.
+ *
+ * @returns {Boolean}
+ */
+func IsSameH265TxMode(params1 map[string]interface{}, params2 map[string]interface{}) bool {
+	tx_mode_1 := ParseSdpH265TxMode(params1)
+
+	return len(tx_mode_1) > 0 && tx_mode_1 == ParseSdpH265TxMode(params2)
+}
+
+func isValidH265Level(level int) bool {
+	switch level {
+	case H265Level1, H265Level2, H265Level2_1, H265Level3, H265Level3_1,
+		H265Level4, H265Level4_1, H265Level5, H265Level5_1, H265Level5_2,
+		H265Level6, H265Level6_1, H265Level6_2:
+		return true
+	}
+
+	return false
+}
+
+// h265Param reads an integer parameter, ok is false when it is not present and
+// valid is false when it is not an integer.
+func h265Param(params map[string]interface{}, key string) (value int, ok bool, valid bool) {
+	raw, ok := params[key]
+	if !ok || raw == nil {
+		return 0, false, true
+	}
+
+	switch v := raw.(type) {
+	case int:
+		return v, true, true
+	case float64:
+		return int(v), true, float64(int(v)) == v
+	case string:
+		i, err := strconv.Atoi(v)
+		return i, true, err == nil
+	}
+
+	return 0, true, false
+}
@@ -0,0 +1,73 @@
+package libs
+
+import "testing"
+
+func TestParsingSdpH265ProfileTierLevelEmpty(t *testing.T) {
+	profile_tier_level := ParseSdpH265ProfileTierLevel(map[string]interface{}{})
+	if profile_tier_level == nil || *profile_tier_level != DefaultH265ProfileTierLevel {
+		t.Errorf("ParseSdpH265ProfileTierLevel({}) = %+v, want %+v", profile_tier_level, DefaultH265ProfileTierLevel)
+	}
+}
+
+func TestParsingSdpH265ProfileTierLevel(t *testing.T) {
+	profile_tier_level := ParseSdpH265ProfileTierLevel(map[string]interface{}{
+		"profile-id": 2,
+		"tier-flag":  "1",
+		"level-id":   float64(180),
+	})
+	if profile_tier_level == nil || profile_tier_level.profile != H265ProfileMain10 ||
+		profile_tier_level.tier != H265TierHigh || profile_tier_level.level != H265Level6 {
+		t.Errorf("ParseSdpH265ProfileTierLevel() = %+v, want Main10 high tier level 6", profile_tier_level)
+	}
+}
+
+func TestParsingSdpH265ProfileTierLevelInvalid(t *testing.T) {
+	for _, params := range []map[string]interface{}{
+		{"profile-id": 0},
+		{"profile-id": 12},
+		{"profile-id": "main"},
+		{"tier-flag": 2},
+		{"level-id": 94},
+		{"level-id": 93.5},
+	} {
+		if profile_tier_level := ParseSdpH265ProfileTierLevel(params); profile_tier_level != nil {
+			t.Errorf("ParseSdpH265ProfileTierLevel(%v) = %+v, want nil", params, *profile_tier_level)
+		}
+	}
+}
+
+func TestIsSameH265Profile(t *testing.T) {
+	for _, tc := range []struct {
+		params1 map[string]interface{}
+		params2 map[string]interface{}
+		same    bool
+	}{
+		{map[string]interface{}{}, map[string]interface{}{"profile-id": 1}, true},
+		// Levels are not compared.
+		{map[string]interface{}{"level-id": 93}, map[string]interface{}{"level-id": 156}, true},
+		{map[string]interface{}{"profile-id": 1}, map[string]interface{}{"profile-id": 2}, false},
+		{map[string]interface{}{"tier-flag": 0}, map[string]interface{}{"tier-flag": 1}, false},
+		{map[string]interface{}{"profile-id": 42}, map[string]interface{}{"profile-id": 42}, false},
+	} {
+		if same := IsSameH265Profile(tc.params1, tc.params2); same != tc.same {
+			t.Errorf("IsSameH265Profile(%v, %v) = %t, want %t", tc.params1, tc.params2, same, tc.same)
+		}
+	}
+}
+
+func TestIsSameH265TxMode(t *testing.T) {
+	for _, tc := range []struct {
+		params1 map[string]interface{}
+		params2 map[string]interface{}
+		same    bool
+	}{
+		{map[string]interface{}{}, map[string]interface{}{"tx-mode": "SRST"}, true},
+		{map[string]interface{}{"tx-mode": "MRST"}, map[string]interface{}{"tx-mode": "MRST"}, true},
+		{map[string]interface{}{"tx-mode": "MRST"}, map[string]interface{}{}, false},
+		{map[string]interface{}{"tx-mode": "foo"}, map[string]interface{}{"tx-mode": "foo"}, false},
+	} {
+		if same := IsSameH265TxMode(tc.params1, tc.params2); same != tc.same {
+			t.Errorf("IsSameH265TxMode(%v, %v) = %t, want %t", tc.params1, tc.params2, same, tc.same)
+		}
+	}
+}
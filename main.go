@@ -8,6 +8,8 @@ import (
 	"mediasoup-signal-controller/service"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/cloudwebrtc/go-protoo/logger"
 	"github.com/cloudwebrtc/go-protoo/peer"
@@ -24,24 +26,36 @@ var (
 
 func handleProtooWebSocket(transport *transport.WebSocketTransport, request *http.Request) {
 
+	if g_server.Closing() {
+		logger.Warnf("Refusing connection, shutting down")
+		transport.Close()
+		return
+	}
+
 	vars := request.URL.Query()
 	peerId := vars["peerId"][0]
 	roomId := vars["roomId"][0]
 
 	if len(peerId) == 0 || len(roomId) == 0 {
 		logger.Errorf("Connection request without roomId and/or peerId")
+		transport.Close()
 		return
 	}
 
-	room := g_server.GetOrCreateRoom(roomId)
-	if room == nil {
-		logger.Errorf("room create faild from Room:%s", roomId)
-		return
+	// The room may close with its last peer before this one joins it, a new
+	// room is created then.
+	var room *service.Room
+	var pr *peer.Peer
+	for attempt := 0; attempt < service.JoinAttempts && pr == nil; attempt++ {
+		room = g_server.GetOrCreateRoom(roomId)
+		if room == nil {
+			break
+		}
+		pr = room.CreatePeer(peerId, transport)
 	}
-
-	pr := room.CreatePeer(peerId, transport)
 	if pr == nil {
 		logger.Errorf("peer create faild from Room:%s", roomId)
+		transport.Close()
 		return
 	}
 
@@ -109,6 +123,34 @@ func main() {
 		panic(err)
 	}
 
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT, syscall.SIGUSR1)
+
+		for sig := range signals {
+			if sig == syscall.SIGUSR1 {
+				logger.Infof("%s received, draining", sig)
+				g_server.Drain(g_server.DrainTimeout())
+				continue
+			}
+
+			logger.Infof("%s received, shutting down", sig)
+			go g_server.Shutdown(service.WorkerCloseTimeout)
+		}
+	}()
+
+	go func() {
+		<-g_server.Done()
+		os.Exit(0)
+	}()
+
+	if g_config.Admin.ListenPort > 0 {
+		service.CreateNewAdminServer(g_server).Run(g_config.Admin.ListenIp, g_config.Admin.ListenPort)
+	}
+
+	http.Handle("/whip/", service.CreateNewWhipServer(g_server).Handler())
+	http.Handle("/whep/", service.CreateNewWhepServer(g_server).Handler())
+
 	config := server.DefaultConfig()
 	config.Port = 4443
 	config.CertFile = "./certs/cert.pem"
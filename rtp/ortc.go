@@ -2,9 +2,11 @@ package rtp
 
 import (
 	"fmt"
+	"math"
 	"mediasoup-signal-controller/conf"
 	libs "mediasoup-signal-controller/lib"
 	"mediasoup-signal-controller/utils"
+	"regexp"
 	"strings"
 
 	"github.com/cloudwebrtc/go-protoo/logger"
@@ -37,7 +39,7 @@ type RtpCodecParameters struct {
 	 * as 'packetization-mode' and 'profile-level-id' in H264 or 'profile-id' in
 	 * VP9) are critical for codec matching.
 	 */
-	Parameters RTPHeaderParameter `json:"parameters"`
+	Parameters ParameterMap `json:"parameters"`
 
 	/**
 	 * Transport layer and codec-specific feedback messages for this codec.
@@ -45,6 +47,20 @@ type RtpCodecParameters struct {
 	RtcpFeedback []RtcpFeedback `json:"rtcpFeedback"`
 }
 
+/**
+ * The codec as a capability, for matching. Parameters are shared with the
+ * codec.
+ */
+func (codec RtpCodecParameters) capability() RtpCodecCapability {
+	return RtpCodecCapability{
+		MimeType:     codec.MimeType,
+		ClockRate:    codec.ClockRate,
+		Channels:     codec.Channels,
+		Parameters:   codec.Parameters,
+		RtcpFeedback: codec.RtcpFeedback,
+	}
+}
+
 /**
  * Provides information on RTCP settings within the RTP parameters.
  *
@@ -104,9 +120,9 @@ type RtpMappingCodec struct {
 }
 
 type RtpMappingEncoding struct {
-	Ssrc            int    `json:"ssrc"`
-	Rid             string `json:"rid"`
-	ScalabilityMode string `json:"scalabilityMode"`
+	Ssrc            int    `json:"ssrc,omitempty"`
+	Rid             string `json:"rid,omitempty"`
+	ScalabilityMode string `json:"scalabilityMode,omitempty"`
 	MappedSsrc      int    `json:"mappedSsrc"`
 }
 
@@ -115,413 +131,837 @@ type RtpMapping struct {
 	Encodings []RtpMappingEncoding `json:"encodings"`
 }
 
-func validateRtpCapabilities(mediaCodecs conf.RouterOptions_t) {
-	for _, value := range mediaCodecs.MediaCodecs {
-		validateRtpCodecCapability(value)
+/**
+ * Validates the router media codecs given in the config, each of them must
+ * match a supported codec. The error names the offending mediaCodecs entry.
+ */
+func ValidateRtpCapabilities(mediaCodecs conf.RouterOptions_t) error {
+	if len(mediaCodecs.MediaCodecs) == 0 {
+		return fmt.Errorf("mediaCodecs is empty")
 	}
-}
 
-func validateRtpCodecCapability(codec conf.MediaCodec_t) bool {
+	payloadTypes := make(map[int]int)
+	for i, codec := range mediaCodecs.MediaCodecs {
+		if err := validateRtpCodecCapability(codec); err != nil {
+			return fmt.Errorf("mediaCodecs[%d] (%s): %s", i, codec.MimeType, err.Error())
+		}
 
-	return true
-}
+		if codec.PreferredPayloadType > 0 {
+			if j, ok := payloadTypes[codec.PreferredPayloadType]; ok {
+				return fmt.Errorf("mediaCodecs[%d] (%s): preferredPayloadType %d already used by mediaCodecs[%d]",
+					i, codec.MimeType, codec.PreferredPayloadType, j)
+			}
+			payloadTypes[codec.PreferredPayloadType] = i
+		}
+	}
 
-func GenerateRouterRtpCapabilities(mediaCodecs conf.RouterOptions_t) *RtpCapabilities {
+	// Payload types are allocated for the codecs and their RTX.
+	if _, err := generateRouterRtpCapabilities(mediaCodecs); err != nil {
+		return err
+	}
 
-	logger.Debugf("=========GenerateRouterRtpCapabilities: config codec:%+v", mediaCodecs)
+	return nil
+}
 
-	rtpcap := &RtpCapabilities{}
-	//rtpcap.Codecs = make([]RtpCodecCapability, 0)
-	rtpcap.Codecs = make([]interface{}, 0)
+func validateRtpCodecCapability(codec conf.MediaCodec_t) error {
+	mimeType := strings.ToLower(codec.MimeType)
 
-	DynamicPayloadTypes := []int{
-		100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110,
-		111, 112, 113, 114, 115, 116, 117, 118, 119, 120, 121,
-		122, 123, 124, 125, 126, 127, 96, 97, 98, 99,
+	parts := strings.SplitN(mimeType, "/", 2)
+	if len(parts) != 2 || len(parts[1]) == 0 || (parts[0] != "audio" && parts[0] != "video") {
+		return fmt.Errorf("invalid mimeType %q", codec.MimeType)
 	}
 
-	clonedSupportedRtpCapabilities := SupportedRtpCapabilities()
+	if codec.Kind != parts[0] {
+		return fmt.Errorf("kind %q does not match mimeType", codec.Kind)
+	}
 
-	rtpcap.HeaderExtensions = clonedSupportedRtpCapabilities.HeaderExtensions
+	if isRtxCodec(mimeType) {
+		return fmt.Errorf("RTX codecs are added by the router, remove it")
+	}
 
-	for _, mediaCodec := range mediaCodecs.MediaCodecs {
+	if codec.ClockRate <= 0 {
+		return fmt.Errorf("missing or invalid clockRate %d", codec.ClockRate)
+	}
 
-		for _, clonedCodec := range clonedSupportedRtpCapabilities.Codecs {
+	if codec.Kind == "video" && codec.Channels != 0 {
+		return fmt.Errorf("channels is only valid for audio")
+	}
+	if codec.Channels < 0 {
+		return fmt.Errorf("invalid channels %d", codec.Channels)
+	}
 
-			supportedCodec, _ := clonedCodec.(RtpCodecCapability)
-			if matchCodecs(mediaCodec, supportedCodec, false, false) {
+	if codec.PreferredPayloadType < 0 || codec.PreferredPayloadType > 127 {
+		return fmt.Errorf("invalid preferredPayloadType %d", codec.PreferredPayloadType)
+	}
 
-				// Clone the supported codec.
-				codec := supportedCodec
+	capability := mediaCodecCapability(codec)
+	parameters := capability.Parameters
 
-				// If the given media codec has preferredPayloadType, keep it.
-				if mediaCodec.PreferredPayloadType > 0 {
-					codec.PreferredPayloadType = mediaCodec.PreferredPayloadType
-				} else if codec.PreferredPayloadType > 0 {
-					// No need to remove it from the list since it's not a dynamic value.
-				} else {
-					codec.PreferredPayloadType = DynamicPayloadTypes[0]
-					DynamicPayloadTypes = utils.DeleteItemByIndexInArray(DynamicPayloadTypes, 0)
-				}
-				logger.Debugf("GenerateRouterRtpCapabilities configCodec:%+v, routerCodec:%+v", mediaCodec, codec)
+	// The router sets the RTX apt itself.
+	if parameters.Has("apt") {
+		return fmt.Errorf("apt parameter is not allowed")
+	}
 
-				duplicated := false
-				for _, v := range rtpcap.Codecs {
+	for _, fb := range capability.RtcpFeedback {
+		if len(fb.FeedbackType) == 0 {
+			return fmt.Errorf("rtcpFeedback without type")
+		}
+	}
 
-					rtpCodec, ok1 := v.(RtpCodecCapability)
-					rtxCodec, ok2 := v.(RtxCodecCapability)
+	consumerParameters := capability.ConsumerParameters
+	if len(consumerParameters) > 0 && codec.Kind != "audio" {
+		return fmt.Errorf("consumerParameters is only valid for audio")
+	}
+	for key, value := range consumerParameters {
+		switch value.(type) {
+		case int, float64, string:
+		default:
+			return fmt.Errorf("invalid consumer parameter %s", key)
+		}
+	}
 
-					if ok1 {
-						if rtpCodec.PreferredPayloadType == codec.PreferredPayloadType {
-							duplicated = true
-						}
-					}
+	// Per codec special checks, on parameters critical for matching or
+	// signaled to consumers.
+	switch mimeType {
+	case "audio/opus":
+		if err := checkOpusParameters(parameters); err != nil {
+			return err
+		}
 
-					if ok2 {
-						if rtxCodec.PreferredPayloadType == codec.PreferredPayloadType {
-							duplicated = true
-						}
-					}
-				}
+		if err := checkOpusParameters(consumerParameters); err != nil {
+			return fmt.Errorf("consumerParameters: %s", err.Error())
+		}
+	case "video/h264":
+		// Older configs spelled these with underscores, which matches nothing.
+		for _, key := range []string{"packetization-mode", "level-asymmetry-allowed"} {
+			if legacyKey := strings.Replace(key, "-", "_", -1); parameters.Has(legacyKey) {
+				return fmt.Errorf("parameter %s is no longer supported, use %s", legacyKey, key)
+			}
+		}
 
-				if duplicated {
-					logger.Errorf("======================GenerateRouterRtpCapabilities duplicated PreferredPayloadType:%s===============", codec.PreferredPayloadType)
-					continue
-				}
+		if err := checkIntegerParameter(parameters, "packetization-mode", 0, 1); err != nil {
+			return err
+		}
 
-				// Merge the media codec parameters.
-				//...
-
-				logger.Debugf("===============GenerateRouterRtpCapabilities add rtc:%+v==================", codec)
-				rtpcap.Codecs = append(rtpcap.Codecs, codec)
-
-				// Add a RTX video codec if video.
-				if codec.Kind == "video" {
-
-					pt := DynamicPayloadTypes[0]
-					DynamicPayloadTypes = utils.DeleteItemByIndexInArray(DynamicPayloadTypes, 0)
-					rtxCodec := RtxCodecCapability{
-						Kind:                 codec.Kind,
-						MimeType:             fmt.Sprintf("%s/rtx", codec.Kind),
-						PreferredPayloadType: pt,
-						ClockRate:            codec.ClockRate,
-						Parameters: RTPHeaderParameter{
-							Apt: codec.PreferredPayloadType,
-						},
-					}
-					logger.Debugf("===============GenerateRouterRtpCapabilities add rtx:%+v==================", rtxCodec)
-					rtpcap.Codecs = append(rtpcap.Codecs, rtxCodec)
-				}
+		if err := checkIntegerParameter(parameters, "level-asymmetry-allowed", 0, 1); err != nil {
+			return err
+		}
+
+		if parameters.Has("profile-level-id") {
+			profileLevelId, ok := parameters["profile-level-id"].(string)
+			if !ok || libs.ParseProfileLevelId(profileLevelId) == nil {
+				return fmt.Errorf("invalid profile-level-id %v", parameters["profile-level-id"])
 			}
 		}
+	case "video/vp9":
+		if err := checkIntegerParameter(parameters, "profile-id", 0, 3); err != nil {
+			return err
+		}
+	case "video/av1":
+		if err := checkIntegerParameter(parameters, "profile", 0, 2); err != nil {
+			return err
+		}
+
+		if err := checkIntegerParameter(parameters, "level-idx", 0, 31); err != nil {
+			return err
+		}
+
+		if err := checkIntegerParameter(parameters, "tier", 0, 1); err != nil {
+			return err
+		}
+	case "video/h265":
+		if libs.ParseSdpH265ProfileTierLevel(parameters) == nil {
+			return fmt.Errorf("invalid profile-id %v, tier-flag %v or level-id %v",
+				parameters["profile-id"], parameters["tier-flag"], parameters["level-id"])
+		}
+
+		if len(libs.ParseSdpH265TxMode(parameters)) == 0 {
+			return fmt.Errorf("invalid tx-mode %v", parameters["tx-mode"])
+		}
 	}
 
-	return rtpcap
+	for _, capCodec := range SupportedRtpCapabilities().Codecs {
+		if matchCodecs(capability, capCodec, false, false) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unsupported codec with clockRate %d and channels %d", codec.ClockRate, codec.Channels)
+}
+
+/**
+ * A parameter, if given, must be an integer within [min, max].
+ */
+func checkIntegerParameter(parameters ParameterMap, key string, min int, max int) error {
+	if !parameters.Has(key) {
+		return nil
+	}
+
+	value, ok := parameters[key].(int)
+	if !ok || value < min || value > max {
+		return fmt.Errorf("invalid %s %v", key, parameters[key])
+	}
+
+	return nil
 }
 
-func GetProducerRtpParametersMapping(clientParams *ClientRtpParameters, routerCaps *RtpCapabilities) *RtpMapping {
+/**
+ * Opus parameters (RFC 7587), if given, must be within their range.
+ */
+func checkOpusParameters(parameters ParameterMap) error {
+	for _, key := range []string{"useinbandfec", "usedtx", "stereo", "sprop-stereo", "cbr"} {
+		if err := checkIntegerParameter(parameters, key, 0, 1); err != nil {
+			return err
+		}
+	}
 
-	type CodecPair struct {
-		//codec    *RtpCodecParameters
-		//capCodec *RtpCodecCapability
-		codeci    int
-		capCodeci int
+	for _, key := range []string{"maxplaybackrate", "sprop-maxcapturerate"} {
+		if err := checkIntegerParameter(parameters, key, 8000, 48000); err != nil {
+			return err
+		}
 	}
-	rtpMapping := &RtpMapping{}
-	rtpMapping.Codecs = make([]RtpMappingCodec, 0)
-	rtpMapping.Encodings = make([]RtpMappingEncoding, 0)
 
-	codecToCapCodec := make([]CodecPair, 0)
+	if err := checkIntegerParameter(parameters, "maxaveragebitrate", 6000, 510000); err != nil {
+		return err
+	}
 
-	for i, codec := range clientParams.Codecs {
+	for _, key := range []string{"ptime", "minptime", "maxptime"} {
+		if err := checkIntegerParameter(parameters, key, 3, 120); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+/**
+ * The capability described by a configured media codec. Integral numbers of
+ * the parameters are kept as int, as in parameters received from endpoints.
+ */
+func mediaCodecCapability(mediaCodec conf.MediaCodec_t) RtpCodecCapability {
+	var rtcpFeedback []RtcpFeedback
+	if mediaCodec.RtcpFeedback != nil {
+		rtcpFeedback = make([]RtcpFeedback, 0, len(mediaCodec.RtcpFeedback))
+		for _, fb := range mediaCodec.RtcpFeedback {
+			rtcpFeedback = append(rtcpFeedback, RtcpFeedback{
+				FeedbackType: fb.Type,
+				Parameter:    fb.Parameter,
+			})
+		}
+	}
+
+	return RtpCodecCapability{
+		Kind:                 mediaCodec.Kind,
+		MimeType:             mediaCodec.MimeType,
+		PreferredPayloadType: mediaCodec.PreferredPayloadType,
+		ClockRate:            mediaCodec.ClockRate,
+		Channels:             mediaCodec.Channels,
+		Parameters:           configParameters(mediaCodec.Parameters),
+		RtcpFeedback:         rtcpFeedback,
+		ConsumerParameters:   configParameters(mediaCodec.ConsumerParameters),
+	}
+}
+
+func configParameters(values map[string]interface{}) ParameterMap {
+	parameters := make(ParameterMap, len(values))
+	for key, value := range values {
+		if f, ok := value.(float64); ok && f == float64(int(f)) {
+			value = int(f)
+		}
+		parameters[key] = value
+	}
+
+	return parameters
+}
+
+var ridRegex = regexp.MustCompile(`^[A-Za-z0-9_-]{1,255}$`)
+
+// Parsing a scalabilityMode ignores what follows its layers, validating it does
+// not.
+var validScalabilityModeRegex = regexp.MustCompile(scalabilityModeRegex.String() + `$`)
+
+/**
+ * Validates the RTP parameters sent by an endpoint for a Producer of the given
+ * kind. The error names the offending entry.
+ */
+func ValidateRtpParameters(kind string, params *ClientRtpParameters) error {
+	if kind != "audio" && kind != "video" {
+		return fmt.Errorf("invalid kind %q", kind)
+	}
+
+	if len(params.Mid) > 0 && !isToken(params.Mid) {
+		return fmt.Errorf("invalid mid %q", params.Mid)
+	}
+
+	if len(params.Codecs) == 0 {
+		return fmt.Errorf("missing codecs")
+	}
+
+	payloadTypes := make(map[int]int)
+	for i, codec := range params.Codecs {
+		if err := validateRtpCodecParameters(kind, codec); err != nil {
+			return fmt.Errorf("codecs[%d] (%s): %s", i, codec.MimeType, err.Error())
+		}
+
+		if j, ok := payloadTypes[codec.PayloadType]; ok {
+			return fmt.Errorf("codecs[%d] (%s): payloadType %d already used by codecs[%d]",
+				i, codec.MimeType, codec.PayloadType, j)
+		}
+		payloadTypes[codec.PayloadType] = i
+	}
+
+	if isRtxCodec(params.Codecs[0].MimeType) {
+		return fmt.Errorf("codecs[0] (%s): first codec must be a media codec", params.Codecs[0].MimeType)
+	}
+
+	// RTX codecs must be associated with a media codec.
+	for i, codec := range params.Codecs {
 		if !isRtxCodec(codec.MimeType) {
-			match := false
-			for j, capCodec := range routerCaps.Codecs {
-				if matchCodecs(codec, capCodec, true, true) {
-					codecToCapCodec = append(codecToCapCodec, CodecPair{
-						codeci:    i,
-						capCodeci: j,
-					})
-					logger.Debugf("========GetProducerRtpParametersMapping match client codec:%+v, router codec:%+v", codec, capCodec)
-
-					match = true
-				}
-			}
+			continue
+		}
 
-			if !match {
-				logger.Errorf("unsupported codec [mimeType:%s, payloadType:%d]",
-					codec.MimeType, codec.PayloadType)
-			}
+		apt, ok := codec.Parameters["apt"].(int)
+		if j, found := payloadTypes[apt]; !ok || !found || isRtxCodec(params.Codecs[j].MimeType) {
+			return fmt.Errorf("codecs[%d] (%s): apt %v is not the payloadType of a media codec",
+				i, codec.MimeType, codec.Parameters["apt"])
 		}
 	}
 
-	for _, codec := range clientParams.Codecs {
+	ids := make(map[int]int)
+	for i, ext := range params.HeaderExtensions {
+		if len(ext.Uri) == 0 {
+			return fmt.Errorf("headerExtensions[%d]: missing uri", i)
+		}
 
-		if isRtxCodec(codec.MimeType) {
+		if ext.Id < 1 || ext.Id > 255 {
+			return fmt.Errorf("headerExtensions[%d] (%s): invalid id %d", i, ext.Uri, ext.Id)
+		}
 
-			match := false
-			for associatedMediaCodeci, mediaCodec := range clientParams.Codecs {
-				if mediaCodec.PayloadType == codec.Parameters.Apt {
-					match = true
+		if j, ok := ids[ext.Id]; ok {
+			return fmt.Errorf("headerExtensions[%d] (%s): id %d already used by headerExtensions[%d]", i, ext.Uri, ext.Id, j)
+		}
+		ids[ext.Id] = i
+	}
 
-					routerCodeci := -1
-					for _, pair := range codecToCapCodec {
-						if pair.codeci == associatedMediaCodeci {
-							routerCodeci = pair.capCodeci
-						}
-					}
+	if len(params.Encodings) == 0 {
+		return fmt.Errorf("missing encodings")
+	}
 
-					if routerCodeci >= 0 {
-						for j, capCodec := range routerCaps.Codecs {
+	ssrcs := make(map[int]int)
+	rids := make(map[string]int)
+	for i, encoding := range params.Encodings {
+		if encoding.Ssrc < 0 || int64(encoding.Ssrc) > math.MaxUint32 {
+			return fmt.Errorf("encodings[%d]: invalid ssrc %d", i, encoding.Ssrc)
+		}
 
-							capRtpCodec, ok1 := capCodec.(RtpCodecCapability)
-							routerCapRtpCodec, ok2 := routerCaps.Codecs[routerCodeci].(RtpCodecCapability)
-							routerCapRtxCodec, ok3 := routerCaps.Codecs[routerCodeci].(RtxCodecCapability)
+		if encoding.Ssrc > 0 {
+			if j, ok := ssrcs[encoding.Ssrc]; ok {
+				return fmt.Errorf("encodings[%d]: ssrc %d already used by encodings[%d]", i, encoding.Ssrc, j)
+			}
+			ssrcs[encoding.Ssrc] = i
+		}
 
-							if ok1 && ok2 && isRtxCodec(capRtpCodec.MimeType) && capRtpCodec.Parameters.Apt == routerCapRtpCodec.PreferredPayloadType {
+		if encoding.RtxSsrc != nil {
+			if encoding.RtxSsrc.Ssrc <= 0 || int64(encoding.RtxSsrc.Ssrc) > math.MaxUint32 {
+				return fmt.Errorf("encodings[%d]: invalid rtx ssrc %d", i, encoding.RtxSsrc.Ssrc)
+			}
 
-								codecToCapCodec = append(codecToCapCodec, CodecPair{
-									codeci:    associatedMediaCodeci,
-									capCodeci: j,
-								})
-							} else if ok1 && ok3 && isRtxCodec(capRtpCodec.MimeType) && capRtpCodec.Parameters.Apt == routerCapRtxCodec.PreferredPayloadType {
+			if j, ok := ssrcs[encoding.RtxSsrc.Ssrc]; ok {
+				return fmt.Errorf("encodings[%d]: rtx ssrc %d already used by encodings[%d]", i, encoding.RtxSsrc.Ssrc, j)
+			}
+			ssrcs[encoding.RtxSsrc.Ssrc] = i
+		}
 
-								codecToCapCodec = append(codecToCapCodec, CodecPair{
-									codeci:    associatedMediaCodeci,
-									capCodeci: j,
-								})
-							}
-						}
-					}
-				}
+		if len(encoding.Rid) > 0 {
+			if !ridRegex.MatchString(encoding.Rid) {
+				return fmt.Errorf("encodings[%d]: invalid rid %q", i, encoding.Rid)
 			}
 
-			if !match {
-				logger.Errorf("missing media codec found for RTX PT [payloadType:%d]", codec.PayloadType)
+			if j, ok := rids[encoding.Rid]; ok {
+				return fmt.Errorf("encodings[%d]: rid %q already used by encodings[%d]", i, encoding.Rid, j)
 			}
+			rids[encoding.Rid] = i
 		}
-	}
 
-	for _, codecPair := range codecToCapCodec {
+		// A single stream may be told apart by mid alone.
+		if encoding.Ssrc == 0 && len(encoding.Rid) == 0 && (len(params.Encodings) > 1 || len(params.Mid) == 0) {
+			return fmt.Errorf("encodings[%d]: missing ssrc or rid", i)
+		}
 
-		routerCapRtpCodec, ok1 := routerCaps.Codecs[codecPair.capCodeci].(RtpCodecCapability)
-		routerCapRtxCodec, ok2 := routerCaps.Codecs[codecPair.capCodeci].(RtxCodecCapability)
+		if encoding.CodecPayloadType != 0 {
+			if j, ok := payloadTypes[encoding.CodecPayloadType]; !ok || isRtxCodec(params.Codecs[j].MimeType) {
+				return fmt.Errorf("encodings[%d]: codecPayloadType %d is not the payloadType of a media codec",
+					i, encoding.CodecPayloadType)
+			}
+		}
 
-		if ok1 {
-			rtpMapping.Codecs = append(rtpMapping.Codecs, RtpMappingCodec{
-				PayloadType:       clientParams.Codecs[codecPair.codeci].PayloadType,
-				MappedPayloadType: routerCapRtpCodec.PreferredPayloadType,
-			})
+		if len(encoding.ScalabilityMode) > 0 && !validScalabilityModeRegex.MatchString(encoding.ScalabilityMode) {
+			return fmt.Errorf("encodings[%d]: invalid scalabilityMode %q", i, encoding.ScalabilityMode)
 		}
 
-		if ok2 {
-			rtpMapping.Codecs = append(rtpMapping.Codecs, RtpMappingCodec{
-				PayloadType:       clientParams.Codecs[codecPair.codeci].PayloadType,
-				MappedPayloadType: routerCapRtxCodec.PreferredPayloadType,
-			})
+		if encoding.MaxBitrate < 0 {
+			return fmt.Errorf("encodings[%d]: invalid maxBitrate %d", i, encoding.MaxBitrate)
 		}
 
+		if encoding.ScaleResolutionDownBy != 0 && encoding.ScaleResolutionDownBy < 1 {
+			return fmt.Errorf("encodings[%d]: invalid scaleResolutionDownBy %v", i, encoding.ScaleResolutionDownBy)
+		}
 	}
 
-	mappedSsrc := utils.RandomNumberGenerator(100000000, 999999999)
-	for _, encoding := range clientParams.Encodings {
-		rtpMappingEncoding := RtpMappingEncoding{
-			MappedSsrc:      mappedSsrc,
-			Rid:             encoding.Rid,
-			Ssrc:            encoding.Ssrc,
-			ScalabilityMode: encoding.ScalabilityMode,
+	return nil
+}
+
+func validateRtpCodecParameters(kind string, codec RtpCodecParameters) error {
+	parts := strings.SplitN(strings.ToLower(codec.MimeType), "/", 2)
+	if len(parts) != 2 || len(parts[1]) == 0 || (parts[0] != "audio" && parts[0] != "video") {
+		return fmt.Errorf("invalid mimeType")
+	}
+
+	if parts[0] != kind {
+		return fmt.Errorf("mimeType does not match kind %q", kind)
+	}
+
+	if codec.PayloadType < 0 || codec.PayloadType > 127 {
+		return fmt.Errorf("invalid payloadType %d", codec.PayloadType)
+	}
+
+	if codec.ClockRate <= 0 {
+		return fmt.Errorf("missing or invalid clockRate %d", codec.ClockRate)
+	}
+
+	if kind == "video" && codec.Channels != 0 {
+		return fmt.Errorf("channels is only valid for audio")
+	}
+	if codec.Channels < 0 {
+		return fmt.Errorf("invalid channels %d", codec.Channels)
+	}
+
+	for key, value := range codec.Parameters {
+		switch value.(type) {
+		case int, float64, string:
+		default:
+			return fmt.Errorf("invalid parameter %s", key)
+		}
+	}
+
+	for _, fb := range codec.RtcpFeedback {
+		if len(fb.FeedbackType) == 0 {
+			return fmt.Errorf("rtcpFeedback without type")
 		}
+	}
 
-		rtpMapping.Encodings = append(rtpMapping.Encodings, rtpMappingEncoding)
-		mappedSsrc++
+	if strings.ToLower(codec.MimeType) == "audio/opus" {
+		if err := checkOpusParameters(codec.Parameters); err != nil {
+			return err
+		}
 	}
-	return rtpMapping
+
+	return nil
 }
 
-func isRtxCodec(mimeType string) bool {
-	if strings.Contains(mimeType, "rtx") {
-		return true
+/**
+ * Whether value is a token (RFC 4566), as a mid must be.
+ */
+func isToken(value string) bool {
+	for _, c := range value {
+		if c < 0x21 || c > 0x7e || strings.ContainsRune("\"(),/:;<=>?@[\\]", c) {
+			return false
+		}
 	}
 
-	return false
+	return true
 }
 
-func matchCodecs(aCodec interface{}, bCodec interface{}, strict bool, modify bool) bool {
+/**
+ * Generate the RTP capabilities of a router with the given media codecs, which
+ * should have passed ValidateRtpCapabilities.
+ */
+func GenerateRouterRtpCapabilities(mediaCodecs conf.RouterOptions_t) *RtpCapabilities {
 
-	// var p *RtpCodecCapability
-	// //var pp *RtpCodecParameters
-	// var q *RtpCodecCapability
-	// //var qp *RtpCodecParameters
+	logger.Debugf("GenerateRouterRtpCapabilities: config codec:%+v", mediaCodecs)
 
-	// p, ok := aCodec.(*RtpCodecCapability)
-	// if !ok {
-	// 	//pp, _ = aCodec.(*RtpCodecParameters)
-	// }
+	rtpcap, err := generateRouterRtpCapabilities(mediaCodecs)
+	if err != nil {
+		logger.Errorf("GenerateRouterRtpCapabilities: %s", err.Error())
+	}
 
-	// q, ok = bCodec.(*RtpCodecCapability)
-	// if !ok {
-	// 	//qp, _ = bCodec.(*RtpCodecParameters)
-	// }
+	return rtpcap
+}
 
-	var p RtpCodecParameters
-	var q RtpCodecCapability
-	p, ok1 := aCodec.(RtpCodecParameters)
-	q, ok2 := bCodec.(RtpCodecCapability)
+// matchingParameters are the parameters telling apart codecs of the same MIME
+// type, see matchCodecs.
+var matchingParameters = map[string][]string{
+	"video/h264": {"packetization-mode", "profile-level-id"},
+	"video/vp9":  {"profile-id"},
+	"video/av1":  {"profile"},
+	"video/h265": {"profile-id", "tier-flag", "tx-mode"},
+}
 
-	if ok1 && ok2 {
-		aMimeType := strings.ToLower(p.MimeType)
-		bMimeType := strings.ToLower(q.MimeType)
+// checkMatchingParameters fails when a configured codec changes a matching
+// parameter of the supported codec it is merged into, or when codec, merged,
+// cannot be told apart from a router codec already added.
+func checkMatchingParameters(capability RtpCodecCapability, supportedCodec RtpCodecCapability, codec RtpCodecCapability, routerCodecs []RtpCodecCapability) error {
+	keys := matchingParameters[strings.ToLower(codec.MimeType)]
+	if len(keys) == 0 {
+		return nil
+	}
 
-		if aMimeType != bMimeType {
-			return false
+	for _, key := range keys {
+		if supportedCodec.Parameters.Has(key) && capability.Parameters.Has(key) &&
+			supportedCodec.Parameters.String(key) != capability.Parameters.String(key) {
+			return fmt.Errorf("%s %v conflicts with %v of the supported codec",
+				key, capability.Parameters[key], supportedCodec.Parameters[key])
 		}
+	}
 
-		if p.ClockRate != q.ClockRate {
-			return false
+	for _, routerCodec := range routerCodecs {
+		if routerCodec.MimeType != codec.MimeType {
+			continue
 		}
-
-		if p.Channels != q.Channels {
-			return false
+		same := true
+		for _, key := range keys {
+			if routerCodec.Parameters.String(key) != codec.Parameters.String(key) {
+				same = false
+				break
+			}
 		}
+		if same {
+			return fmt.Errorf("same %s as the codec with preferredPayloadType %d",
+				strings.Join(keys, ", "), routerCodec.PreferredPayloadType)
+		}
+	}
 
-		// Per codec special checks.
-		switch aMimeType {
-		case "video/h264":
-			{
-				aPacketizationMode := p.Parameters.Packetization_mode
-				bPacketizationMode := q.Parameters.Packetization_mode
+	return nil
+}
 
-				if aPacketizationMode != bPacketizationMode {
-					return false
-				}
+func generateRouterRtpCapabilities(mediaCodecs conf.RouterOptions_t) (*RtpCapabilities, error) {
+	rtpcap := &RtpCapabilities{}
+	rtpcap.Codecs = make([]RtpCodecCapability, 0)
 
-				// If strict matching check profile-level-id.
-				if strict {
-					logger.Debugf("=============IsSameProfile:a:%+v=========b:%+v==========", p.Parameters, q.Parameters)
-					if len(p.Parameters.Profile_level_id) > 0 && len(q.Parameters.Profile_level_id) > 0 && !libs.IsSameProfile(p.Parameters.Profile_level_id, q.Parameters.Profile_level_id) {
-						return false
-					}
+	DynamicPayloadTypes := []int{
+		100, 101, 102, 103, 104, 105, 106, 107, 108, 109, 110,
+		111, 112, 113, 114, 115, 116, 117, 118, 119, 120, 121,
+		122, 123, 124, 125, 126, 127, 96, 97, 98, 99,
+	}
 
-					var selectedProfileLevelId string
+	clonedSupportedRtpCapabilities := SupportedRtpCapabilities()
 
-					selectedProfileLevelId, ok := libs.GenerateProfileLevelIdForAnswer(p.Parameters.Profile_level_id, q.Parameters.Profile_level_id)
-					if !ok {
-						logger.Errorf("No profile for profile")
-						return false
-					}
+	rtpcap.HeaderExtensions = clonedSupportedRtpCapabilities.HeaderExtensions
+
+	for i, mediaCodec := range mediaCodecs.MediaCodecs {
+		capability := mediaCodecCapability(mediaCodec)
 
-					if modify {
+		matched := false
+		for _, supportedCodec := range clonedSupportedRtpCapabilities.Codecs {
 
-						if len(selectedProfileLevelId) > 0 {
-							//p.Parameters.Profile_level_id = selectedProfileLevelId
-						}
+			if !matchCodecs(capability, supportedCodec, false, false) {
+				continue
+			}
+			matched = true
+
+			// Clone the supported codec.
+			codec := supportedCodec
+			codec.Channels = codecChannels(codec)
 
-						// else
-						// 	delete aCodec.parameters['profile-level-id'];
+			// If the given media codec has preferredPayloadType, keep it.
+			if mediaCodec.PreferredPayloadType > 0 {
+				codec.PreferredPayloadType = mediaCodec.PreferredPayloadType
+
+				// Also remove the payload type from the list of available dynamic values.
+				for j, pt := range DynamicPayloadTypes {
+					if pt == codec.PreferredPayloadType {
+						DynamicPayloadTypes = utils.DeleteItemByIndexInArray(DynamicPayloadTypes, j)
+						break
 					}
 				}
+			} else if codec.PreferredPayloadType > 0 {
+				// No need to remove it from the list since it's not a dynamic value.
+			} else {
+				if len(DynamicPayloadTypes) == 0 {
+					return rtpcap, fmt.Errorf("mediaCodecs[%d] (%s): cannot allocate more dynamic codec payload types", i, mediaCodec.MimeType)
+				}
+				codec.PreferredPayloadType = DynamicPayloadTypes[0]
+				DynamicPayloadTypes = utils.DeleteItemByIndexInArray(DynamicPayloadTypes, 0)
+			}
+			logger.Debugf("GenerateRouterRtpCapabilities configCodec:%+v, routerCodec:%+v", mediaCodec, codec)
 
-				break
+			for _, v := range rtpcap.Codecs {
+				if v.PreferredPayloadType == codec.PreferredPayloadType {
+					return rtpcap, fmt.Errorf("mediaCodecs[%d] (%s): duplicated preferredPayloadType %d", i, mediaCodec.MimeType, codec.PreferredPayloadType)
+				}
 			}
 
-		case "video/vp9":
-			{
-				// If strict matching check profile-id.
-				if strict {
-					aProfileId := p.Parameters.Profile_id
-					bProfileId := q.Parameters.Profile_id
+			// Merge the media codec parameters.
+			codec.Parameters = supportedCodec.Parameters.Clone()
+			for key, value := range capability.Parameters {
+				codec.Parameters[key] = value
+			}
 
-					if aProfileId != bProfileId {
-						return false
-					}
+			if err := checkMatchingParameters(capability, supportedCodec, codec, rtpcap.Codecs); err != nil {
+				return rtpcap, fmt.Errorf("mediaCodecs[%d] (%s): %s", i, mediaCodec.MimeType, err.Error())
+			}
+
+			// Use the media codec RTCP feedback if given.
+			if capability.RtcpFeedback != nil {
+				codec.RtcpFeedback = capability.RtcpFeedback
+			}
+
+			if len(capability.ConsumerParameters) > 0 {
+				codec.ConsumerParameters = capability.ConsumerParameters
+			}
+
+			logger.Debugf("GenerateRouterRtpCapabilities add rtc:%+v", codec)
+			rtpcap.Codecs = append(rtpcap.Codecs, codec)
+
+			// Add a RTX video codec if video.
+			if codec.Kind == "video" {
+				if len(DynamicPayloadTypes) == 0 {
+					return rtpcap, fmt.Errorf("mediaCodecs[%d] (%s): cannot allocate more dynamic codec payload types", i, mediaCodec.MimeType)
 				}
 
+				pt := DynamicPayloadTypes[0]
+				DynamicPayloadTypes = utils.DeleteItemByIndexInArray(DynamicPayloadTypes, 0)
+				rtxCodec := RtpCodecCapability{
+					Kind:                 codec.Kind,
+					MimeType:             fmt.Sprintf("%s/rtx", codec.Kind),
+					PreferredPayloadType: pt,
+					ClockRate:            codec.ClockRate,
+					Parameters: ParameterMap{
+						"apt": codec.PreferredPayloadType,
+					},
+					RtcpFeedback: []RtcpFeedback{},
+				}
+				logger.Debugf("GenerateRouterRtpCapabilities add rtx:%+v", rtxCodec)
+				rtpcap.Codecs = append(rtpcap.Codecs, rtxCodec)
+			}
+			break
+		}
+
+		if !matched {
+			return rtpcap, fmt.Errorf("mediaCodecs[%d] (%s): unsupported codec", i, mediaCodec.MimeType)
+		}
+	}
+
+	return rtpcap, nil
+}
+
+/**
+ * Get a mapping of the codec payload types and encodings of the given Producer
+ * RTP parameters as values expected by the Router. It fails when a codec is not
+ * supported by the router.
+ */
+func GetProducerRtpParametersMapping(clientParams *ClientRtpParameters, routerCaps *RtpCapabilities) (*RtpMapping, error) {
+
+	rtpMapping := &RtpMapping{}
+	rtpMapping.Codecs = make([]RtpMappingCodec, 0)
+	rtpMapping.Encodings = make([]RtpMappingEncoding, 0)
+
+	// Index of the matching router codec for each client codec.
+	codecToCapCodec := make(map[int]int)
+
+	for i, codec := range clientParams.Codecs {
+		if isRtxCodec(codec.MimeType) {
+			continue
+		}
+
+		// Matching may set the negotiated profile-level-id.
+		if codec.Parameters == nil {
+			codec.Parameters = ParameterMap{}
+			clientParams.Codecs[i].Parameters = codec.Parameters
+		}
+
+		match := false
+		for j, capCodec := range routerCaps.Codecs {
+			if matchCodecs(codec.capability(), capCodec, true, true) {
+				logger.Debugf("GetProducerRtpParametersMapping match client codec:%+v, router codec:%+v", codec, capCodec)
+
+				codecToCapCodec[i] = j
+				match = true
 				break
 			}
 		}
 
-		return true
-	} else {
-		var p conf.MediaCodec_t
-		var q RtpCodecCapability
-		p, ok1 := aCodec.(conf.MediaCodec_t)
-		q, ok2 := bCodec.(RtpCodecCapability)
+		if !match {
+			return nil, fmt.Errorf("unsupported codec [mimeType:%s, payloadType:%d]",
+				codec.MimeType, codec.PayloadType)
+		}
+	}
 
-		if ok1 && ok2 {
-			aMimeType := strings.ToLower(p.MimeType)
-			bMimeType := strings.ToLower(q.MimeType)
+	for i, codec := range clientParams.Codecs {
+		if !isRtxCodec(codec.MimeType) {
+			continue
+		}
 
-			if aMimeType != bMimeType {
-				return false
+		associatedMediaCodeci := -1
+		for j, mediaCodec := range clientParams.Codecs {
+			if mediaCodec.PayloadType == codec.Parameters.Int("apt") {
+				associatedMediaCodeci = j
+				break
 			}
+		}
 
-			if p.ClockRate != q.ClockRate {
-				return false
+		if associatedMediaCodeci < 0 {
+			return nil, fmt.Errorf("missing media codec found for RTX PT [payloadType:%d]", codec.PayloadType)
+		}
+
+		capMediaCodeci := codecToCapCodec[associatedMediaCodeci]
+
+		match := false
+		for j, capCodec := range routerCaps.Codecs {
+			if isRtxCodec(capCodec.MimeType) && capCodec.Parameters.Int("apt") == routerCaps.Codecs[capMediaCodeci].PreferredPayloadType {
+				codecToCapCodec[i] = j
+				match = true
+				break
 			}
+		}
+
+		if !match {
+			return nil, fmt.Errorf("no RTX codec for capability codec PT [payloadType:%d]", routerCaps.Codecs[capMediaCodeci].PreferredPayloadType)
+		}
+	}
+
+	for i, codec := range clientParams.Codecs {
+		if j, ok := codecToCapCodec[i]; ok {
+			rtpMapping.Codecs = append(rtpMapping.Codecs, RtpMappingCodec{
+				PayloadType:       codec.PayloadType,
+				MappedPayloadType: routerCaps.Codecs[j].PreferredPayloadType,
+			})
+		}
+	}
+
+	mappedSsrc := utils.RandomNumberGenerator(100000000, 999999999)
+	for _, encoding := range clientParams.Encodings {
+		rtpMappingEncoding := RtpMappingEncoding{
+			MappedSsrc:      mappedSsrc,
+			Rid:             encoding.Rid,
+			Ssrc:            encoding.Ssrc,
+			ScalabilityMode: encoding.ScalabilityMode,
+		}
+
+		rtpMapping.Encodings = append(rtpMapping.Encodings, rtpMappingEncoding)
+		mappedSsrc++
+	}
+	return rtpMapping, nil
+}
+
+func isRtxCodec(mimeType string) bool {
+	if strings.Contains(mimeType, "rtx") {
+		return true
+	}
+
+	return false
+}
 
-			if p.Channels != q.Channels {
+// codecChannels is the number of channels of codec, audio codecs not giving
+// one (e.g. "PCMU/8000" in SDP) have a single channel.
+func codecChannels(codec RtpCodecCapability) int {
+	if codec.Channels == 0 && strings.HasPrefix(strings.ToLower(codec.MimeType), "audio/") {
+		return 1
+	}
+
+	return codec.Channels
+}
+
+func matchCodecs(aCodec RtpCodecCapability, bCodec RtpCodecCapability, strict bool, modify bool) bool {
+	aMimeType := strings.ToLower(aCodec.MimeType)
+	bMimeType := strings.ToLower(bCodec.MimeType)
+
+	if aMimeType != bMimeType {
+		return false
+	}
+
+	if aCodec.ClockRate != bCodec.ClockRate {
+		return false
+	}
+
+	if codecChannels(aCodec) != codecChannels(bCodec) {
+		return false
+	}
+
+	// Per codec special checks.
+	switch aMimeType {
+	case "video/h264":
+		{
+			aPacketizationMode := aCodec.Parameters.Int("packetization-mode")
+			bPacketizationMode := bCodec.Parameters.Int("packetization-mode")
+
+			if aPacketizationMode != bPacketizationMode {
 				return false
 			}
 
-			// Per codec special checks.
-			switch aMimeType {
-			case "video/h264":
-				{
-					aPacketizationMode := p.Parameters.Packetization_mode
-					bPacketizationMode := q.Parameters.Packetization_mode
+			// If strict matching check profile-level-id.
+			if strict {
+				if !libs.IsSameProfile(aCodec.Parameters, bCodec.Parameters) {
+					return false
+				}
 
-					if aPacketizationMode != bPacketizationMode {
-						return false
-					}
+				selectedProfileLevelId, err := libs.GenerateProfileLevelIdForAnswer(aCodec.Parameters, bCodec.Parameters)
+				if err != nil {
+					logger.Debugf("matchCodecs() | %s", err.Error())
+					return false
+				}
 
-					// If strict matching check profile-level-id.
-					if strict {
-						if !libs.IsSameProfile(p.Parameters.Profile_level_id, q.Parameters.Profile_level_id) {
-							return false
-						}
+				// The caller makes sure aCodec.Parameters is not nil.
+				if modify {
+					if len(selectedProfileLevelId) > 0 {
+						aCodec.Parameters["profile-level-id"] = selectedProfileLevelId
+					} else {
+						delete(aCodec.Parameters, "profile-level-id")
+					}
+				}
+			}
 
-						var selectedProfileLevelId string
+			break
+		}
 
-						selectedProfileLevelId, ok := libs.GenerateProfileLevelIdForAnswer(p.Parameters.Profile_level_id, q.Parameters.Profile_level_id)
-						if !ok {
-							logger.Errorf("No profile for profile")
-							return false
-						}
+	case "video/av1":
+		{
+			// If strict matching check profile.
+			if strict {
+				aProfile := aCodec.Parameters.Int("profile")
+				bProfile := bCodec.Parameters.Int("profile")
 
-						if modify {
+				if aProfile != bProfile {
+					return false
+				}
+			}
 
-							if len(selectedProfileLevelId) > 0 {
-								//p.Parameters.Profile_level_id = selectedProfileLevelId
-							}
+			break
+		}
 
-							// else
-							// 	delete aCodec.parameters['profile-level-id'];
-						}
-					}
+	case "video/h265":
+		{
+			// If strict matching check profile-id, tier-flag and tx-mode.
+			if strict {
+				if !libs.IsSameH265Profile(aCodec.Parameters, bCodec.Parameters) {
+					return false
+				}
 
-					break
+				if !libs.IsSameH265TxMode(aCodec.Parameters, bCodec.Parameters) {
+					return false
 				}
+			}
 
-			case "video/vp9":
-				{
-					// If strict matching check profile-id.
-					if strict {
-						aProfileId := p.Parameters.Profile_id
-						bProfileId := q.Parameters.Profile_id
+			break
+		}
 
-						if aProfileId != bProfileId {
-							return false
-						}
-					}
+	case "video/vp9":
+		{
+			// If strict matching check profile-id.
+			if strict {
+				aProfileId := aCodec.Parameters.Int("profile-id")
+				bProfileId := bCodec.Parameters.Int("profile-id")
 
-					break
+				if aProfileId != bProfileId {
+					return false
 				}
 			}
 
-			return true
+			break
 		}
 	}
-	return false
+
+	return true
 }
 
 /**
@@ -550,15 +990,9 @@ func GetConsumableRtpParameters(kind string, params *ClientRtpParameters, caps *
 			var matchedCapCodec RtpCodecCapability
 
 			for _, capCodec := range caps.Codecs {
-
-				rtpCapCodec, ok1 := capCodec.(RtpCodecCapability)
-
-				if ok1 {
-					if rtpCapCodec.PreferredPayloadType == consumableCodecPt {
-						matchedCapCodec = rtpCapCodec
-					}
+				if capCodec.PreferredPayloadType == consumableCodecPt {
+					matchedCapCodec = capCodec
 				}
-
 			}
 
 			consumableCodec := RtpCodecParameters{
@@ -566,21 +1000,23 @@ func GetConsumableRtpParameters(kind string, params *ClientRtpParameters, caps *
 				PayloadType:  matchedCapCodec.PreferredPayloadType,
 				ClockRate:    matchedCapCodec.ClockRate,
 				Channels:     matchedCapCodec.Channels,
-				Parameters:   codec.Parameters, // Keep the Producer codec parameters.
+				Parameters:   codec.Parameters.Clone(), // Keep the Producer codec parameters.
 				RtcpFeedback: matchedCapCodec.RtcpFeedback,
 			}
 
+			// But those the router forces on consumers.
+			for key, value := range matchedCapCodec.ConsumerParameters {
+				consumableCodec.Parameters[key] = value
+			}
+
 			consumableParams.Codecs = append(consumableParams.Codecs, consumableCodec)
 
-			var consumableCapRtxCodec *RtxCodecCapability
+			var consumableCapRtxCodec *RtpCodecCapability
 			consumableCapRtxCodec = nil
 
-			for _, capRtxCodec := range caps.Codecs {
-
-				rtxCapCodec, ok1 := capRtxCodec.(RtxCodecCapability)
-
-				if ok1 && isRtxCodec(rtxCapCodec.MimeType) && rtxCapCodec.Parameters.Apt == consumableCodec.PayloadType {
-					consumableCapRtxCodec = &rtxCapCodec
+			for i, capRtxCodec := range caps.Codecs {
+				if isRtxCodec(capRtxCodec.MimeType) && capRtxCodec.Parameters.Int("apt") == consumableCodec.PayloadType {
+					consumableCapRtxCodec = &caps.Codecs[i]
 				}
 			}
 
@@ -589,7 +1025,7 @@ func GetConsumableRtpParameters(kind string, params *ClientRtpParameters, caps *
 					MimeType:     consumableCapRtxCodec.MimeType,
 					PayloadType:  consumableCapRtxCodec.PreferredPayloadType,
 					ClockRate:    consumableCapRtxCodec.ClockRate,
-					Parameters:   consumableCapRtxCodec.Parameters,
+					Parameters:   consumableCapRtxCodec.Parameters.Clone(),
 					RtcpFeedback: consumableCapRtxCodec.RtcpFeedback,
 				}
 
@@ -613,34 +1049,21 @@ func GetConsumableRtpParameters(kind string, params *ClientRtpParameters, caps *
 		}
 	}
 
+	// Copy Producer encodings since we'll mangle them.
 	for i, encoding := range params.Encodings {
-		//RtpEncodingParameters
 		consumableEncoding := encoding
 
+		// Remove useless fields.
+		consumableEncoding.Rid = ""
+		consumableEncoding.RtxSsrc = nil
+		consumableEncoding.CodecPayloadType = 0
+
+		// Set the mapped ssrc.
 		consumableEncoding.Ssrc = rtpMapping.Encodings[i].MappedSsrc
 
 		consumableParams.Encodings = append(consumableParams.Encodings, consumableEncoding)
 	}
 
-	// Clone Producer encodings since we'll mangle them.
-
-	// const consumableEncodings = utils.clone(params.encodings) as RtpEncodingParameters[];
-	// for (let i = 0; i < consumableEncodings.length; ++i)
-	// {
-	// 	const consumableEncoding = consumableEncodings[i];
-	// 	const { mappedSsrc } = rtpMapping.encodings[i];
-
-	// 	// Remove useless fields.
-	// 	delete consumableEncoding.rid;
-	// 	delete consumableEncoding.rtx;
-	// 	delete consumableEncoding.codecPayloadType;
-
-	// 	// Set the mapped ssrc.
-	// 	consumableEncoding.ssrc = mappedSsrc;
-
-	// 	consumableParams.encodings!.push(consumableEncoding);
-	// }
-
 	consumableParams.Rtcp = RtcpParameters{
 		Cname:       params.Rtcp.Cname,
 		ReducedSize: true,
@@ -650,6 +1073,104 @@ func GetConsumableRtpParameters(kind string, params *ClientRtpParameters, caps *
 	return consumableParams
 }
 
+/**
+ * Check whether the given RTP capabilities can consume the given Producer.
+ */
+func CanConsume(consumableParams *ClientRtpParameters, caps RtpCapabilities) bool {
+	matchingCodecs := make([]RtpCodecParameters, 0)
+
+	for _, codec := range consumableParams.Codecs {
+		for _, capCodec := range caps.Codecs {
+			if matchCodecs(codec.capability(), capCodec, true, false) {
+				matchingCodecs = append(matchingCodecs, codec)
+				break
+			}
+		}
+	}
+
+	// Ensure there is at least one media codec.
+	if len(matchingCodecs) == 0 || isRtxCodec(matchingCodecs[0].MimeType) {
+		return false
+	}
+
+	return true
+}
+
+/**
+ * Reduce the codecs offered by a remote endpoint (e.g. in a WHIP offer) to the
+ * first media codec supported by the given capabilities, along with its RTX
+ * codec. RTCP feedback not supported by the capabilities is dropped.
+ */
+func ReduceCodecs(codecs []RtpCodecParameters, caps *RtpCapabilities) []RtpCodecParameters {
+	reducedCodecs := make([]RtpCodecParameters, 0)
+
+	for _, codec := range codecs {
+		if isRtxCodec(codec.MimeType) {
+			continue
+		}
+
+		for _, capCodec := range caps.Codecs {
+			if matchCodecs(codec.capability(), capCodec, true, true) {
+				codec.RtcpFeedback = reduceRtcpFeedback(codec.RtcpFeedback, capCodec.RtcpFeedback)
+				reducedCodecs = append(reducedCodecs, codec)
+				break
+			}
+		}
+
+		if len(reducedCodecs) > 0 {
+			break
+		}
+	}
+
+	if len(reducedCodecs) == 0 {
+		return reducedCodecs
+	}
+
+	for _, codec := range codecs {
+		if isRtxCodec(codec.MimeType) && codec.Parameters.Int("apt") == reducedCodecs[0].PayloadType {
+			reducedCodecs = append(reducedCodecs, codec)
+			break
+		}
+	}
+
+	return reducedCodecs
+}
+
+func reduceRtcpFeedback(feedback []RtcpFeedback, capFeedback []RtcpFeedback) []RtcpFeedback {
+	reducedFeedback := make([]RtcpFeedback, 0)
+
+	for _, fb := range feedback {
+		for _, capFb := range capFeedback {
+			if fb.FeedbackType == capFb.FeedbackType && fb.Parameter == capFb.Parameter {
+				reducedFeedback = append(reducedFeedback, fb)
+				break
+			}
+		}
+	}
+
+	return reducedFeedback
+}
+
+const (
+	transportWideCcUri = "http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01"
+	absSendTimeUri     = "http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time"
+)
+
+func hasHeaderExtension(headerExtensions []RtpHeaderExtensionParameters, uri string) bool {
+	for _, ext := range headerExtensions {
+		if ext.Uri == uri {
+			return true
+		}
+	}
+
+	return false
+}
+
+/**
+ * Generate RTP parameters for a specific Consumer. Header extensions are those
+ * of the consumable parameters which the remote capabilities can receive, by
+ * URI, kind and direction.
+ */
 func GetConsumerRtpParameters(consumableRtpParameters *ClientRtpParameters, rtpCapabilities RtpCapabilities, pipe bool) *ClientRtpParameters {
 	consumerParams := &ClientRtpParameters{
 		Codecs:           make([]RtpCodecParameters, 0),
@@ -662,33 +1183,19 @@ func GetConsumerRtpParameters(consumableRtpParameters *ClientRtpParameters, rtpC
 	for _, v := range consumableRtpParameters.Codecs {
 
 		codec := v
-		for _, k := range rtpCapabilities.Codecs {
-
-			rtpCapCodec, ok1 := k.(RtpCodecCapability)
-			rtxCapCodec, ok2 := k.(RtxCodecCapability)
-
-			if ok1 && matchCodecs(codec, rtpCapCodec, true, false) {
-				codec.RtcpFeedback = rtpCapCodec.RtcpFeedback
-
-				logger.Debugf("=============GetConsumerRtpParameters:consumerableCodec:%+v, rtpCapCodec:%+v================", codec, rtpCapCodec)
-				consumerParams.Codecs = append(consumerParams.Codecs, v)
-				break
-			}
-
-			if ok2 && matchCodecs(codec, rtxCapCodec, true, false) {
-				codec.RtcpFeedback = rtxCapCodec.RtcpFeedback
+		for _, capCodec := range rtpCapabilities.Codecs {
+			if matchCodecs(codec.capability(), capCodec, true, false) {
+				codec.RtcpFeedback = capCodec.RtcpFeedback
 
-				logger.Debugf("=============GetConsumerRtpParameters:consumerableCodec:%+v, rtxCapCodec:%+v================", codec, rtxCapCodec)
-				consumerParams.Codecs = append(consumerParams.Codecs, v)
+				logger.Debugf("GetConsumerRtpParameters:consumerableCodec:%+v, capCodec:%+v", codec, capCodec)
+				consumerParams.Codecs = append(consumerParams.Codecs, codec)
 				break
 			}
-
 		}
 	}
 
 	// Must sanitize the list of matched codecs by removing useless RTX codecs.
 
-	//is := make([]int, 0)
 	for i := len(consumerParams.Codecs) - 1; i >= 0; i-- {
 
 		codec := consumerParams.Codecs[i]
@@ -696,8 +1203,8 @@ func GetConsumerRtpParameters(consumableRtpParameters *ClientRtpParameters, rtpC
 			bFound := false
 			for _, mediaCodec := range consumerParams.Codecs {
 
-				if mediaCodec.PayloadType == codec.Parameters.Apt {
-					logger.Debugf("=============equal codec mimetype:%s, %s, mediaCodec:%d, codec:%d,len:%d, i:%d,", codec.MimeType, mediaCodec.MimeType, mediaCodec.PayloadType, codec.Parameters.Apt, len(consumerParams.Codecs), i)
+				if mediaCodec.PayloadType == codec.Parameters.Int("apt") {
+					logger.Debugf("equal codec mimetype:%s, %s, mediaCodec:%d, codec:%d,len:%d, i:%d,", codec.MimeType, mediaCodec.MimeType, mediaCodec.PayloadType, codec.Parameters.Int("apt"), len(consumerParams.Codecs), i)
 					bFound = true
 					rtxSupported = true
 					break
@@ -705,93 +1212,64 @@ func GetConsumerRtpParameters(consumableRtpParameters *ClientRtpParameters, rtpC
 			}
 
 			if !bFound {
-				logger.Debugf("=============remove codec:%d, len:%d", i, len(consumerParams.Codecs))
+				logger.Debugf("remove codec:%d, len:%d", i, len(consumerParams.Codecs))
 				consumerParams.Codecs = append(consumerParams.Codecs[:i], consumerParams.Codecs[i+1:]...)
 			}
 		}
 	}
 
-	// codecs := make([]RtpCodecParameters, 0)
-	// for i := 0; i < len(consumerParams.Codecs)-1; i++ {
-
-	// 	exist := false
-	// 	for _, j := range is {
-	// 		if i == j {
-	// 			exist = true
-	// 			break
-	// 		}
-	// 	}
-	// 	if !exist {
-	// 		codecs = append(codecs, consumerParams.Codecs[i])
-	// 	}
-	// }
-
-	// consumerParams.Codecs = codecs
-
 	if len(consumerParams.Codecs) == 0 || isRtxCodec(consumerParams.Codecs[0].MimeType) {
-		logger.Debugf("============GetConsumerRtpParameters consumerParams.Codecs is nil or isRtxCodec=============")
+		logger.Debugf("GetConsumerRtpParameters consumerParams.Codecs is nil or isRtxCodec")
 		return nil
 	}
 
-	for _, v := range consumableRtpParameters.HeaderExtensions {
+	kind := consumerParams.Codecs[0].MimeType[:strings.Index(consumerParams.Codecs[0].MimeType, "/")]
 
-		match := true
-		for _, k := range rtpCapabilities.HeaderExtensions {
-			if !(k.PreferredId == v.Id && k.Uri == v.Uri) {
-				match = false
-				break
+	// Keep the header extensions the remote endpoint can receive.
+	for _, ext := range consumableRtpParameters.HeaderExtensions {
+		for _, capExt := range rtpCapabilities.HeaderExtensions {
+			if capExt.Uri != ext.Uri || (len(capExt.Kind) > 0 && capExt.Kind != kind) {
+				continue
 			}
-		}
 
-		if match {
-			consumerParams.HeaderExtensions = append(consumerParams.HeaderExtensions, v)
+			if capExt.Direction == "" || capExt.Direction == "sendrecv" || capExt.Direction == "recvonly" {
+				consumerParams.HeaderExtensions = append(consumerParams.HeaderExtensions, ext)
+				break
+			}
 		}
 	}
 
-	logger.Debugf("============GetConsumerRtpParameters:%+v=============", consumerParams)
+	logger.Debugf("GetConsumerRtpParameters:%+v", consumerParams)
 
-	// Reduce codecs' RTCP feedback. Use Transport-CC if available, REMB otherwise.
-	for _, v := range consumerParams.HeaderExtensions {
-		if v.Uri == "http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01" {
-
-			for _, k := range consumerParams.Codecs {
-
-				feedbacks := make([]RtcpFeedback, 0)
-				for _, l := range k.RtcpFeedback {
-					if l.FeedbackType != "goog-remb" {
-						feedbacks = append(feedbacks, l)
-					}
-				}
-
-				k.RtcpFeedback = feedbacks
-			}
-		} else if v.Uri == "http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time" {
+	consumerParams.Rtcp = consumableRtpParameters.Rtcp
 
-			for _, k := range consumerParams.Codecs {
+	// Reduce codecs' RTCP feedback. Use Transport-CC if available, REMB otherwise.
+	var removedFeedback []string
+	if hasHeaderExtension(consumerParams.HeaderExtensions, transportWideCcUri) {
+		removedFeedback = []string{"goog-remb"}
+	} else if hasHeaderExtension(consumerParams.HeaderExtensions, absSendTimeUri) {
+		removedFeedback = []string{"transport-cc"}
+	} else {
+		removedFeedback = []string{"transport-cc", "goog-remb"}
+	}
 
-				feedbacks := make([]RtcpFeedback, 0)
-				for _, l := range k.RtcpFeedback {
-					if l.FeedbackType != "transport-cc" {
-						feedbacks = append(feedbacks, l)
-					}
+	for i, codec := range consumerParams.Codecs {
+		feedbacks := make([]RtcpFeedback, 0, len(codec.RtcpFeedback))
+		for _, fb := range codec.RtcpFeedback {
+			removed := false
+			for _, feedbackType := range removedFeedback {
+				if fb.FeedbackType == feedbackType {
+					removed = true
+					break
 				}
-
-				k.RtcpFeedback = feedbacks
 			}
-		} else {
-
-			for _, k := range consumerParams.Codecs {
-
-				feedbacks := make([]RtcpFeedback, 0)
-				for _, l := range k.RtcpFeedback {
-					if l.FeedbackType != "transport-cc" && l.FeedbackType != "goog-remb" {
-						feedbacks = append(feedbacks, l)
-					}
-				}
 
-				k.RtcpFeedback = feedbacks
+			if !removed {
+				feedbacks = append(feedbacks, fb)
 			}
 		}
+
+		consumerParams.Codecs[i].RtcpFeedback = feedbacks
 	}
 
 	if !pipe {
@@ -800,25 +1278,28 @@ func GetConsumerRtpParameters(consumableRtpParameters *ClientRtpParameters, rtpC
 		}
 
 		if rtxSupported {
-			consumerEncoding.RtxSsrc = RtxSsrc_t{Ssrc: consumerEncoding.Ssrc + 1}
+			consumerEncoding.RtxSsrc = &RtxSsrc_t{Ssrc: consumerEncoding.Ssrc + 1}
 		}
 
 		// If any of the consumableParams.encodings has scalabilityMode, process it
 		// (assume all encodings have the same value).
+		scalabilityMode := ""
 		for _, v := range consumableRtpParameters.Encodings {
 			if len(v.ScalabilityMode) > 0 {
-				scalabilityMode := v.ScalabilityMode
-
-				// If there is simulast, mangle spatial layers in scalabilityMode.
-				if len(consumableRtpParameters.Encodings) > 0 {
-					scalabilityMode = fmt.Sprintf("S%dT3", len(consumableRtpParameters.Encodings))
-				}
-
-				consumerEncoding.ScalabilityMode = scalabilityMode
+				scalabilityMode = v.ScalabilityMode
 				break
 			}
 		}
 
+		// If there is simulast, mangle spatial layers in scalabilityMode.
+		if len(consumableRtpParameters.Encodings) > 1 {
+			temporalLayers := ParseScalabilityMode(scalabilityMode).TemporalLayers
+
+			scalabilityMode = fmt.Sprintf("L%dT%d", len(consumableRtpParameters.Encodings), temporalLayers)
+		}
+
+		consumerEncoding.ScalabilityMode = scalabilityMode
+
 		// Use the maximum maxBitrate in any encoding and honor it in the Consumer's
 		// encoding.
 		maxEncodingMaxBitrate := 0
@@ -832,7 +1313,143 @@ func GetConsumerRtpParameters(consumableRtpParameters *ClientRtpParameters, rtpC
 			consumerEncoding.MaxBitrate = maxEncodingMaxBitrate
 		}
 
+		// Set a single encoding for the Consumer.
 		consumerParams.Encodings = append(consumerParams.Encodings, consumerEncoding)
+	} else {
+		// Otherwise duplicate the given consumable encodings.
+		baseSsrc := utils.RandomNumberGenerator(100000000, 999999999)
+		baseRtxSsrc := utils.RandomNumberGenerator(100000000, 999999999)
+
+		for i, v := range consumableRtpParameters.Encodings {
+			encoding := v
+
+			encoding.Ssrc = baseSsrc + i
+			if rtxSupported {
+				encoding.RtxSsrc = &RtxSsrc_t{Ssrc: baseRtxSsrc + i}
+			} else {
+				encoding.RtxSsrc = nil
+			}
+
+			consumerParams.Encodings = append(consumerParams.Encodings, encoding)
+		}
+	}
+
+	return consumerParams
+}
+
+/**
+ * Make consumer RTP parameters use the payload types and header extension ids
+ * of the remote capabilities instead of the router ones. These are the same
+ * for mediasoup clients, but an SDP answer has to use those of the offer. RTX
+ * codecs follow the media codec they are associated with.
+ */
+func MapConsumerRtpParameters(consumerParams *ClientRtpParameters, rtpCapabilities RtpCapabilities) {
+	payloadTypes := make(map[int]int)
+
+	for _, codec := range consumerParams.Codecs {
+		if isRtxCodec(codec.MimeType) {
+			continue
+		}
+		for _, capCodec := range rtpCapabilities.Codecs {
+			if !isRtxCodec(capCodec.MimeType) && matchCodecs(codec.capability(), capCodec, true, false) {
+				payloadTypes[codec.PayloadType] = capCodec.PreferredPayloadType
+				break
+			}
+		}
+	}
+
+	for i, codec := range consumerParams.Codecs {
+		if !isRtxCodec(codec.MimeType) {
+			continue
+		}
+		apt, ok := payloadTypes[codec.Parameters.Int("apt")]
+		if !ok {
+			continue
+		}
+		for _, capCodec := range rtpCapabilities.Codecs {
+			if isRtxCodec(capCodec.MimeType) && capCodec.Parameters.Int("apt") == apt {
+				payloadTypes[codec.PayloadType] = capCodec.PreferredPayloadType
+				consumerParams.Codecs[i].Parameters = codec.Parameters.Clone()
+				consumerParams.Codecs[i].Parameters["apt"] = apt
+				break
+			}
+		}
+	}
+
+	for i, codec := range consumerParams.Codecs {
+		if payloadType, ok := payloadTypes[codec.PayloadType]; ok {
+			consumerParams.Codecs[i].PayloadType = payloadType
+		}
+	}
+	for i, encoding := range consumerParams.Encodings {
+		if payloadType, ok := payloadTypes[encoding.CodecPayloadType]; ok && encoding.CodecPayloadType != 0 {
+			consumerParams.Encodings[i].CodecPayloadType = payloadType
+		}
+	}
+
+	for i, ext := range consumerParams.HeaderExtensions {
+		for _, capExt := range rtpCapabilities.HeaderExtensions {
+			if capExt.Uri == ext.Uri {
+				consumerParams.HeaderExtensions[i].Id = capExt.PreferredId
+				break
+			}
+		}
+	}
+}
+
+/**
+ * Generate RTP parameters for a pipe Consumer. It keeps all the consumable
+ * encodings, header extensions but MID and BWE related ones, and RTCP feedback
+ * for keyframe requests, or NACK too with RTX.
+ */
+func GetPipeConsumerRtpParameters(consumableRtpParameters *ClientRtpParameters, enableRtx bool) *ClientRtpParameters {
+	consumerParams := &ClientRtpParameters{
+		Codecs:           make([]RtpCodecParameters, 0),
+		HeaderExtensions: make([]RtpHeaderExtensionParameters, 0),
+		Encodings:        make([]RtpEncodingParameters, 0),
+		Rtcp:             consumableRtpParameters.Rtcp,
+	}
+
+	for _, codec := range consumableRtpParameters.Codecs {
+		if !enableRtx && isRtxCodec(codec.MimeType) {
+			continue
+		}
+
+		feedbacks := make([]RtcpFeedback, 0)
+		for _, fb := range codec.RtcpFeedback {
+			if (fb.FeedbackType == "nack" && fb.Parameter == "pli") ||
+				(fb.FeedbackType == "ccm" && fb.Parameter == "fir") ||
+				(enableRtx && fb.FeedbackType == "nack" && len(fb.Parameter) == 0) {
+				feedbacks = append(feedbacks, fb)
+			}
+		}
+
+		codec.Parameters = codec.Parameters.Clone()
+		codec.RtcpFeedback = feedbacks
+		consumerParams.Codecs = append(consumerParams.Codecs, codec)
+	}
+
+	// Reduce RTP extensions by disabling transport MID and BWE related ones.
+	for _, ext := range consumableRtpParameters.HeaderExtensions {
+		if ext.Uri != "urn:ietf:params:rtp-hdrext:sdes:mid" && ext.Uri != absSendTimeUri && ext.Uri != transportWideCcUri {
+			consumerParams.HeaderExtensions = append(consumerParams.HeaderExtensions, ext)
+		}
+	}
+
+	baseSsrc := utils.RandomNumberGenerator(100000000, 999999999)
+	baseRtxSsrc := utils.RandomNumberGenerator(100000000, 999999999)
+
+	for i, v := range consumableRtpParameters.Encodings {
+		encoding := v
+
+		encoding.Ssrc = baseSsrc + i
+		if enableRtx {
+			encoding.RtxSsrc = &RtxSsrc_t{Ssrc: baseRtxSsrc + i}
+		} else {
+			encoding.RtxSsrc = nil
+		}
+
+		consumerParams.Encodings = append(consumerParams.Encodings, encoding)
 	}
 
 	return consumerParams
@@ -0,0 +1,271 @@
+package rtp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"mediasoup-signal-controller/conf"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// checkGolden compares got, as indented JSON, with testdata/<name>.golden.json.
+func checkGolden(t *testing.T, name string, got interface{}) {
+	t.Helper()
+
+	data, err := json.MarshalIndent(got, "", "  ")
+	if err != nil {
+		t.Fatalf("marshal %s: %v", name, err)
+	}
+	data = append(data, '\n')
+
+	path := filepath.Join("testdata", name+".golden.json")
+	if *update {
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	if !bytes.Equal(data, want) {
+		t.Errorf("%s differs from %s:\n%s", name, path, data)
+	}
+}
+
+// clearSsrcs zeroes the random ssrcs of consumer parameters.
+func clearSsrcs(params *ClientRtpParameters) {
+	for i := range params.Encodings {
+		params.Encodings[i].Ssrc = 0
+		if params.Encodings[i].RtxSsrc != nil {
+			params.Encodings[i].RtxSsrc.Ssrc = 0
+		}
+	}
+}
+
+// ortcFixture is a case of a table in testdata. Cases expecting no error and
+// giving a result are compared with testdata/<table>_<name>.golden.json.
+type ortcFixture struct {
+	Name string `json:"name"`
+	// Router codecs, those of testdata/media_codecs.json when nil.
+	MediaCodecs   []conf.MediaCodec_t  `json:"mediaCodecs"`
+	Kind          string               `json:"kind"`
+	RtpParameters *ClientRtpParameters `json:"rtpParameters"`
+	// Name of the get_producer_rtp_parameters_mapping case to consume.
+	Producer        string           `json:"producer"`
+	RtpCapabilities *RtpCapabilities `json:"rtpCapabilities"`
+	Pipe            bool             `json:"pipe"`
+	EnableRtx       bool             `json:"enableRtx"`
+	// Part of the expected error message.
+	Error string `json:"error"`
+}
+
+func loadFixtures(t *testing.T, table string) []ortcFixture {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", table+".json"))
+	if err != nil {
+		t.Fatalf("read %s: %v", table, err)
+	}
+
+	var fixtures []ortcFixture
+	if err := json.Unmarshal(data, &fixtures); err != nil {
+		t.Fatalf("parse %s: %v", table, err)
+	}
+
+	return fixtures
+}
+
+func runFixtures(t *testing.T, table string, run func(t *testing.T, fixture ortcFixture) (interface{}, error)) {
+	for _, fixture := range loadFixtures(t, table) {
+		fixture := fixture
+		t.Run(fixture.Name, func(t *testing.T) {
+			got, err := run(t, fixture)
+			if len(fixture.Error) > 0 {
+				if err == nil || !strings.Contains(err.Error(), fixture.Error) {
+					t.Fatalf("error = %v, want %q", err, fixture.Error)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got == nil {
+				return
+			}
+
+			checkGolden(t, table+"_"+fixture.Name, got)
+		})
+	}
+}
+
+func fixtureMediaCodecs(t *testing.T, fixture ortcFixture) conf.RouterOptions_t {
+	t.Helper()
+
+	if fixture.MediaCodecs != nil {
+		return conf.RouterOptions_t{MediaCodecs: fixture.MediaCodecs}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "media_codecs.json"))
+	if err != nil {
+		t.Fatalf("read media_codecs: %v", err)
+	}
+
+	var options conf.RouterOptions_t
+	if err := json.Unmarshal(data, &options.MediaCodecs); err != nil {
+		t.Fatalf("parse media_codecs: %v", err)
+	}
+
+	return options
+}
+
+// produce maps the RTP parameters of a producer case, checking the mapped
+// ssrcs, and returns them along with the consumable RTP parameters.
+func produce(t *testing.T, fixture ortcFixture) (*RtpMapping, *ClientRtpParameters, error) {
+	t.Helper()
+
+	routerCaps := GenerateRouterRtpCapabilities(fixtureMediaCodecs(t, fixture))
+
+	rtpMapping, err := GetProducerRtpParametersMapping(fixture.RtpParameters, routerCaps)
+	if err != nil {
+		return nil, nil, err
+	}
+	consumable := GetConsumableRtpParameters(fixture.Kind, fixture.RtpParameters, routerCaps, rtpMapping)
+
+	for i, encoding := range rtpMapping.Encodings {
+		if encoding.MappedSsrc == 0 || encoding.MappedSsrc != rtpMapping.Encodings[0].MappedSsrc+i {
+			t.Errorf("encodings[%d].mappedSsrc = %d, want consecutive ssrcs", i, encoding.MappedSsrc)
+		}
+		if consumable.Encodings[i].Ssrc != encoding.MappedSsrc {
+			t.Errorf("consumable encodings[%d].ssrc = %d, want %d", i, consumable.Encodings[i].Ssrc, encoding.MappedSsrc)
+		}
+	}
+
+	return rtpMapping, consumable, nil
+}
+
+// consumable returns the consumable RTP parameters of the producer case named
+// by fixture.
+func consumable(t *testing.T, fixture ortcFixture) *ClientRtpParameters {
+	t.Helper()
+
+	for _, producer := range loadFixtures(t, "get_producer_rtp_parameters_mapping") {
+		if producer.Name == fixture.Producer {
+			_, consumable, err := produce(t, producer)
+			if err != nil {
+				t.Fatalf("producer %s: %v", producer.Name, err)
+			}
+			return consumable
+		}
+	}
+
+	t.Fatalf("no producer %s", fixture.Producer)
+	return nil
+}
+
+func TestGenerateRouterRtpCapabilities(t *testing.T) {
+	runFixtures(t, "generate_router_rtp_capabilities", func(t *testing.T, fixture ortcFixture) (interface{}, error) {
+		mediaCodecs := fixtureMediaCodecs(t, fixture)
+		if err := ValidateRtpCapabilities(mediaCodecs); err != nil {
+			return nil, err
+		}
+
+		return GenerateRouterRtpCapabilities(mediaCodecs), nil
+	})
+}
+
+func TestGetProducerRtpParametersMapping(t *testing.T) {
+	runFixtures(t, "get_producer_rtp_parameters_mapping", func(t *testing.T, fixture ortcFixture) (interface{}, error) {
+		rtpMapping, consumable, err := produce(t, fixture)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := range rtpMapping.Encodings {
+			rtpMapping.Encodings[i].MappedSsrc = 0
+		}
+		clearSsrcs(consumable)
+
+		return map[string]interface{}{
+			"rtpMapping":              rtpMapping,
+			"consumableRtpParameters": consumable,
+		}, nil
+	})
+}
+
+func TestGetConsumerRtpParameters(t *testing.T) {
+	runFixtures(t, "get_consumer_rtp_parameters", func(t *testing.T, fixture ortcFixture) (interface{}, error) {
+		consumable := consumable(t, fixture)
+		before, _ := json.Marshal(consumable)
+
+		canConsume := CanConsume(consumable, *fixture.RtpCapabilities)
+		params := GetConsumerRtpParameters(consumable, *fixture.RtpCapabilities, fixture.Pipe)
+		// Consumable parameters are shared by all the consumers of a producer.
+		if after, _ := json.Marshal(consumable); !bytes.Equal(before, after) {
+			t.Errorf("GetConsumerRtpParameters() changed the consumable parameters:\n%s\n%s", before, after)
+		}
+		if canConsume != (params != nil) {
+			t.Errorf("CanConsume() = %t, but GetConsumerRtpParameters() = %+v", canConsume, params)
+		}
+		if params == nil {
+			return nil, errors.New("cannot consume")
+		}
+
+		for _, encoding := range params.Encodings {
+			if encoding.Ssrc == 0 {
+				t.Errorf("encoding without ssrc: %+v", encoding)
+			}
+			if !fixture.Pipe && encoding.RtxSsrc != nil && encoding.RtxSsrc.Ssrc != encoding.Ssrc+1 {
+				t.Errorf("rtx ssrc = %d, want %d", encoding.RtxSsrc.Ssrc, encoding.Ssrc+1)
+			}
+		}
+		clearSsrcs(params)
+
+		return params, nil
+	})
+}
+
+func TestGetPipeConsumerRtpParameters(t *testing.T) {
+	runFixtures(t, "get_pipe_consumer_rtp_parameters", func(t *testing.T, fixture ortcFixture) (interface{}, error) {
+		params := GetPipeConsumerRtpParameters(consumable(t, fixture), fixture.EnableRtx)
+
+		for i, encoding := range params.Encodings {
+			if encoding.Ssrc == 0 || encoding.Ssrc != params.Encodings[0].Ssrc+i {
+				t.Errorf("encodings[%d].ssrc = %d, want consecutive ssrcs", i, encoding.Ssrc)
+			}
+		}
+		clearSsrcs(params)
+
+		return params, nil
+	})
+}
+
+func TestConfigMediaCodecs(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("..", "conf", "config.json"))
+	if err != nil {
+		t.Fatalf("read config.json: %v", err)
+	}
+
+	var config conf.Config
+	if err := json.Unmarshal(data, &config); err != nil {
+		t.Fatalf("parse config.json: %v", err)
+	}
+
+	if err := ValidateRtpCapabilities(config.Mediasoup.RouterOptions); err != nil {
+		t.Fatalf("ValidateRtpCapabilities() = %v", err)
+	}
+}
+
+func TestValidateRtpParameters(t *testing.T) {
+	runFixtures(t, "validate_rtp_parameters", func(t *testing.T, fixture ortcFixture) (interface{}, error) {
+		return nil, ValidateRtpParameters(fixture.Kind, fixture.RtpParameters)
+	})
+}
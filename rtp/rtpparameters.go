@@ -1,6 +1,10 @@
 package rtp
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+)
 
 type RtpCodecCapability struct {
 	/**
@@ -29,31 +33,22 @@ type RtpCodecCapability struct {
 	Channels int `json:"channels"`
 
 	/**
-	 * Codec specific parameters. Some parameters (such as 'packetization_mode'
+	 * Codec specific parameters. Some parameters (such as 'packetization-mode'
 	 * and 'profile-level-id' in H264 or 'profile-id' in VP9) are critical for
-	 * codec matching.
+	 * codec matching. RTX codecs carry the associated payload type in 'apt'.
 	 */
-	//Parameters RTPHeaderParameter `json:"parameters"`
-	Parameters RTPHeaderParameter `json:"parameters"`
+	Parameters ParameterMap `json:"parameters"`
 
 	/**
 	 * Transport layer and codec-specific feedback messages for this codec.
 	 */
 	RtcpFeedback []RtcpFeedback `json:"rtcpFeedback"`
 
-	Apt int `json:"apt"`
-}
-
-type RtxCodecParameter struct {
-	Apt int `json:"apt"`
-}
-type RtxCodecCapability struct {
-	Kind                 string             `json:"kind"`
-	MimeType             string             `json:"mimeType"`
-	PreferredPayloadType int                `json:"preferredPayloadType"`
-	ClockRate            int                `json:"clockRate"`
-	Parameters           RTPHeaderParameter `json:"parameters"`
-	RtcpFeedback         []RtcpFeedback     `json:"rtcpFeedback"`
+	/**
+	 * Parameters of the router codec overriding those of the Producer in
+	 * consumers (e.g. 'usedtx' in Opus). Not signaled.
+	 */
+	ConsumerParameters ParameterMap `json:"-"`
 }
 
 type RtpHeaderExtension struct {
@@ -116,24 +111,6 @@ type RtpParameters struct {
 type RtpCapabilities struct {
 	/**
 	 * Supported media and RTX codecs.
-	 * may be RtpCodecCapability or RtxCodecCapability
-	 */
-	// Codecs []RtpCodecCapability `json:"codecs"`
-	Codecs []interface{} `json:"codecs"`
-	/**
-	 * Supported RTP header extensions.
-	 */
-	HeaderExtensions []RtpHeaderExtension `json:"headerExtensions"`
-	/**
-	 * Supported FEC mechanisms.
-	 */
-	FecMechanisms []string `json:"fecMechanisms"`
-}
-
-type RtpCapabilities_In struct {
-	/**
-	 * Supported media and RTX codecs.
-	 * may be RtpCodecCapability or RtxCodecCapability
 	 */
 	Codecs []RtpCodecCapability `json:"codecs"`
 	/**
@@ -166,24 +143,24 @@ type RtpEncodingParameters struct {
 	/**
 	 * The media SSRC.
 	 */
-	Ssrc int `json:"ssrc"`
+	Ssrc int `json:"ssrc,omitempty"`
 
 	/**
 	 * The RID RTP extension value. Must be unique.
 	 */
-	Rid string `json:"rid"`
+	Rid string `json:"rid,omitempty"`
 
 	/**
 	 * Codec payload type this encoding affects. If unset, first media codec is
 	 * chosen.
 	 */
-	CodecPayloadType int `json:"codecPayloadType"`
+	CodecPayloadType int `json:"codecPayloadType,omitempty"`
 
 	/**
 	 * RTX stream information. It must contain a numeric ssrc field indicating
 	 * the RTX SSRC.
 	 */
-	RtxSsrc RtxSsrc_t `json:"rtx"`
+	RtxSsrc *RtxSsrc_t `json:"rtx,omitempty"`
 
 	/**
 	 * It indicates whether discontinuous RTP transmission will be used. Useful
@@ -191,29 +168,108 @@ type RtpEncodingParameters struct {
 	 * static content is being transmitted, this option disables the RTP
 	 * inactivity checks in mediasoup). Default false.
 	 */
-	Dtx bool `json:"dtx"`
+	Dtx bool `json:"dtx,omitempty"`
 
 	/**
 	 * Number of spatial and temporal layers in the RTP stream (e.g. 'L1T3').
 	 * See webrtc-svc.
 	 */
-	ScalabilityMode string `json:"scalabilityMode"`
+	ScalabilityMode string `json:"scalabilityMode,omitempty"`
 
 	/**
 	 * Others.
 	 */
-	ScaleResolutionDownBy int `json:"scaleResolutionDownBy"`
-	MaxBitrate            int `json:"maxBitrate"`
+	ScaleResolutionDownBy float64 `json:"scaleResolutionDownBy,omitempty"`
+	MaxBitrate            int     `json:"maxBitrate,omitempty"`
+}
+
+/**
+ * Codec or header extension parameters (fmtp). Values are kept as received,
+ * numbers as int (or float64 when not integral) and anything else as decoded,
+ * so parameters unknown here round-trip untouched.
+ */
+type ParameterMap map[string]interface{}
+
+func (params ParameterMap) Has(key string) bool {
+	_, ok := params[key]
+	return ok
+}
+
+/**
+ * Value of key as an int, 0 when missing or not a number.
+ */
+func (params ParameterMap) Int(key string) int {
+	switch value := params[key].(type) {
+	case int:
+		return value
+	case float64:
+		return int(value)
+	case string:
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+
+	return 0
 }
 
-type RTPHeaderParameter struct {
-	Packetization_mode      int `json:"packetization-mode"`
-	Level_asymmetry_allowed int `json:"level-asymmetry-allowed"`
+/**
+ * Value of key as a string, empty when missing.
+ */
+func (params ParameterMap) String(key string) string {
+	switch value := params[key].(type) {
+	case string:
+		return value
+	case int:
+		return strconv.Itoa(value)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	return ""
+}
+
+func (params ParameterMap) Clone() ParameterMap {
+	clone := make(ParameterMap, len(params))
+	for key, value := range params {
+		clone[key] = value
+	}
+
+	return clone
+}
 
-	Profile_level_id string `json:"profile-level-id"`
-	Profile_id       int    `json:"profile-id"`
-	Apt              int    `json:"apt"`
+func (params ParameterMap) MarshalJSON() ([]byte, error) {
+	if params == nil {
+		return []byte("{}"), nil
+	}
+
+	return json.Marshal(map[string]interface{}(params))
+}
+
+func (params *ParameterMap) UnmarshalJSON(data []byte) error {
+	values := make(map[string]interface{})
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&values); err != nil {
+		return err
+	}
+
+	*params = make(ParameterMap, len(values))
+	for key, value := range values {
+		if number, ok := value.(json.Number); ok {
+			if n, err := number.Int64(); err == nil {
+				value = int(n)
+			} else if f, err := number.Float64(); err == nil {
+				value = f
+			}
+		}
+		(*params)[key] = value
+	}
+
+	return nil
 }
+
 type RtpHeaderExtensionParameters struct {
 	/**
 	 * The URI of the RTP header extension, as defined in RFC 5285.
@@ -233,5 +289,5 @@ type RtpHeaderExtensionParameters struct {
 	/**
 	 * Configuration parameters for the header extension.
 	 */
-	Parameters RTPHeaderParameter `json:"parameters"`
+	Parameters ParameterMap `json:"parameters"`
 }
@@ -0,0 +1,38 @@
+package rtp
+
+import (
+	"regexp"
+	"strconv"
+)
+
+var scalabilityModeRegex = regexp.MustCompile(`^[LS]([1-9]\d{0,1})T([1-9]\d{0,1})(_KEY)?`)
+
+type ScalabilityMode struct {
+	SpatialLayers  int  `json:"spatialLayers"`
+	TemporalLayers int  `json:"temporalLayers"`
+	Ksvc           bool `json:"ksvc"`
+}
+
+/**
+ * Parse a scalabilityMode (e.g. 'L1T3', 'S3T3' or 'L3T3_KEY') into its number
+ * of spatial and temporal layers. Anything else means a single layer.
+ */
+func ParseScalabilityMode(scalabilityMode string) ScalabilityMode {
+	match := scalabilityModeRegex.FindStringSubmatch(scalabilityMode)
+	if match == nil {
+		return ScalabilityMode{
+			SpatialLayers:  1,
+			TemporalLayers: 1,
+			Ksvc:           false,
+		}
+	}
+
+	spatialLayers, _ := strconv.Atoi(match[1])
+	temporalLayers, _ := strconv.Atoi(match[2])
+
+	return ScalabilityMode{
+		SpatialLayers:  spatialLayers,
+		TemporalLayers: temporalLayers,
+		Ksvc:           len(match[3]) > 0,
+	}
+}
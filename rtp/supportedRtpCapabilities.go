@@ -3,7 +3,7 @@ package rtp
 func SupportedRtpCapabilities() *RtpCapabilities {
 
 	return &RtpCapabilities{
-		Codecs: []interface{}{
+		Codecs: []RtpCodecCapability{
 			RtpCodecCapability{
 				Kind:      "audio",
 				MimeType:  "audio/opus",
@@ -176,9 +176,9 @@ func SupportedRtpCapabilities() *RtpCapabilities {
 				Kind:      "video",
 				MimeType:  "video/H264",
 				ClockRate: 90000,
-				Parameters: RTPHeaderParameter{
-					Packetization_mode:      1,
-					Level_asymmetry_allowed: 1,
+				Parameters: ParameterMap{
+					"packetization-mode":      1,
+					"level-asymmetry-allowed": 1,
 				},
 				RtcpFeedback: []RtcpFeedback{
 
@@ -193,9 +193,9 @@ func SupportedRtpCapabilities() *RtpCapabilities {
 				Kind:      "video",
 				MimeType:  "video/H264",
 				ClockRate: 90000,
-				Parameters: RTPHeaderParameter{
-					Packetization_mode:      0,
-					Level_asymmetry_allowed: 1,
+				Parameters: ParameterMap{
+					"packetization-mode":      0,
+					"level-asymmetry-allowed": 1,
 				},
 				RtcpFeedback: []RtcpFeedback{
 
@@ -208,12 +208,8 @@ func SupportedRtpCapabilities() *RtpCapabilities {
 			},
 			RtpCodecCapability{
 				Kind:      "video",
-				MimeType:  "video/H265",
+				MimeType:  "video/AV1",
 				ClockRate: 90000,
-				Parameters: RTPHeaderParameter{
-					Packetization_mode:      1,
-					Level_asymmetry_allowed: 1,
-				},
 				RtcpFeedback: []RtcpFeedback{
 
 					{FeedbackType: "nack"},
@@ -227,10 +223,6 @@ func SupportedRtpCapabilities() *RtpCapabilities {
 				Kind:      "video",
 				MimeType:  "video/H265",
 				ClockRate: 90000,
-				Parameters: RTPHeaderParameter{
-					Packetization_mode:      0,
-					Level_asymmetry_allowed: 1,
-				},
 				RtcpFeedback: []RtcpFeedback{
 
 					{FeedbackType: "nack"},
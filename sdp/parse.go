@@ -0,0 +1,364 @@
+package sdp
+
+import (
+	"errors"
+	"fmt"
+	"mediasoup-signal-controller/rtp"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Parse a session description, e.g. the offer of a WHIP or WHEP client.
+ * Codecs, header extensions, streams and ICE/DTLS attributes are read into
+ * the media sections, everything else is kept in Attributes. Session level
+ * ICE and DTLS attributes apply to media sections not overriding them.
+ */
+func Parse(text string) (*Session, error) {
+	session, err := ParseFragment(text)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(session.Media) == 0 {
+		return nil, errors.New("no media sections")
+	}
+
+	return session, nil
+}
+
+/**
+ * Parse an SDP fragment, e.g. the body of a trickle ICE PATCH request, which
+ * may carry no media section at all but only session level ICE attributes
+ * or candidates.
+ */
+func ParseFragment(text string) (*Session, error) {
+	session := &Session{
+		Media: make([]*Media, 0),
+	}
+
+	var media *Media
+	for n, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) == 0 {
+			continue
+		}
+		if len(line) < 2 || line[1] != '=' {
+			return nil, fmt.Errorf("invalid line %d: %q", n+1, line)
+		}
+
+		value := line[2:]
+		switch line[0] {
+		case 'o':
+			fields := strings.Fields(value)
+			if len(fields) != 6 {
+				return nil, fmt.Errorf("invalid origin: %q", line)
+			}
+			session.SessionId, _ = strconv.ParseInt(fields[1], 10, 64)
+			session.SessionVersion, _ = strconv.Atoi(fields[2])
+		case 's':
+			session.Name = value
+		case 'c':
+			fields := strings.Fields(value)
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("invalid connection: %q", line)
+			}
+			if media != nil {
+				media.Address = fields[2]
+			} else {
+				session.Address = fields[2]
+			}
+		case 'm':
+			var err error
+			if media, err = parseMediaLine(value); err != nil {
+				return nil, err
+			}
+			session.Media = append(session.Media, media)
+		case 'a':
+			var err error
+			if media == nil {
+				err = session.parseAttribute(value)
+			} else {
+				err = media.parseAttribute(value)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for _, media := range session.Media {
+		if len(media.IceUfrag) == 0 {
+			media.IceUfrag = session.IceUfrag
+			media.IcePwd = session.IcePwd
+		}
+		if len(media.Fingerprints) == 0 {
+			media.Fingerprints = session.Fingerprints
+		}
+		if len(media.Setup) == 0 {
+			media.Setup = session.Setup
+		}
+		if len(media.Direction) == 0 {
+			media.Direction = "sendrecv"
+		}
+		for _, ssrc := range media.Ssrcs {
+			if len(ssrc.Cname) > 0 {
+				media.Cname = ssrc.Cname
+				break
+			}
+		}
+	}
+
+	return session, nil
+}
+
+func parseMediaLine(value string) (*Media, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return nil, fmt.Errorf("invalid media: %q", value)
+	}
+
+	port, err := strconv.Atoi(fields[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid media port: %q", value)
+	}
+
+	media := &Media{
+		Kind:     fields[0],
+		Port:     port,
+		Protocol: fields[2],
+		Codecs:   make([]rtp.RtpCodecParameters, 0),
+	}
+
+	for _, field := range fields[3:] {
+		payloadType, err := strconv.Atoi(field)
+		if err != nil {
+			media.Formats = append(media.Formats, field)
+			continue
+		}
+		media.Codecs = append(media.Codecs, rtp.RtpCodecParameters{
+			PayloadType:  payloadType,
+			Parameters:   rtp.ParameterMap{},
+			RtcpFeedback: make([]rtp.RtcpFeedback, 0),
+		})
+	}
+
+	return media, nil
+}
+
+func (session *Session) parseAttribute(attribute string) error {
+	name, value := splitAttribute(attribute)
+	switch name {
+	case "ice-ufrag":
+		session.IceUfrag = value
+	case "ice-pwd":
+		session.IcePwd = value
+	case "fingerprint":
+		fingerprint, err := parseFingerprint(value)
+		if err != nil {
+			return err
+		}
+		session.Fingerprints = append(session.Fingerprints, fingerprint)
+	case "setup":
+		session.Setup = value
+	default:
+		session.Attributes = append(session.Attributes, attribute)
+	}
+
+	return nil
+}
+
+func (media *Media) parseAttribute(attribute string) error {
+	name, value := splitAttribute(attribute)
+	switch name {
+	case "mid":
+		media.Mid = value
+	case "sendrecv", "sendonly", "recvonly", "inactive":
+		media.Direction = name
+	case "rtcp-mux":
+		media.RtcpMux = true
+	case "rtcp-rsize":
+		media.RtcpRsize = true
+	case "ice-ufrag":
+		media.IceUfrag = value
+	case "ice-pwd":
+		media.IcePwd = value
+	case "fingerprint":
+		fingerprint, err := parseFingerprint(value)
+		if err != nil {
+			return err
+		}
+		media.Fingerprints = append(media.Fingerprints, fingerprint)
+	case "setup":
+		media.Setup = value
+	case "candidate":
+		media.Candidates = append(media.Candidates, value)
+	case "end-of-candidates":
+		break
+	case "rtpmap":
+		fields := strings.Fields(value)
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid rtpmap: %q", attribute)
+		}
+		codec := media.codec(fields[0])
+		if codec == nil {
+			return fmt.Errorf("invalid rtpmap: %q", attribute)
+		}
+		encoding := strings.Split(fields[1], "/")
+		if len(encoding) < 2 {
+			return fmt.Errorf("invalid rtpmap: %q", attribute)
+		}
+		codec.MimeType = media.Kind + "/" + encoding[0]
+		codec.ClockRate, _ = strconv.Atoi(encoding[1])
+		if len(encoding) > 2 {
+			codec.Channels, _ = strconv.Atoi(encoding[2])
+		} else if media.Kind == "audio" {
+			codec.Channels = 1
+		}
+	case "fmtp":
+		fields := strings.SplitN(value, " ", 2)
+		codec := media.codec(fields[0])
+		if codec == nil || len(fields) != 2 {
+			return fmt.Errorf("invalid fmtp: %q", attribute)
+		}
+		codec.Parameters = ParseParameters(fields[1])
+	case "rtcp-fb":
+		fields := strings.Fields(value)
+		if len(fields) < 2 {
+			return fmt.Errorf("invalid rtcp-fb: %q", attribute)
+		}
+		fb := rtp.RtcpFeedback{FeedbackType: fields[1]}
+		if len(fields) > 2 {
+			fb.Parameter = strings.Join(fields[2:], " ")
+		}
+		if fields[0] == "*" {
+			for i := range media.Codecs {
+				media.Codecs[i].RtcpFeedback = append(media.Codecs[i].RtcpFeedback, fb)
+			}
+		} else if codec := media.codec(fields[0]); codec != nil {
+			codec.RtcpFeedback = append(codec.RtcpFeedback, fb)
+		}
+	case "extmap":
+		fields := strings.Fields(value)
+		if len(fields) < 2 {
+			return fmt.Errorf("invalid extmap: %q", attribute)
+		}
+		// The id may carry a direction, e.g. "extmap:4/recvonly".
+		id, err := strconv.Atoi(strings.SplitN(fields[0], "/", 2)[0])
+		if err != nil {
+			return fmt.Errorf("invalid extmap: %q", attribute)
+		}
+		media.HeaderExtensions = append(media.HeaderExtensions, rtp.RtpHeaderExtensionParameters{
+			Uri: fields[1],
+			Id:  id,
+		})
+	case "ssrc":
+		fields := strings.SplitN(value, " ", 2)
+		id, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid ssrc: %q", attribute)
+		}
+		ssrc := media.ssrc(id)
+		if len(fields) > 1 && strings.HasPrefix(fields[1], "cname:") {
+			ssrc.Cname = strings.TrimPrefix(fields[1], "cname:")
+		}
+	case "ssrc-group":
+		fields := strings.Fields(value)
+		if len(fields) < 2 {
+			return fmt.Errorf("invalid ssrc-group: %q", attribute)
+		}
+		group := SsrcGroup{Semantics: fields[0]}
+		for _, field := range fields[1:] {
+			id, err := strconv.Atoi(field)
+			if err != nil {
+				return fmt.Errorf("invalid ssrc-group: %q", attribute)
+			}
+			group.Ssrcs = append(group.Ssrcs, id)
+		}
+		media.SsrcGroups = append(media.SsrcGroups, group)
+	case "rid":
+		fields := strings.Fields(value)
+		if len(fields) < 2 {
+			return fmt.Errorf("invalid rid: %q", attribute)
+		}
+		media.Rids = append(media.Rids, Rid{Id: fields[0], Direction: fields[1]})
+	case "simulcast":
+		media.Simulcast = value
+	default:
+		media.Attributes = append(media.Attributes, attribute)
+	}
+
+	return nil
+}
+
+/**
+ * Parse a fmtp value into codec parameters. Integer values are kept as
+ * numbers, but profile-level-id which is hexadecimal.
+ */
+func ParseParameters(fmtp string) rtp.ParameterMap {
+	parameters := rtp.ParameterMap{}
+	for _, pair := range strings.Split(fmtp, ";") {
+		pair = strings.TrimSpace(pair)
+		if len(pair) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) == 1 {
+			parameters[kv[0]] = ""
+			continue
+		}
+
+		if n, err := strconv.Atoi(kv[1]); err == nil && kv[0] != "profile-level-id" {
+			parameters[kv[0]] = n
+		} else {
+			parameters[kv[0]] = kv[1]
+		}
+	}
+
+	return parameters
+}
+
+func (media *Media) codec(payloadType string) *rtp.RtpCodecParameters {
+	pt, err := strconv.Atoi(payloadType)
+	if err != nil {
+		return nil
+	}
+
+	for i := range media.Codecs {
+		if media.Codecs[i].PayloadType == pt {
+			return &media.Codecs[i]
+		}
+	}
+
+	return nil
+}
+
+func (media *Media) ssrc(id int) *Ssrc {
+	for i := range media.Ssrcs {
+		if media.Ssrcs[i].Id == id {
+			return &media.Ssrcs[i]
+		}
+	}
+
+	media.Ssrcs = append(media.Ssrcs, Ssrc{Id: id})
+	return &media.Ssrcs[len(media.Ssrcs)-1]
+}
+
+func parseFingerprint(value string) (Fingerprint, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return Fingerprint{}, fmt.Errorf("invalid fingerprint: %q", value)
+	}
+
+	return Fingerprint{Algorithm: strings.ToLower(fields[0]), Value: fields[1]}, nil
+}
+
+func splitAttribute(attribute string) (string, string) {
+	kv := strings.SplitN(attribute, ":", 2)
+	if len(kv) == 1 {
+		return kv[0], ""
+	}
+
+	return kv[0], kv[1]
+}
@@ -0,0 +1,241 @@
+package sdp
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type wantMedia struct {
+	kind       string
+	mid        string
+	direction  string
+	iceUfrag   string
+	setup      string
+	cname      string
+	codecs     []string
+	extensions []string
+	rids       []string
+	simulcast  string
+	ssrcGroups []SsrcGroup
+}
+
+func codecStrings(media *Media) []string {
+	codecs := make([]string, 0, len(media.Codecs))
+	for _, codec := range media.Codecs {
+		codecs = append(codecs, fmt.Sprintf("%d %s/%d/%d", codec.PayloadType, codec.MimeType, codec.ClockRate, codec.Channels))
+	}
+	return codecs
+}
+
+func extensionStrings(media *Media) []string {
+	extensions := make([]string, 0, len(media.HeaderExtensions))
+	for _, ext := range media.HeaderExtensions {
+		extensions = append(extensions, fmt.Sprintf("%d %s", ext.Id, ext.Uri))
+	}
+	return extensions
+}
+
+func ridStrings(media *Media) []string {
+	rids := make([]string, 0, len(media.Rids))
+	for _, rid := range media.Rids {
+		rids = append(rids, rid.Id+" "+rid.Direction)
+	}
+	return rids
+}
+
+// Offers as sent by WHIP clients, OBS puts ICE and DTLS attributes at session
+// level, GStreamer writes an extmap direction and Chrome sends simulcast.
+func TestParseOffers(t *testing.T) {
+	tests := []struct {
+		file  string
+		media []wantMedia
+	}{
+		{
+			file: "offer_obs.sdp",
+			media: []wantMedia{
+				{
+					kind:       "audio",
+					mid:        "0",
+					direction:  "sendonly",
+					iceUfrag:   "RSe2",
+					setup:      "actpass",
+					cname:      "DxRv4uQRd5ZzL0Hs",
+					codecs:     []string{"111 audio/opus/48000/2"},
+					extensions: []string{},
+					rids:       []string{},
+				},
+				{
+					kind:       "video",
+					mid:        "1",
+					direction:  "sendonly",
+					iceUfrag:   "RSe2",
+					setup:      "actpass",
+					cname:      "DxRv4uQRd5ZzL0Hs",
+					codecs:     []string{"96 video/H264/90000/0"},
+					extensions: []string{},
+					rids:       []string{},
+				},
+			},
+		},
+		{
+			file: "offer_gstreamer.sdp",
+			media: []wantMedia{
+				{
+					kind:      "video",
+					mid:       "video0",
+					direction: "sendonly",
+					iceUfrag:  "Qb0wBdCrRBU3JDqI7WYpXuaSHADSmrrI",
+					setup:     "actpass",
+					cname:     "user3856769225@host-9d8b3a3",
+					codecs:    []string{"96 video/VP8/90000/0", "97 video/rtx/90000/0"},
+					extensions: []string{
+						"1 http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01",
+						"2 urn:ietf:params:rtp-hdrext:sdes:mid",
+					},
+					rids:       []string{},
+					ssrcGroups: []SsrcGroup{{Semantics: "FID", Ssrcs: []int{1349071478, 2400869430}}},
+				},
+				{
+					kind:      "audio",
+					mid:       "audio1",
+					direction: "sendonly",
+					iceUfrag:  "Qb0wBdCrRBU3JDqI7WYpXuaSHADSmrrI",
+					setup:     "actpass",
+					cname:     "user3856769225@host-9d8b3a3",
+					codecs:    []string{"0 audio/PCMU/8000/1"},
+					extensions: []string{
+						"1 http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01",
+						"2 urn:ietf:params:rtp-hdrext:sdes:mid",
+						"3 urn:ietf:params:rtp-hdrext:ssrc-audio-level",
+					},
+					rids: []string{},
+				},
+			},
+		},
+		{
+			file: "offer_chrome_simulcast.sdp",
+			media: []wantMedia{
+				{
+					kind:      "audio",
+					mid:       "0",
+					direction: "sendonly",
+					iceUfrag:  "Zs+S",
+					setup:     "actpass",
+					cname:     "ZGsMhE3ryWgmBkiK",
+					codecs: []string{
+						"111 audio/opus/48000/2",
+						"63 audio/red/48000/2",
+						"9 audio/G722/8000/1",
+						"0 audio/PCMU/8000/1",
+						"8 audio/PCMA/8000/1",
+						"13 audio/CN/8000/1",
+						"110 audio/telephone-event/48000/1",
+						"126 audio/telephone-event/8000/1",
+					},
+					extensions: []string{
+						"1 urn:ietf:params:rtp-hdrext:ssrc-audio-level",
+						"2 http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time",
+						"3 http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01",
+						"4 urn:ietf:params:rtp-hdrext:sdes:mid",
+					},
+					rids: []string{},
+				},
+				{
+					kind:      "video",
+					mid:       "1",
+					direction: "sendonly",
+					iceUfrag:  "Zs+S",
+					setup:     "actpass",
+					codecs: []string{
+						"96 video/VP8/90000/0",
+						"97 video/rtx/90000/0",
+						"102 video/H264/90000/0",
+						"103 video/rtx/90000/0",
+					},
+					extensions: []string{
+						"14 urn:ietf:params:rtp-hdrext:toffset",
+						"2 http://www.webrtc.org/experiments/rtp-hdrext/abs-send-time",
+						"13 urn:3gpp:video-orientation",
+						"3 http://www.ietf.org/id/draft-holmer-rmcat-transport-wide-cc-extensions-01",
+						"4 urn:ietf:params:rtp-hdrext:sdes:mid",
+						"10 urn:ietf:params:rtp-hdrext:sdes:rtp-stream-id",
+						"11 urn:ietf:params:rtp-hdrext:sdes:repaired-rtp-stream-id",
+					},
+					rids:      []string{"q send", "h send", "f send"},
+					simulcast: "send q;h;f",
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		text, err := ioutil.ReadFile(filepath.Join("testdata", tt.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		session, err := Parse(string(text))
+		if err != nil {
+			t.Errorf("%s: Parse() error %v", tt.file, err)
+			continue
+		}
+		if len(session.Media) != len(tt.media) {
+			t.Errorf("%s: %d media sections, want %d", tt.file, len(session.Media), len(tt.media))
+			continue
+		}
+
+		for i, want := range tt.media {
+			media := session.Media[i]
+			got := wantMedia{
+				kind:       media.Kind,
+				mid:        media.Mid,
+				direction:  media.Direction,
+				iceUfrag:   media.IceUfrag,
+				setup:      media.Setup,
+				cname:      media.Cname,
+				codecs:     codecStrings(media),
+				extensions: extensionStrings(media),
+				rids:       ridStrings(media),
+				simulcast:  media.Simulcast,
+				ssrcGroups: media.SsrcGroups,
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("%s: media %d = %+v, want %+v", tt.file, i, got, want)
+			}
+			if len(media.IcePwd) == 0 || len(media.Fingerprints) != 1 {
+				t.Errorf("%s: media %d has ice-pwd %q and %d fingerprints", tt.file, i, media.IcePwd, len(media.Fingerprints))
+			}
+		}
+	}
+}
+
+func TestParseParameters(t *testing.T) {
+	got := ParseParameters("profile-level-id=42001f; packetization-mode=1;level-asymmetry-allowed=1;111/111")
+	want := map[string]interface{}{
+		"profile-level-id":        "42001f",
+		"packetization-mode":      1,
+		"level-asymmetry-allowed": 1,
+		"111/111":                 "",
+	}
+	if !reflect.DeepEqual(map[string]interface{}(got), want) {
+		t.Errorf("ParseParameters() = %v, want %v", got, want)
+	}
+}
+
+// Trickle ICE fragments may lack media sections, only Parse requires them.
+func TestParseFragment(t *testing.T) {
+	text := "a=ice-ufrag:EsAw\r\na=ice-pwd:P2uYro0UCOQ4zxjKXaWCBui1\r\na=candidate:1 1 udp 2122260223 192.0.2.1 54400 typ host\r\n"
+	session, err := ParseFragment(text)
+	if err != nil {
+		t.Fatalf("ParseFragment() error = %v", err)
+	}
+	if session.IceUfrag != "EsAw" || len(session.Media) != 0 {
+		t.Errorf("ParseFragment() ufrag %q and %d media sections, want EsAw and none", session.IceUfrag, len(session.Media))
+	}
+	if _, err := Parse(text); err == nil {
+		t.Error("Parse() of a fragment without media sections succeeded")
+	}
+}
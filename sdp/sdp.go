@@ -0,0 +1,264 @@
+package sdp
+
+import (
+	"fmt"
+	"mediasoup-signal-controller/rtp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/**
+ * A session description, written out by String(). Session and media level
+ * attributes which are not modelled here go in Attributes, without "a=".
+ */
+type Session struct {
+	SessionId      int64
+	SessionVersion int
+	Name           string
+	Address        string
+	Attributes     []string
+	Media          []*Media
+
+	// Session level defaults of the media sections, as found in offers.
+	IceUfrag     string
+	IcePwd       string
+	Fingerprints []Fingerprint
+	Setup        string
+}
+
+type Fingerprint struct {
+	Algorithm string
+	Value     string
+}
+
+type Rid struct {
+	Id        string
+	Direction string
+}
+
+type Ssrc struct {
+	Id    int
+	Cname string
+}
+
+type SsrcGroup struct {
+	Semantics string
+	Ssrcs     []int
+}
+
+/**
+ * A media section built from RTP parameters. Port is where the media is sent
+ * to, RtcpPort (when not muxed) defaults to Port + 1 for the receiver.
+ */
+type Media struct {
+	Kind       string
+	Port       int
+	RtcpPort   int
+	RtcpMux    bool
+	Protocol   string
+	Address    string
+	Mid        string
+	Direction  string
+	Attributes []string
+
+	Codecs []rtp.RtpCodecParameters
+	// Formats of non RTP media, e.g. "webrtc-datachannel".
+	Formats          []string
+	HeaderExtensions []rtp.RtpHeaderExtensionParameters
+	Encodings        []rtp.RtpEncodingParameters
+	Cname            string
+	RtcpRsize        bool
+
+	IceUfrag     string
+	IcePwd       string
+	Fingerprints []Fingerprint
+	Setup        string
+	Candidates   []string
+
+	// Simulcast, "a=simulcast:" value and the rids it lists.
+	Rids      []Rid
+	Simulcast string
+
+	// Offered streams, Encodings are written instead.
+	Ssrcs      []Ssrc
+	SsrcGroups []SsrcGroup
+}
+
+func NewSession(address string) *Session {
+	return &Session{
+		SessionId:      time.Now().UnixNano() / int64(time.Millisecond),
+		SessionVersion: 1,
+		Name:           "-",
+		Address:        address,
+		Media:          make([]*Media, 0),
+	}
+}
+
+/**
+ * A media section sending the given RTP parameters, e.g. those of a Consumer.
+ */
+func NewMedia(kind string, rtpParameters *rtp.ClientRtpParameters) *Media {
+	media := &Media{
+		Kind:             kind,
+		Protocol:         "RTP/AVP",
+		Mid:              rtpParameters.Mid,
+		Codecs:           rtpParameters.Codecs,
+		HeaderExtensions: rtpParameters.HeaderExtensions,
+		Encodings:        rtpParameters.Encodings,
+		Cname:            rtpParameters.Rtcp.Cname,
+	}
+
+	for _, codec := range rtpParameters.Codecs {
+		if len(codec.RtcpFeedback) > 0 {
+			media.Protocol = "RTP/AVPF"
+			break
+		}
+	}
+
+	return media
+}
+
+func (session *Session) String() string {
+	var b strings.Builder
+
+	b.WriteString("v=0\r\n")
+	fmt.Fprintf(&b, "o=- %d %d IN %s %s\r\n", session.SessionId, session.SessionVersion, addrType(session.Address), session.Address)
+	fmt.Fprintf(&b, "s=%s\r\n", session.Name)
+	if len(session.Address) > 0 {
+		fmt.Fprintf(&b, "c=IN %s %s\r\n", addrType(session.Address), session.Address)
+	}
+	b.WriteString("t=0 0\r\n")
+	for _, attribute := range session.Attributes {
+		fmt.Fprintf(&b, "a=%s\r\n", attribute)
+	}
+
+	for _, media := range session.Media {
+		media.write(&b)
+	}
+
+	return b.String()
+}
+
+func (media *Media) write(b *strings.Builder) {
+	payloadTypes := make([]string, 0, len(media.Codecs))
+	for _, codec := range media.Codecs {
+		payloadTypes = append(payloadTypes, strconv.Itoa(codec.PayloadType))
+	}
+	payloadTypes = append(payloadTypes, media.Formats...)
+
+	fmt.Fprintf(b, "m=%s %d %s %s\r\n", media.Kind, media.Port, media.Protocol, strings.Join(payloadTypes, " "))
+	if len(media.Address) > 0 {
+		fmt.Fprintf(b, "c=IN %s %s\r\n", addrType(media.Address), media.Address)
+	}
+	if media.RtcpMux {
+		b.WriteString("a=rtcp-mux\r\n")
+	} else if media.RtcpPort > 0 {
+		fmt.Fprintf(b, "a=rtcp:%d\r\n", media.RtcpPort)
+	}
+	if media.RtcpRsize {
+		b.WriteString("a=rtcp-rsize\r\n")
+	}
+	if len(media.IceUfrag) > 0 {
+		fmt.Fprintf(b, "a=ice-ufrag:%s\r\n", media.IceUfrag)
+		fmt.Fprintf(b, "a=ice-pwd:%s\r\n", media.IcePwd)
+	}
+	for _, fingerprint := range media.Fingerprints {
+		fmt.Fprintf(b, "a=fingerprint:%s %s\r\n", fingerprint.Algorithm, fingerprint.Value)
+	}
+	if len(media.Setup) > 0 {
+		fmt.Fprintf(b, "a=setup:%s\r\n", media.Setup)
+	}
+	for _, candidate := range media.Candidates {
+		fmt.Fprintf(b, "a=candidate:%s\r\n", candidate)
+	}
+	if len(media.Candidates) > 0 {
+		b.WriteString("a=end-of-candidates\r\n")
+	}
+	for _, attribute := range media.Attributes {
+		fmt.Fprintf(b, "a=%s\r\n", attribute)
+	}
+	if len(media.Mid) > 0 {
+		fmt.Fprintf(b, "a=mid:%s\r\n", media.Mid)
+	}
+	if len(media.Direction) > 0 {
+		fmt.Fprintf(b, "a=%s\r\n", media.Direction)
+	}
+
+	for _, codec := range media.Codecs {
+		name := codec.MimeType[strings.Index(codec.MimeType, "/")+1:]
+		if codec.Channels > 1 {
+			fmt.Fprintf(b, "a=rtpmap:%d %s/%d/%d\r\n", codec.PayloadType, name, codec.ClockRate, codec.Channels)
+		} else {
+			fmt.Fprintf(b, "a=rtpmap:%d %s/%d\r\n", codec.PayloadType, name, codec.ClockRate)
+		}
+
+		if fmtp := FormatParameters(codec.Parameters); len(fmtp) > 0 {
+			fmt.Fprintf(b, "a=fmtp:%d %s\r\n", codec.PayloadType, fmtp)
+		}
+
+		for _, fb := range codec.RtcpFeedback {
+			if len(fb.Parameter) > 0 {
+				fmt.Fprintf(b, "a=rtcp-fb:%d %s %s\r\n", codec.PayloadType, fb.FeedbackType, fb.Parameter)
+			} else {
+				fmt.Fprintf(b, "a=rtcp-fb:%d %s\r\n", codec.PayloadType, fb.FeedbackType)
+			}
+		}
+	}
+
+	for _, ext := range media.HeaderExtensions {
+		fmt.Fprintf(b, "a=extmap:%d %s\r\n", ext.Id, ext.Uri)
+	}
+
+	for _, rid := range media.Rids {
+		fmt.Fprintf(b, "a=rid:%s %s\r\n", rid.Id, rid.Direction)
+	}
+	if len(media.Simulcast) > 0 {
+		fmt.Fprintf(b, "a=simulcast:%s\r\n", media.Simulcast)
+	}
+
+	for _, encoding := range media.Encodings {
+		if encoding.Ssrc == 0 {
+			continue
+		}
+
+		if encoding.RtxSsrc != nil && encoding.RtxSsrc.Ssrc > 0 {
+			fmt.Fprintf(b, "a=ssrc-group:FID %d %d\r\n", encoding.Ssrc, encoding.RtxSsrc.Ssrc)
+		}
+		fmt.Fprintf(b, "a=ssrc:%d cname:%s\r\n", encoding.Ssrc, media.Cname)
+		if encoding.RtxSsrc != nil && encoding.RtxSsrc.Ssrc > 0 {
+			fmt.Fprintf(b, "a=ssrc:%d cname:%s\r\n", encoding.RtxSsrc.Ssrc, media.Cname)
+		}
+	}
+}
+
+/**
+ * Format codec parameters as a fmtp value, "key=value" pairs sorted by key.
+ */
+func FormatParameters(parameters rtp.ParameterMap) string {
+	keys := make([]string, 0, len(parameters))
+	for key := range parameters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		switch value := parameters[key].(type) {
+		case float64:
+			pairs = append(pairs, fmt.Sprintf("%s=%s", key, strconv.FormatFloat(value, 'f', -1, 64)))
+		default:
+			pairs = append(pairs, fmt.Sprintf("%s=%v", key, value))
+		}
+	}
+
+	return strings.Join(pairs, ";")
+}
+
+func addrType(address string) string {
+	if strings.Contains(address, ":") {
+		return "IP6"
+	}
+	return "IP4"
+}
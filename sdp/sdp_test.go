@@ -0,0 +1,165 @@
+package sdp
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"mediasoup-signal-controller/rtp"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// checkGolden compares got with testdata/<name>.golden.sdp.
+func checkGolden(t *testing.T, name string, got string) {
+	t.Helper()
+
+	path := filepath.Join("testdata", name+".golden.sdp")
+	if *update {
+		if err := ioutil.WriteFile(path, []byte(got), 0644); err != nil {
+			t.Fatalf("write %s: %v", path, err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	if !bytes.Equal([]byte(got), want) {
+		t.Errorf("%s differs from %s:\n%s", name, path, got)
+	}
+}
+
+func opus() rtp.RtpCodecParameters {
+	return rtp.RtpCodecParameters{
+		MimeType:    "audio/opus",
+		PayloadType: 100,
+		ClockRate:   48000,
+		Channels:    2,
+		Parameters:  rtp.ParameterMap{"useinbandfec": 1, "sprop-stereo": 1, "minptime": 10},
+		RtcpFeedback: []rtp.RtcpFeedback{
+			{FeedbackType: "transport-cc"},
+		},
+	}
+}
+
+func vp8() []rtp.RtpCodecParameters {
+	return []rtp.RtpCodecParameters{
+		{
+			MimeType:    "video/VP8",
+			PayloadType: 101,
+			ClockRate:   90000,
+			Parameters:  rtp.ParameterMap{"x-google-start-bitrate": 1000},
+			RtcpFeedback: []rtp.RtcpFeedback{
+				{FeedbackType: "nack"},
+				{FeedbackType: "nack", Parameter: "pli"},
+				{FeedbackType: "ccm", Parameter: "fir"},
+				{FeedbackType: "goog-remb"},
+			},
+		},
+		{
+			MimeType:    "video/rtx",
+			PayloadType: 102,
+			ClockRate:   90000,
+			Parameters:  rtp.ParameterMap{"apt": 101},
+		},
+	}
+}
+
+func TestSessionString(t *testing.T) {
+	tests := []struct {
+		name  string
+		media func() *Media
+	}{
+		{
+			name: "audio_rtcp_mux",
+			media: func() *Media {
+				media := NewMedia("audio", &rtp.ClientRtpParameters{
+					Mid:    "0",
+					Codecs: []rtp.RtpCodecParameters{opus()},
+					HeaderExtensions: []rtp.RtpHeaderExtensionParameters{
+						{Uri: "urn:ietf:params:rtp-hdrext:sdes:mid", Id: 1},
+						{Uri: "urn:ietf:params:rtp-hdrext:ssrc-audio-level", Id: 10},
+					},
+					Encodings: []rtp.RtpEncodingParameters{{Ssrc: 11111111}},
+					Rtcp:      rtp.RtcpParameters{Cname: "audio-cname"},
+				})
+				media.Port = 40000
+				media.RtcpMux = true
+				media.Direction = "recvonly"
+				return media
+			},
+		},
+		{
+			name: "video_rtcp_port_rtx",
+			media: func() *Media {
+				media := NewMedia("video", &rtp.ClientRtpParameters{
+					Mid:       "1",
+					Codecs:    vp8(),
+					Encodings: []rtp.RtpEncodingParameters{{Ssrc: 22222222, RtxSsrc: &rtp.RtxSsrc_t{Ssrc: 33333333}}},
+					Rtcp:      rtp.RtcpParameters{Cname: "video-cname"},
+				})
+				media.Port = 40002
+				media.RtcpPort = 40005
+				media.Address = "10.0.0.2"
+				media.Direction = "recvonly"
+				return media
+			},
+		},
+		{
+			name: "video_webrtc",
+			media: func() *Media {
+				media := NewMedia("video", &rtp.ClientRtpParameters{
+					Mid:    "v",
+					Codecs: vp8(),
+					Rtcp:   rtp.RtcpParameters{Cname: "video-cname"},
+				})
+				media.Port = 9
+				media.Protocol = "UDP/TLS/RTP/SAVPF"
+				media.RtcpMux = true
+				media.RtcpRsize = true
+				media.IceUfrag = "ufrag"
+				media.IcePwd = "password"
+				media.Fingerprints = []Fingerprint{{Algorithm: "sha-256", Value: "AB:CD:EF"}}
+				media.Setup = "passive"
+				media.Candidates = []string{"1 1 udp 1076302079 10.0.0.1 40000 typ host"}
+				media.Rids = []Rid{{Id: "h", Direction: "recv"}, {Id: "l", Direction: "recv"}}
+				media.Simulcast = "recv h;l"
+				media.Direction = "recvonly"
+				return media
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		session := NewSession("10.0.0.1")
+		session.SessionId = 1
+		session.Media = append(session.Media, tt.media())
+
+		checkGolden(t, "session_"+tt.name, session.String())
+	}
+}
+
+func TestFormatParameters(t *testing.T) {
+	tests := []struct {
+		parameters rtp.ParameterMap
+		want       string
+	}{
+		{nil, ""},
+		{rtp.ParameterMap{"apt": 101}, "apt=101"},
+		{
+			rtp.ParameterMap{"profile-level-id": "42e01f", "packetization-mode": 1, "level-asymmetry-allowed": 1},
+			"level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f",
+		},
+		{rtp.ParameterMap{"usedtx": 1, "maxaveragebitrate": 0.5}, "maxaveragebitrate=0.5;usedtx=1"},
+		{rtp.ParameterMap{"x-google-max-bitrate": float64(2000)}, "x-google-max-bitrate=2000"},
+	}
+
+	for _, tt := range tests {
+		if got := FormatParameters(tt.parameters); got != tt.want {
+			t.Errorf("FormatParameters(%v) = %q, want %q", tt.parameters, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package service
+
+import (
+	"encoding/json"
+	"mediasoup-signal-controller/common"
+
+	"github.com/cloudwebrtc/go-protoo/logger"
+)
+
+type ActiveSpeakerObserver struct {
+	internal common.RtpObserverInternal
+	channel  *Channel
+	router   *Router
+}
+
+func (observer *ActiveSpeakerObserver) Id() string {
+	return observer.internal.RtpObserverId
+}
+
+func (observer *ActiveSpeakerObserver) AddProducer(producerId string) {
+	internal := &common.RtpObserverProducerInternal{
+		RtpObserverInternal: observer.internal,
+		ProducerId:          producerId,
+	}
+
+	observer.channel.Request("rtpObserver.addProducer", internal, nil, observer.router, nil, nil)
+}
+
+func (observer *ActiveSpeakerObserver) RemoveProducer(producerId string) {
+	internal := &common.RtpObserverProducerInternal{
+		RtpObserverInternal: observer.internal,
+		ProducerId:          producerId,
+	}
+
+	observer.channel.Request("rtpObserver.removeProducer", internal, nil, observer.router, nil, nil)
+}
+
+func (observer *ActiveSpeakerObserver) HandleNotification(id string, msg common.ChannelMessage) {
+	observer.router.post(func() { observer.handleNotification(id, msg) })
+}
+
+func (observer *ActiveSpeakerObserver) handleNotification(id string, msg common.ChannelMessage) {
+	switch msg.Event {
+	case "dominantspeaker":
+		var ds struct {
+			ProducerId string `json:"producerId"`
+		}
+		_ = json.Unmarshal(msg.Data, &ds)
+
+		rom := observer.router.rom
+		if rom == nil {
+			break
+		}
+
+		speaker := rom.producerToPeer[ds.ProducerId]
+		if speaker == nil {
+			logger.Errorf("dominantspeaker for unknown producer:%s", ds.ProducerId)
+			break
+		}
+
+		for _, v := range rom.peers {
+			v.Notify("activeSpeaker",
+				struct {
+					PeerId string `json:"peerId"`
+				}{
+					PeerId: speaker.Id(),
+				})
+		}
+		break
+	default:
+		logger.Errorf("ignoring unknown event: %s", msg.Event)
+		break
+	}
+}
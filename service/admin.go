@@ -0,0 +1,483 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"mediasoup-signal-controller/common"
+	"mediasoup-signal-controller/rtp"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cloudwebrtc/go-protoo/logger"
+)
+
+// AdminServer exposes worker, router and transport state to operators as JSON
+// over plain HTTP. It is meant to listen on a private address only.
+//
+//	GET /workers              resource usage and dump of every worker
+//	GET /routers              ids of the routers of all rooms
+//	GET /routers/{id}         router.dump
+//	POST /routers/{id}/plainTransports
+//	                          create a plain RTP transport, connected when the
+//	                          body has {"ip", "port", "rtcpPort"}
+//	GET /transports/{id}      transport.dump
+//	DELETE /transports/{id}   close a transport
+//	POST /transports/{id}/consume
+//	                          consume {"producerId"} on a plain transport
+//	GET /consumers/{id}/sdp   SDP of a plain transport consumer, e.g. for FFmpeg
+//	GET /supervisor           restart and probe state of every worker seq
+//	POST /supervisor/{seq}/restart
+//	                          restart a worker seq the supervisor gave up on
+//	POST /drain               drain the controller, ?deadline=<seconds>
+//	POST /workers/{pid}/drain drain a single worker, ?deadline=<seconds>
+type AdminServer struct {
+	server *Server
+	mux    *http.ServeMux
+}
+
+type WorkerStatus struct {
+	Seq           int                         `json:"seq"`
+	Pid           int                         `json:"pid"`
+	Version       string                      `json:"version"`
+	Draining      bool                        `json:"draining"`
+	ResourceUsage *common.WorkerResourceUsage `json:"resourceUsage,omitempty"`
+	RouterIds     []string                    `json:"routerIds"`
+	HandlerCounts *common.WorkerHandlerCounts `json:"handlerCounts,omitempty"`
+	Error         string                      `json:"error,omitempty"`
+}
+
+func CreateNewAdminServer(server *Server) *AdminServer {
+	admin := &AdminServer{
+		server: server,
+		mux:    http.NewServeMux(),
+	}
+
+	admin.mux.HandleFunc("/workers", admin.handleWorkers)
+	admin.mux.HandleFunc("/workers/", admin.handleWorkerDrain)
+	admin.mux.HandleFunc("/drain", admin.handleDrain)
+	admin.mux.HandleFunc("/supervisor", admin.handleSupervisor)
+	admin.mux.HandleFunc("/supervisor/", admin.handleSupervisorRestart)
+	admin.mux.HandleFunc("/routers", admin.handleRouters)
+	admin.mux.HandleFunc("/routers/", admin.handleRouter)
+	admin.mux.HandleFunc("/transports/", admin.handleTransport)
+	admin.mux.HandleFunc("/consumers/", admin.handleConsumer)
+
+	return admin
+}
+
+func (admin *AdminServer) Handler() http.Handler {
+	return admin.mux
+}
+
+func (admin *AdminServer) Run(listenIp string, listenPort int) {
+	addr := fmt.Sprintf("%s:%d", listenIp, listenPort)
+	logger.Infof("Admin server listening on %s", addr)
+
+	go func() {
+		err := http.ListenAndServe(addr, admin.mux)
+		if err != nil {
+			logger.Errorf("Admin server stopped: %s", err.Error())
+		}
+	}()
+}
+
+func (admin *AdminServer) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	_ = encoder.Encode(data)
+}
+
+func (admin *AdminServer) writeError(w http.ResponseWriter, status int, err string) {
+	admin.writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{
+		Error: err,
+	})
+}
+
+func (admin *AdminServer) handleWorkers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		admin.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	statuses := make([]WorkerStatus, 0)
+	for _, worker := range admin.server.Workers() {
+		status := WorkerStatus{
+			Seq:       worker.seq,
+			Pid:       worker.Pid,
+			Version:   worker.Version.String(),
+			Draining:  worker.Draining(),
+			RouterIds: make([]string, 0),
+		}
+
+		usage, err := worker.GetResourceUsage()
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			status.ResourceUsage = usage
+		}
+
+		dump, err := worker.Dump()
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			counts := dump.HandlerCounts()
+			status.RouterIds = append(status.RouterIds, dump.RouterIds...)
+			status.HandlerCounts = &counts
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	admin.writeJSON(w, http.StatusOK, statuses)
+}
+
+func (admin *AdminServer) handleSupervisor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		admin.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	admin.writeJSON(w, http.StatusOK, admin.server.Supervision())
+}
+
+func (admin *AdminServer) handleSupervisorRestart(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		admin.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/supervisor/"), "/")
+	if len(parts) != 2 || parts[1] != "restart" {
+		admin.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	seq, err := strconv.Atoi(parts[0])
+	if err != nil {
+		admin.writeError(w, http.StatusBadRequest, "invalid seq")
+		return
+	}
+
+	if !admin.server.RestartWorker(seq) {
+		admin.writeError(w, http.StatusConflict, fmt.Sprintf("worker seq:%d is not failed", seq))
+		return
+	}
+
+	admin.writeJSON(w, http.StatusOK, struct {
+		Seq int `json:"seq"`
+	}{
+		Seq: seq,
+	})
+}
+
+func (admin *AdminServer) drainDeadline(r *http.Request) (time.Duration, error) {
+	value := r.URL.Query().Get("deadline")
+	if len(value) == 0 {
+		return admin.server.DrainTimeout(), nil
+	}
+
+	seconds, err := strconv.Atoi(value)
+	if err != nil || seconds <= 0 {
+		return 0, fmt.Errorf("invalid deadline %s", value)
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func (admin *AdminServer) handleDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		admin.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	deadline, err := admin.drainDeadline(r)
+	if err != nil {
+		admin.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	admin.server.Drain(deadline)
+	admin.writeJSON(w, http.StatusOK, struct {
+		Rooms    int    `json:"rooms"`
+		Deadline string `json:"deadline"`
+	}{
+		Rooms:    admin.server.RoomCount(),
+		Deadline: deadline.String(),
+	})
+}
+
+func (admin *AdminServer) handleWorkerDrain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		admin.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/workers/"), "/")
+	if len(parts) != 2 || parts[1] != "drain" {
+		admin.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	pid, err := strconv.Atoi(parts[0])
+	if err != nil {
+		admin.writeError(w, http.StatusBadRequest, "invalid pid")
+		return
+	}
+
+	deadline, err := admin.drainDeadline(r)
+	if err != nil {
+		admin.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !admin.server.DrainWorker(pid, deadline) {
+		admin.writeError(w, http.StatusNotFound, "worker not found")
+		return
+	}
+
+	admin.writeJSON(w, http.StatusOK, struct {
+		Pid      int    `json:"pid"`
+		Deadline string `json:"deadline"`
+	}{
+		Pid:      pid,
+		Deadline: deadline.String(),
+	})
+}
+
+func (admin *AdminServer) handleRouters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		admin.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	routerIds := make([]string, 0)
+	for _, router := range admin.server.Routers() {
+		routerIds = append(routerIds, router.Id())
+	}
+
+	admin.writeJSON(w, http.StatusOK, routerIds)
+}
+
+func (admin *AdminServer) handleRouter(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/routers/"), "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "plainTransports") {
+		admin.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	router := admin.server.GetRouterById(parts[0])
+	if router == nil {
+		admin.writeError(w, http.StatusNotFound, "router not found")
+		return
+	}
+
+	router.lock()
+	defer router.unlock()
+
+	if router.closed {
+		admin.writeError(w, http.StatusNotFound, "router not found")
+		return
+	}
+
+	if len(parts) == 2 {
+		admin.handleCreatePlainTransport(w, r, router)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		admin.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	dump, err := router.Dump()
+	if err != nil {
+		admin.writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	admin.writeJSON(w, http.StatusOK, dump)
+}
+
+func (admin *AdminServer) handleCreatePlainTransport(w http.ResponseWriter, r *http.Request, router *Router) {
+	if r.Method != http.MethodPost {
+		admin.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var params struct {
+		RtcpMux  bool   `json:"rtcpMux"`
+		Comedia  bool   `json:"comedia"`
+		Ip       string `json:"ip"`
+		Port     int    `json:"port"`
+		RtcpPort int    `json:"rtcpPort"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		admin.writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	if len(params.Ip) > 0 && params.Port <= 0 {
+		admin.writeError(w, http.StatusBadRequest, "missing port")
+		return
+	}
+
+	transport, err := router.CreatePlainTransport(&common.PlainTransportOptions{
+		PlainTransportOptions: admin.server.Conf.Mediasoup.PlainTransportOptions,
+		RtcpMux:               params.RtcpMux,
+		Comedia:               params.Comedia,
+		AppData: common.TransportAppData{
+			Consuming: true,
+		},
+	})
+	if err != nil {
+		admin.writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	if len(params.Ip) > 0 {
+		err = transport.Connect(params.Ip, params.Port, params.RtcpPort)
+		if err != nil {
+			transport.Close()
+			admin.writeError(w, http.StatusBadGateway, err.Error())
+			return
+		}
+	}
+
+	admin.writeJSON(w, http.StatusOK, transport.Data())
+}
+
+func (admin *AdminServer) handleTransport(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/transports/"), "/")
+	if len(parts) > 2 || (len(parts) == 2 && parts[1] != "consume") {
+		admin.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	transport, router := admin.server.GetTransportById(parts[0])
+	if transport == nil {
+		admin.writeError(w, http.StatusNotFound, "transport not found")
+		return
+	}
+
+	router.lock()
+	defer router.unlock()
+
+	// Closed since it was looked up.
+	if router.transports[parts[0]] != transport {
+		admin.writeError(w, http.StatusNotFound, "transport not found")
+		return
+	}
+
+	if len(parts) == 2 {
+		admin.handleConsume(w, r, transport)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		transport.Close()
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		admin.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	dump, err := transport.Dump()
+	if err != nil {
+		admin.writeError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+
+	admin.writeJSON(w, http.StatusOK, dump)
+}
+
+func (admin *AdminServer) handleConsume(w http.ResponseWriter, r *http.Request, transport TransportBase) {
+	if r.Method != http.MethodPost {
+		admin.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	plainTransport, ok := transport.(*PlainTransport)
+	if !ok {
+		admin.writeError(w, http.StatusBadRequest, "not a plain transport")
+		return
+	}
+
+	var params struct {
+		ProducerId string `json:"producerId"`
+		Paused     bool   `json:"paused"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		admin.writeError(w, http.StatusBadRequest, "invalid body: "+err.Error())
+		return
+	}
+
+	consumer, err := plainTransport.Consume(params.ProducerId, params.Paused)
+	if err != nil {
+		admin.writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	admin.writeJSON(w, http.StatusOK, struct {
+		Id            string                  `json:"id"`
+		ProducerId    string                  `json:"producerId"`
+		Kind          string                  `json:"kind"`
+		RtpParameters rtp.ClientRtpParameters `json:"rtpParameters"`
+	}{
+		Id:            consumer.internal.ConsumerId,
+		ProducerId:    params.ProducerId,
+		Kind:          consumer.data.kind,
+		RtpParameters: consumer.data.rtpParameters,
+	})
+}
+
+func (admin *AdminServer) handleConsumer(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		admin.writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/consumers/"), "/")
+	if len(parts) != 2 || parts[1] != "sdp" {
+		admin.writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	consumer, transport, router := admin.server.GetConsumerById(parts[0])
+	if consumer == nil {
+		admin.writeError(w, http.StatusNotFound, "consumer not found")
+		return
+	}
+
+	router.lock()
+	defer router.unlock()
+
+	if transport.getConsumer(parts[0]) != consumer {
+		admin.writeError(w, http.StatusNotFound, "consumer not found")
+		return
+	}
+
+	plainTransport, ok := transport.(*PlainTransport)
+	if !ok {
+		admin.writeError(w, http.StatusBadRequest, "not a plain transport consumer")
+		return
+	}
+
+	description, err := plainTransport.ConsumerSdp(parts[0])
+	if err != nil {
+		admin.writeError(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/sdp")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(description))
+}
@@ -2,8 +2,11 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"mediasoup-signal-controller/common"
 	"net"
+	"sync"
 	"time"
 
 	"github.com/cloudwebrtc/go-protoo/logger"
@@ -48,7 +51,7 @@ func createChannelSendMessage(id int, method string, channel *Channel, router *R
 	return sent
 }
 func (csm *ChannelSendMessage) OnTimeout() {
-	delete(csm.channel.sents, csm.Id)
+	csm.channel.takeSent(csm.Id)
 }
 
 type Channel struct {
@@ -67,7 +70,11 @@ type Channel struct {
 
 	listeners map[string]interface{}
 
-	nextId int
+	nextId         int
+	lengthPrefixed bool
+	mutex          sync.Mutex
+	recorder       *ChannelRecorder
+	closed         bool
 }
 
 type ChannelHandler struct {
@@ -112,17 +119,21 @@ func CreateNewChannel(producerPath string, consumerPath string) *Channel {
 
 func (chn *Channel) SetListener(worker *Worker) { chn.listener = worker }
 
+func (chn *Channel) SetLengthPrefixed(lengthPrefixed bool) { chn.lengthPrefixed = lengthPrefixed }
+
+func (chn *Channel) SetRecorder(recorder *ChannelRecorder) { chn.recorder = recorder }
+
 func (chn *Channel) Start() {
 	chn.puss.StartServer()
 	chn.cuss.StartServer()
 }
 func (chn *Channel) Remove(cnh *ChannelHandler) {
-	logger.Infof("Before remove handler size:%d, %d", chn.puss.Handlers.Len(), chn.cuss.Handlers.Len())
+	logger.Infof("Before remove handler size:%d, %d", chn.puss.HandlerCount(), chn.cuss.HandlerCount())
 
-	chn.puss.Handlers.Remove(cnh.Pos)
-	chn.cuss.Handlers.Remove(cnh.Pos)
+	chn.puss.RemoveHandler(cnh.Pos)
+	chn.cuss.RemoveHandler(cnh.Pos)
 
-	logger.Infof("Afer Remove handler size:%d, %d", chn.puss.Handlers.Len(), chn.cuss.Handlers.Len())
+	logger.Infof("Afer Remove handler size:%d, %d", chn.puss.HandlerCount(), chn.cuss.HandlerCount())
 }
 
 func (chn *Channel) Stop(value interface{}) {
@@ -139,7 +150,7 @@ func (chn *Channel) Send(value interface{}, data []byte) (int, error) {
 func (chn *Channel) HandleUnixConn(c *net.UnixConn, uss *common.UnixSocketServer) {
 	logger.Errorf("Channel.HandleUnixConn: %s", uss.FileName)
 	handler := newChannelHandler(c, chn, uss.FileName)
-	handler.Pos = uss.Handlers.PushBack(handler)
+	handler.Pos = uss.AddHandler(handler)
 
 	go handler.Loop()
 }
@@ -153,10 +164,9 @@ func (cnh *ChannelHandler) Loop() {
 
 	cnh.Conn.SetReadDeadline(time.Now().Add(common.PongWait))
 	for {
-		if !cnh.Running {
+		if !cnh.IsRunning() {
 			logger.Infof("----------------ChannelHandler exit")
 			cnh.Conn.Close()
-			cnh.Conn = nil
 			return
 		}
 
@@ -186,10 +196,10 @@ func (cnh *ChannelHandler) Loop() {
 
 		//data handle
 		//logger.Infof("=============Receive data:%d, %s", nlen, buf)
-		data := append(cnh.Buffer, buf...)
-		rlen := cnh.UdListener.RecvData(data, nlen)
+		data := append(cnh.Buffer, buf[:nlen]...)
+		rlen := cnh.UdListener.RecvData(data, len(data))
 
-		cnh.Buffer = data[rlen:nlen]
+		cnh.Buffer = data[rlen:]
 
 		//logger.Infof("data len:%d", len(cnh.Buffer))
 		//time.Sleep(time.Duration(10) * time.Second)
@@ -197,55 +207,87 @@ func (cnh *ChannelHandler) Loop() {
 }
 
 func (cnh *ChannelHandler) Stop() {
-	cnh.Running = false
+	cnh.UnixSocketHandler.Stop()
 	cnh.Conn.Close()
 }
 
 func (chn *Channel) RecvData(buffer []byte, nsize int) int {
 	//logger.Infof("Receive data len: %d", nsize)
 	pos := 0
-	for {
-		payload, nlen := common.NsPayload(buffer, pos)
+	for pos < nsize {
+		var payload []byte
+		var nlen, mlen int
+
+		if chn.lengthPrefixed {
+			payload, nlen = common.LpPayload(buffer[:nsize], pos)
+			mlen = common.LpHeaderLength + nlen
+		} else {
+			payload, nlen = common.NsPayload(buffer[:nsize], pos)
+			mlen = common.NsWriteLength(nlen)
+		}
 
-		switch payload[0] {
-		case 123: // 123 = {'s ascii
-			if payload != nil {
-				var cm common.ChannelMessage
-				err := json.Unmarshal(payload, &cm)
-				if err != nil {
-					logger.Errorf("%s", err.Error())
-				}
-				chn.processMessage(cm)
+		if nlen == -1 {
+			// Wait for the rest of the message.
+			if nsize-pos > common.LpMaxMessageLength {
+				logger.Errorf("channel message too big, dropping %d bytes", nsize-pos)
+				return nsize
+			}
+			return pos
+		} else if payload == nil {
+			logger.Errorf("invalid channel message framing, dropping %d bytes", nsize-pos)
+			return nsize
+		}
 
-				pos += common.NsWriteLength(nlen)
+		pos += mlen
+		if len(payload) == 0 {
+			continue
+		}
 
-				//logger.Infof("%d, str:%s, pos:%d", nlen, string(payload), pos)
-				if pos >= nsize {
-					return pos
+		switch payload[0] {
+		case '{':
+			var cm common.ChannelMessage
+			err := json.Unmarshal(payload, &cm)
+			if err != nil {
+				logger.Errorf("%s", err.Error())
+				break
+			}
+			if chn.recorder != nil {
+				if cm.Id > 0 {
+					chn.recorder.Record(RecordResponse, payload)
+				} else {
+					chn.recorder.Record(RecordNotification, payload)
 				}
-			} else if nlen == -1 {
-				logger.Infof("RecvData end -1")
-				return 0
-			} else {
-				logger.Infof("RecvData end:%d", nsize-pos)
-				return nsize - pos
 			}
-			break
-		case 68:
-		case 87:
-		case 69:
-			logger.Errorf("%s", string(payload))
-			return nsize
-		case 88:
+			chn.processMessage(cm)
+		case 'D', 'X', 'W', 'E':
+			if chn.listener != nil && chn.listener.log != nil {
+				chn.listener.log.Log("channel", string(payload), "debug")
+				break
+			}
+			switch payload[0] {
+			case 'W':
+				logger.Warnf("%s", string(payload[1:]))
+			case 'E':
+				logger.Errorf("%s", string(payload[1:]))
+			default:
+				logger.Debugf("%s", string(payload[1:]))
+			}
 		default:
-			logger.Infof("RecvData end -1")
-			return 0
+			logger.Errorf("unexpected data: %s", string(payload))
 		}
 	}
+
+	return pos
 }
 
 func (chn *Channel) Request(method string, internal interface{}, reqData interface{}, router *Router, accept AcceptFunc, reject RejectFunc) (int, error) {
 
+	chn.mutex.Lock()
+	if chn.closed {
+		chn.mutex.Unlock()
+		return 0, errors.New("Channel closed")
+	}
+
 	if chn.nextId < 4294967295 {
 		chn.nextId++
 	} else {
@@ -259,60 +301,140 @@ func (chn *Channel) Request(method string, internal interface{}, reqData interfa
 		Data:     reqData,
 	}
 
+	// Register the request before writing it, the response may arrive before
+	// Write returns.
+	chn.sents[request.Id] = createChannelSendMessage(request.Id, method, chn, router, accept, reject)
+	chn.mutex.Unlock()
+
 	data, _ := json.Marshal(request)
+	if chn.recorder != nil {
+		chn.recorder.Record(RecordRequest, data)
+	}
 	//logger.Debugf("Channel Request:len:%d, data:%s", len(data), string(data))
 
-	ns, _ := common.NsWrite(data, 0, len(data))
+	var ns []byte
+	if chn.lengthPrefixed {
+		ns = common.LpWrite(data)
+	} else {
+		ns, _ = common.NsWrite(data, 0, len(data)-1)
+	}
 	//logger.Debugf("Channel Request nlen:%d,nstring:%s to %s", slen, string(ns), chn.cuss.FileName)
 	sent, err := chn.cuss.Write(ns)
 
 	if err != nil {
 		logger.Errorf("Channel %p sent failed: %s", chn, err.Error())
+		if chn.takeSent(request.Id) == nil {
+			// Already rejected by Close.
+			return request.Id, nil
+		}
 		return -1, err
 	}
 
 	logger.Debugf("Channel Request sent: %d", sent)
 
-	chn.sents[request.Id] = createChannelSendMessage(request.Id, method, chn, router, accept, reject)
-
 	return request.Id, err
 }
 
+// RequestWithTimeout is Request giving up on the response after timeout, the
+// request is then dropped and rejected with 408.
+func (chn *Channel) RequestWithTimeout(method string, internal interface{}, reqData interface{}, router *Router, timeout time.Duration, accept AcceptFunc, reject RejectFunc) (int, error) {
+	id, err := chn.Request(method, internal, reqData, router, accept, reject)
+	if err != nil || id <= 0 {
+		return id, err
+	}
+
+	time.AfterFunc(timeout, func() {
+		if sent := chn.takeSent(id); sent != nil {
+			logger.Warnf("request timed out [method:%s, id:%d]", sent.Method, sent.Id)
+			if sent.reject != nil {
+				sent.reject(408, fmt.Sprintf("no response within %s", timeout))
+			}
+		}
+	})
+
+	return id, nil
+}
+
 func (chn *Channel) AddRouter(id string, router *Router) {
+	chn.mutex.Lock()
+	defer chn.mutex.Unlock()
+
 	chn.routerIdToRouter[id] = router
 }
 
 func (chn *Channel) RemoveRouter(id string) {
-	chn.routerIdToRouter[id] = nil
+	chn.mutex.Lock()
+	defer chn.mutex.Unlock()
+
+	delete(chn.routerIdToRouter, id)
 }
 
 func (chn *Channel) AddProducer(id string, router *Router) {
 	logger.Debugf("=============add producer:%s==========", id)
+
+	chn.mutex.Lock()
+	defer chn.mutex.Unlock()
+
 	chn.producerToRouter[id] = router
 }
 
 func (chn *Channel) RemoveProducer(id string) {
-	chn.producerToRouter[id] = nil
+	chn.mutex.Lock()
+	defer chn.mutex.Unlock()
+
+	delete(chn.producerToRouter, id)
 }
 
 func (chn *Channel) AddTransport(id string, router *Router) {
+	chn.mutex.Lock()
+	defer chn.mutex.Unlock()
+
 	chn.tranportToRouter[id] = router
 }
 
 func (chn *Channel) RemoveTransport(id string) {
-	chn.tranportToRouter[id] = nil
+	chn.mutex.Lock()
+	defer chn.mutex.Unlock()
+
+	delete(chn.tranportToRouter, id)
 }
 
 func (chn *Channel) AddListener(id string, listener interface{}) {
+	chn.mutex.Lock()
+	defer chn.mutex.Unlock()
+
 	chn.listeners[id] = listener
 }
 
 func (chn *Channel) RemoveListener(id string) {
+	chn.mutex.Lock()
+	defer chn.mutex.Unlock()
+
 	delete(chn.listeners, id)
 }
 
+// Close rejects every pending request and stops listening, the worker on the
+// other side is gone.
 func (chn *Channel) Close() {
+	chn.mutex.Lock()
+	if chn.closed {
+		chn.mutex.Unlock()
+		return
+	}
+	chn.closed = true
+	sents := chn.sents
+	chn.sents = make(map[int]*ChannelSendMessage)
+	chn.mutex.Unlock()
+
+	for _, sent := range sents {
+		logger.Warnf("request aborted, channel closed [method:%s, id:%d]", sent.Method, sent.Id)
+		if sent.reject != nil {
+			sent.reject(500, "Channel closed")
+		}
+	}
 
+	chn.puss.Stop()
+	chn.cuss.Stop()
 }
 
 // else if len(msg.Event) > 0 && msg.Event == "score" {
@@ -331,37 +453,45 @@ func (chn *Channel) Close() {
 // 	}
 // 	//} else if len(msg.Event) > 0 && msg.Event == "producerpause" {
 // }
+func (chn *Channel) takeSent(id int) *ChannelSendMessage {
+	chn.mutex.Lock()
+	defer chn.mutex.Unlock()
+
+	sent := chn.sents[id]
+	delete(chn.sents, id)
+	return sent
+}
+
 func (chn *Channel) processMessage(msg common.ChannelMessage) {
 	//logger.Infof("enter channel.processMessage")
 	if msg.Id > 0 {
-		sent := chn.sents[msg.Id]
+		sent := chn.takeSent(msg.Id)
 
 		if sent == nil {
 			logger.Errorf("received response does not match any sent request [id:%d]", msg.Id)
 			return
 		}
 
-		if msg.Accepted && sent.Method != "method:dataProducer.getStats" && sent.Method != "method:transport.getStats" {
+		if msg.Accepted {
 			logger.Debugf("request succeeded [method:%s, id:%d]", sent.Method, sent.Id)
 
-			if chn.sents[msg.Id].accept != nil {
-				chn.sents[msg.Id].accept(msg)
+			if sent.accept != nil {
+				sent.accept(msg)
 			}
-
-			delete(chn.sents, msg.Id)
 			return
 		} else if len(msg.ErrorInfo) > 0 {
 			logger.Warnf("request failed [method:%s, id:%d]: %s", sent.Method, sent.Id, msg.Reason)
 
-			if chn.sents[msg.Id].reject != nil {
-				chn.sents[msg.Id].reject(400, msg.ErrorInfo)
+			if sent.reject != nil {
+				sent.reject(400, msg.ErrorInfo)
 			}
-
-			delete(chn.sents, msg.Id)
 		}
 	} else if len(msg.Event) > 0 {
 		logger.Debugf("targetID:%s,event:%s,data:%s", msg.TargetId, msg.Event, string(msg.Data))
+		chn.mutex.Lock()
 		object := chn.listeners[msg.TargetId]
+		chn.mutex.Unlock()
+
 		if object != nil {
 			consumer, ok := object.(*Consumer)
 			if ok {
@@ -380,17 +510,24 @@ func (chn *Channel) processMessage(msg common.ChannelMessage) {
 				router.HandleNotification(msg.TargetId, msg)
 				return
 			}
+
+			observer, ok := object.(*ActiveSpeakerObserver)
+			if ok {
+				observer.HandleNotification(msg.TargetId, msg)
+				return
+			}
+
+			plainTransport, ok := object.(*PlainTransport)
+			if ok {
+				plainTransport.HandleNotification(msg.TargetId, msg)
+				return
+			}
+		}
+
+		// Notifications for the worker itself ("running") target its pid.
+		if chn.listener != nil {
+			chn.listener.HandleMessage(msg, "Channel")
 		}
-	} else if len(msg.TargetId) > 0 && len(msg.Event) > 0 {
-		// Due to how Promises work, it may happen that we receive a response
-		// from the worker followed by a notification from the worker. If we
-		// emit the notification immediately it may reach its target **before**
-		// the response, destroying the ordered delivery. So we must wait a bit
-		// here.
-		// See https://github.com/versatica/mediasoup/issues/510
-		//setImmediate(() => this.emit(msg.targetId, msg.event, msg.data));
-		logger.Debugf("targetID:%s,event:%s, %s", msg.TargetId, msg.Event, string(msg.Data))
-		chn.listener.HandleMessage(msg, "Channel")
 	} else {
 		logger.Errorf("received message is not a response nor a notification")
 	}
@@ -23,22 +23,30 @@ type Consumer struct {
 	appData        interface{}
 	paused         bool
 	producerPaused bool
-	score          int
+	score          common.ConsumerScore
+	closed         bool
 	router         *Router
+	transport      *Transport
 }
 
 func (consumer *Consumer) HandleNotification(id string, msg common.ChannelMessage) {
+	consumer.router.post(func() { consumer.handleNotification(id, msg) })
+}
+
+func (consumer *Consumer) handleNotification(id string, msg common.ChannelMessage) {
 	switch msg.Event {
-	case "transportclose":
-		break
-	case "producerclose":
+	case "transportclose", "producerclose":
+		consumer.close()
 		break
 	case "producerpause":
 		break
 	case "producerresume":
 		break
 	case "score":
-		consumer.peer.peer.Notify("consumerScore",
+		if consumer.peer == nil {
+			break
+		}
+		consumer.peer.Notify("consumerScore",
 			struct {
 				Id    string          `json:"consumerId"`
 				Score json.RawMessage `json:"score"`
@@ -61,7 +69,10 @@ func (consumer *Consumer) HandleNotification(id string, msg common.ChannelMessag
 		_ = json.Unmarshal(msg.Data, &llc)
 
 		logger.Debugf("=============Consumer notify:consumerLayersChanged:id=%s,spatial=%d,temporal=%d", id, llc.SpatialLayer, llc.TemporalLayer)
-		consumer.peer.peer.Notify("consumerLayersChanged",
+		if consumer.peer == nil {
+			break
+		}
+		consumer.peer.Notify("consumerLayersChanged",
 			struct {
 				Id            string `json:"consumerId"`
 				SpatialLayer  int    `json:"spatialLayer"`
@@ -78,6 +89,29 @@ func (consumer *Consumer) HandleNotification(id string, msg common.ChannelMessag
 	}
 }
 
+// close drops a consumer the worker closed along with its transport or its
+// producer, and tells its peer.
+func (consumer *Consumer) close() {
+	if consumer.closed {
+		return
+	}
+	consumer.closed = true
+
+	consumer.channel.RemoveListener(consumer.internal.ConsumerId)
+	if consumer.transport != nil {
+		delete(consumer.transport.consumers, consumer.internal.ConsumerId)
+	}
+
+	if consumer.peer != nil {
+		delete(consumer.peer.consumers, consumer.internal.ConsumerId)
+		consumer.peer.Notify("consumerClosed", struct {
+			ConsumerId string `json:"consumerId"`
+		}{
+			ConsumerId: consumer.internal.ConsumerId,
+		})
+	}
+}
+
 func (consumer *Consumer) getStats() json.RawMessage {
 	return consumer.router.getConsumerStats(&consumer.internal)
 }
@@ -18,6 +18,8 @@ type DataProducer struct {
 	channel        *Channel
 	PayloadChannel *PayloadChannel
 	AppData        json.RawMessage
+	router         *Router
+	closed         bool
 }
 
 func (dataProducer *DataProducer) Id() string {
@@ -27,3 +29,13 @@ func (dataProducer *DataProducer) Id() string {
 func (dataProducer *DataProducer) Label() string {
 	return dataProducer.data.label
 }
+
+func (dataProducer *DataProducer) transportClosed() {
+	if dataProducer.closed {
+		return
+	}
+	dataProducer.closed = true
+
+	dataProducer.channel.RemoveListener(dataProducer.Id())
+	dataProducer.router.OnDataProducerClose(dataProducer)
+}
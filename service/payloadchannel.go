@@ -59,12 +59,12 @@ func (chn *PayloadChannel) Start() {
 	chn.cuss.StartServer()
 }
 func (chn *PayloadChannel) Remove(cnh *PayloadChannelHandler) {
-	logger.Infof("Before remove handler size:%d, %d", chn.puss.Handlers.Len(), chn.cuss.Handlers.Len())
+	logger.Infof("Before remove handler size:%d, %d", chn.puss.HandlerCount(), chn.cuss.HandlerCount())
 
-	chn.puss.Handlers.Remove(cnh.Pos)
-	chn.cuss.Handlers.Remove(cnh.Pos)
+	chn.puss.RemoveHandler(cnh.Pos)
+	chn.cuss.RemoveHandler(cnh.Pos)
 
-	logger.Infof("Afer Remove handler size:%d, %d", chn.puss.Handlers.Len(), chn.cuss.Handlers.Len())
+	logger.Infof("Afer Remove handler size:%d, %d", chn.puss.HandlerCount(), chn.cuss.HandlerCount())
 }
 
 func (chn *PayloadChannel) Stop(value interface{}) {
@@ -80,7 +80,7 @@ func (chn *PayloadChannel) Send(value interface{}, data []byte) (int, error) {
 func (chn *PayloadChannel) HandleUnixConn(c *net.UnixConn, uss *common.UnixSocketServer) {
 	logger.Errorf("Channel.HandleUnixConn: %p", c)
 	handler := newPayloadChannelHandler(c, chn)
-	handler.Pos = uss.Handlers.PushBack(handler)
+	handler.Pos = uss.AddHandler(handler)
 
 	//c.SetReadDeadline(time.Now().Add(time.Millisecond * 100))
 	go handler.Loop()
@@ -96,9 +96,8 @@ func (cnh *PayloadChannelHandler) Loop() {
 	cnh.Conn.SetReadDeadline(time.Now().Add(common.PongWait))
 
 	for {
-		if !cnh.Running {
+		if !cnh.IsRunning() {
 			cnh.Conn.Close()
-			cnh.Conn = nil
 			return
 		}
 
@@ -113,7 +112,7 @@ func (cnh *PayloadChannelHandler) Loop() {
 				continue
 			}
 
-			logger.Errorf("socket errr: %s,%d", err.Error(), ok)
+			logger.Errorf("socket errr: %s,%t", err.Error(), ok)
 
 			cnh.UdListener.(*PayloadChannel).Remove(cnh)
 			return
@@ -178,7 +177,8 @@ func (chn *PayloadChannel) RecvData(buffer []byte, nsize int) int {
 }
 
 func (chn *PayloadChannel) Close() {
-
+	chn.puss.Stop()
+	chn.cuss.Stop()
 }
 
 func (chn *PayloadChannel) processMessage(msg common.ChannelMessage) {
@@ -186,16 +186,16 @@ func (chn *PayloadChannel) processMessage(msg common.ChannelMessage) {
 		sent := chn.sents[msg.Id]
 
 		if sent == nil {
-			logger.Errorf("received response does not match any sent request [id:%s]", msg.Id)
+			logger.Errorf("received response does not match any sent request [id:%d]", msg.Id)
 			return
 		}
 
 		if msg.Accepted && sent.Method != "method:dataProducer.getStats" && sent.Method != "method:transport.getStats" {
-			logger.Debugf("request succeeded [method:%s, id:%s]", sent.Method, sent.Id)
+			logger.Debugf("request succeeded [method:%s, id:%d]", sent.Method, sent.Id)
 			delete(chn.sents, msg.Id)
 			return
 		} else if len(msg.ErrorInfo) > 0 {
-			logger.Warnf("request failed [method:%s, id:%s]: %s", sent.Method, sent.Id, msg.Reason)
+			logger.Warnf("request failed [method:%s, id:%d]: %s", sent.Method, sent.Id, msg.Reason)
 
 			if msg.ErrorInfo == "TypeEror" {
 				return
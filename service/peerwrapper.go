@@ -25,7 +25,7 @@ type PeerInfos struct {
 type PeerData struct {
 	PeerInfo
 	SctpCapabilities common.SctpCapabilities_t `json:"sctpCapabilities"`
-	RtpCapabilities  rtp.RtpCapabilities_In    `json:"rtpCapabilities"`
+	RtpCapabilities  rtp.RtpCapabilities       `json:"rtpCapabilities"`
 }
 
 type PeerWrapper struct {
@@ -37,3 +37,35 @@ type PeerWrapper struct {
 	dataProducers map[string]*DataProducer
 	dataConsumers map[string]*DataConsumer
 }
+
+func (prw *PeerWrapper) Id() string {
+	return prw.data.Id
+}
+
+// Notify sends a protoo notification to the peer. Peers publishing or playing
+// over WHIP/WHEP have no protoo peer and are not notified.
+func (prw *PeerWrapper) Notify(method string, data interface{}) {
+	if prw.peer == nil {
+		return
+	}
+
+	prw.peer.Notify(method, data)
+}
+
+// consuming tells whether the peer has a transport to receive media on.
+func (prw *PeerWrapper) consuming() bool {
+	for _, v := range prw.transports {
+		if transport, ok := v.(*WebRtcTransport); ok && transport.appData.Consuming {
+			return true
+		}
+	}
+
+	return false
+}
+
+// webRtcTransport is the WebRTC transport of the peer with the given id, nil
+// if there is none.
+func (prw *PeerWrapper) webRtcTransport(transportId string) *WebRtcTransport {
+	transport, _ := prw.transports[transportId].(*WebRtcTransport)
+	return transport
+}
@@ -0,0 +1,178 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"mediasoup-signal-controller/common"
+	"mediasoup-signal-controller/sdp"
+
+	"github.com/cloudwebrtc/go-protoo/logger"
+)
+
+// PlainTransport sends and receives plain RTP, e.g. to feed FFmpeg or
+// GStreamer with the media of a room.
+type PlainTransport struct {
+	Transport
+
+	data common.PlainTransportData
+}
+
+func createPlainTransport(internal *common.RTCTransportInternal, data json.RawMessage,
+	channel *Channel, payloadChannel *PayloadChannel, router *Router, appData common.TransportAppData) *PlainTransport {
+
+	transport := &PlainTransport{
+		Transport: Transport{
+			router:              router,
+			closed:              false,
+			channel:             channel,
+			payloadChannel:      payloadChannel,
+			internal:            *internal,
+			nextMidForConsumers: 0,
+			appData:             appData,
+		},
+	}
+
+	transport.producers = make(map[string]*Producer)
+	transport.consumers = make(map[string]*Consumer)
+	transport.dataConsumers = make(map[string]*DataConsumer)
+	transport.dataProducers = make(map[string]*DataProducer)
+
+	_ = json.Unmarshal(data, &transport.data)
+	transport.data.Id = internal.TransportId
+
+	return transport
+}
+
+func (pt *PlainTransport) Id() string {
+	return pt.internal.TransportId
+}
+
+func (pt *PlainTransport) Data() common.PlainTransportData {
+	return pt.data
+}
+
+func (pt *PlainTransport) Close() {
+	if pt.closed {
+		return
+	}
+
+	pt.channel.Request("transport.close", pt.internal, nil, pt.router, nil, nil)
+	pt.close()
+
+	pt.router.OnTransportClose(pt)
+}
+
+func (pt *PlainTransport) routerClosed() {
+	if pt.closed {
+		return
+	}
+
+	pt.close()
+}
+
+func (pt *PlainTransport) close() {
+	pt.closed = true
+
+	pt.channel.RemoveListener(pt.Id())
+	pt.channel.RemoveTransport(pt.Id())
+	pt.closeChildren()
+}
+
+// Connect sets the remote address media is sent to. rtcpPort is ignored with
+// rtcpMux and defaults to port + 1 otherwise.
+func (pt *PlainTransport) Connect(ip string, port int, rtcpPort int) error {
+	if pt.data.RtcpMux {
+		rtcpPort = 0
+	} else if rtcpPort == 0 {
+		rtcpPort = port + 1
+	}
+
+	fb, err := pt.router.ConnectPlainTransport(&common.PlainTransportConnectData{
+		Ip:       ip,
+		Port:     port,
+		RtcpPort: rtcpPort,
+	}, &pt.internal)
+	if err != nil {
+		return err
+	}
+
+	pt.data.Tuple = fb.Tuple
+	if fb.RtcpTuple != nil {
+		pt.data.RtcpTuple = fb.RtcpTuple
+	}
+	if fb.SrtpParameters != nil {
+		pt.data.SrtpParameters = fb.SrtpParameters
+	}
+
+	return nil
+}
+
+// Consume consumes a producer of the router with the router capabilities, so
+// any producer can be sent.
+func (pt *PlainTransport) Consume(producerId string, paused bool) (*Consumer, error) {
+	if !pt.router.CanConsume(producerId, pt.router.rtpCapabilities) {
+		return nil, errors.New("cannot consume producer")
+	}
+
+	return pt.consume(nil, producerId, pt.router.rtpCapabilities, paused, false, "")
+}
+
+// ConsumerSdp describes the RTP sent by one of the consumers of the transport
+// to its remote address, for tools like FFmpeg to receive it.
+func (pt *PlainTransport) ConsumerSdp(consumerId string) (string, error) {
+	consumer := pt.consumers[consumerId]
+	if consumer == nil {
+		return "", errors.New("consumer not found")
+	}
+
+	if len(pt.data.Tuple.RemoteIp) == 0 || pt.data.Tuple.RemotePort == 0 {
+		return "", errors.New("transport is not connected")
+	}
+
+	media := sdp.NewMedia(consumer.data.kind, &consumer.data.rtpParameters)
+	media.Port = pt.data.Tuple.RemotePort
+	media.RtcpMux = pt.data.RtcpMux
+	if pt.data.RtcpTuple != nil {
+		media.RtcpPort = pt.data.RtcpTuple.RemotePort
+	}
+	media.Direction = "sendonly"
+
+	session := sdp.NewSession(pt.data.Tuple.RemoteIp)
+	session.Media = append(session.Media, media)
+
+	return session.String(), nil
+}
+
+func (pt *PlainTransport) Dump() (json.RawMessage, error) {
+	return pt.router.dump("transport.dump", &pt.internal)
+}
+
+func (pt *PlainTransport) HandleNotification(id string, msg common.ChannelMessage) {
+	pt.router.post(func() { pt.handleNotification(id, msg) })
+}
+
+func (pt *PlainTransport) handleNotification(id string, msg common.ChannelMessage) {
+	switch msg.Event {
+	case "tuple":
+		var data struct {
+			Tuple common.TransportTuple `json:"tuple"`
+		}
+		_ = json.Unmarshal(msg.Data, &data)
+
+		pt.data.Tuple = data.Tuple
+		break
+	case "rtcptuple":
+		var data struct {
+			RtcpTuple common.TransportTuple `json:"rtcpTuple"`
+		}
+		_ = json.Unmarshal(msg.Data, &data)
+
+		pt.data.RtcpTuple = &data.RtcpTuple
+		break
+	case "sctpstatechange", "trace":
+		break
+	default:
+		logger.Errorf("ignoring unknown event: %s", msg.Event)
+		break
+	}
+}
@@ -19,6 +19,7 @@ type Producer struct {
 	payloadChannel *PayloadChannel
 	appData        interface{}
 	paused         bool
+	closed         bool
 	data           *ProducerProperty
 	router         *Router
 	PeerInfo       *PeerWrapper
@@ -34,16 +35,30 @@ func (producer *Producer) Id() string {
 	return producer.internal.ProducerId
 }
 
+func (producer *Producer) transportClosed() {
+	if producer.closed {
+		return
+	}
+	producer.closed = true
+
+	producer.channel.RemoveListener(producer.id)
+	producer.channel.RemoveProducer(producer.id)
+	producer.router.OnProducerClose(producer)
+	if producer.PeerInfo != nil {
+		delete(producer.PeerInfo.producers, producer.id)
+	}
+}
+
 func (producer *Producer) OnNotify(method string, data interface{}) {
 
-	producer.PeerInfo.peer.Notify(method, data)
+	producer.PeerInfo.Notify(method, data)
 }
 
 func (producer *Producer) HandleNotification(id string, msg common.ChannelMessage) {
 
 	switch msg.Event {
 	case "score":
-		producer.PeerInfo.peer.Notify("producerScore",
+		producer.PeerInfo.Notify("producerScore",
 			struct {
 				Id   string          `json:"consumerId"`
 				Data json.RawMessage `json:"score"`
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"mediasoup-signal-controller/common"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cloudwebrtc/go-protoo/logger"
+)
+
+const (
+	RecordRequest      = "request"
+	RecordResponse     = "response"
+	RecordNotification = "notification"
+)
+
+// One line of a channel capture file.
+type ChannelRecord struct {
+	Time      time.Time       `json:"time"`
+	Seq       int             `json:"seq"`
+	Pid       int             `json:"pid"`
+	Direction string          `json:"direction"`
+	Message   json.RawMessage `json:"message"`
+}
+
+// ChannelRecorder writes every request, response and notification going
+// through a worker Channel as timestamped JSONL.
+type ChannelRecorder struct {
+	mutex sync.Mutex
+	file  *os.File
+	seq   int
+	pid   int
+}
+
+// CreateNewChannelRecorder opens the capture file of worker seq. It is created
+// before the worker process is started so nothing it sends is missed, SetPid
+// adds the pid once known.
+func CreateNewChannelRecorder(dir string, seq int) (*ChannelRecorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("channel_%d_%s.jsonl", seq, time.Now().Format("20060102T150405"))
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Infof("Recording worker seq:%d channel to %s", seq, file.Name())
+
+	return &ChannelRecorder{
+		file: file,
+		seq:  seq,
+	}, nil
+}
+
+// SetPid stamps the following records with pid and renames the capture file
+// to channel_<seq>_<pid>_<time>.jsonl.
+func (rec *ChannelRecorder) SetPid(pid int) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	rec.pid = pid
+	if rec.file == nil {
+		return
+	}
+
+	dir, name := filepath.Split(rec.file.Name())
+	renamed := filepath.Join(dir, strings.Replace(name, fmt.Sprintf("channel_%d_", rec.seq), fmt.Sprintf("channel_%d_%d_", rec.seq, pid), 1))
+	if err := os.Rename(rec.file.Name(), renamed); err != nil {
+		logger.Warnf("Channel capture rename failed: %s", err.Error())
+	}
+}
+
+func (rec *ChannelRecorder) Record(direction string, message []byte) {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	if rec.file == nil {
+		return
+	}
+
+	line, err := json.Marshal(&ChannelRecord{
+		Time:      time.Now(),
+		Seq:       rec.seq,
+		Pid:       rec.pid,
+		Direction: direction,
+		Message:   message,
+	})
+	if err != nil {
+		logger.Errorf("Channel record failed: %s", err.Error())
+		return
+	}
+
+	rec.file.Write(append(line, '\n'))
+}
+
+func (rec *ChannelRecorder) Close() {
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	if rec.file != nil {
+		rec.file.Close()
+		rec.file = nil
+	}
+}
+
+func ReadChannelCapture(path string) ([]ChannelRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	records := make([]ChannelRecord, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 65536), common.LpMaxMessageLength)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record ChannelRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, line, err.Error())
+		}
+		records = append(records, record)
+	}
+
+	return records, scanner.Err()
+}
+
+type ReplayReport struct {
+	Requests      int
+	Accepted      int
+	Rejected      int
+	Notifications int
+	Pending       []string
+}
+
+// Replay feeds captured traffic back through processMessage. Requests are
+// registered as if they had been sent so their responses are matched the same
+// way they were in production. With realtime set, the original pacing between
+// messages is kept.
+func (chn *Channel) Replay(records []ChannelRecord, realtime bool) *ReplayReport {
+	report := &ReplayReport{}
+	methods := make(map[int]string)
+
+	for i, record := range records {
+		if realtime && i > 0 {
+			time.Sleep(record.Time.Sub(records[i-1].Time))
+		}
+
+		switch record.Direction {
+		case RecordRequest:
+			var request struct {
+				Id     int    `json:"id"`
+				Method string `json:"method"`
+			}
+			_ = json.Unmarshal(record.Message, &request)
+
+			report.Requests++
+			methods[request.Id] = request.Method
+
+			chn.mutex.Lock()
+			chn.sents[request.Id] = createChannelSendMessage(request.Id, request.Method, chn, nil,
+				func(result common.ChannelMessage) {
+					report.Accepted++
+					delete(methods, result.Id)
+				},
+				func(code int, err string) {
+					report.Rejected++
+					delete(methods, request.Id)
+				})
+			chn.mutex.Unlock()
+
+		case RecordResponse, RecordNotification:
+			var msg common.ChannelMessage
+			if err := json.Unmarshal(record.Message, &msg); err != nil {
+				logger.Errorf("Replay skips invalid message: %s", err.Error())
+				continue
+			}
+
+			if record.Direction == RecordNotification {
+				report.Notifications++
+			}
+			chn.processMessage(msg)
+		}
+	}
+
+	for id, method := range methods {
+		report.Pending = append(report.Pending, fmt.Sprintf("%s [id:%d]", method, id))
+	}
+
+	return report
+}
@@ -0,0 +1,62 @@
+package service
+
+import (
+	"io/ioutil"
+	"mediasoup-signal-controller/common"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Received messages are recorded the way the worker sent them, fields the
+// controller does not know about included.
+func TestChannelRecordsRawPayload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recorder, err := CreateNewChannelRecorder(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder.SetPid(1234)
+
+	chn := CreateNewChannel(filepath.Join(dir, "p"), filepath.Join(dir, "c"))
+	chn.SetLengthPrefixed(true)
+	chn.SetRecorder(recorder)
+
+	payloads := []string{
+		`{"targetId":"1234","event":"running","extra":{"b":1,"a":2}}`,
+		`{"id":7,"accepted":true,"data":{"z":true}}`,
+	}
+	buffer := make([]byte, 0)
+	for _, payload := range payloads {
+		buffer = append(buffer, common.LpWrite([]byte(payload))...)
+	}
+	if n := chn.RecvData(buffer, len(buffer)); n != len(buffer) {
+		t.Fatalf("RecvData() = %d, want %d", n, len(buffer))
+	}
+	recorder.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "channel_3_1234_*.jsonl"))
+	if len(files) != 1 {
+		t.Fatalf("capture files %v, want one channel_3_1234_*.jsonl", files)
+	}
+	records, err := ReadChannelCapture(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != len(payloads) {
+		t.Fatalf("%d records, want %d", len(records), len(payloads))
+	}
+
+	directions := []string{RecordNotification, RecordResponse}
+	for i, record := range records {
+		if string(record.Message) != payloads[i] || record.Direction != directions[i] || record.Pid != 1234 || record.Seq != 3 {
+			t.Errorf("record %d = %s %s pid:%d seq:%d, want %s %s pid:1234 seq:3",
+				i, record.Direction, record.Message, record.Pid, record.Seq, directions[i], payloads[i])
+		}
+	}
+}
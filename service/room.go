@@ -2,9 +2,12 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"mediasoup-signal-controller/common"
 	"mediasoup-signal-controller/conf"
-	"mediasoup-signal-controller/rtp"
+	"sync"
+	"sync/atomic"
 
 	"github.com/cloudwebrtc/go-protoo/logger"
 	"github.com/cloudwebrtc/go-protoo/peer"
@@ -12,17 +15,34 @@ import (
 	"github.com/cloudwebrtc/go-protoo/transport"
 )
 
+var errRoomClosed = errors.New("room closed")
+
 type Room struct {
+	server         *Server
 	cf             *conf.Config
 	roomId         string
 	protooRoom     *room.Room
 	router         *Router
 	peers          map[string]*PeerWrapper
 	producerToPeer map[string]*PeerWrapper
+
+	activeSpeakerObserver *ActiveSpeakerObserver
+
+	// Guards the peers, their media and the router. Exported methods take
+	// it, the unexported ones expect it to be held.
+	mutex  sync.Mutex
+	closed int32
+
+	// Worker notifications waiting for the room, see post.
+	eventMutex  sync.Mutex
+	events      []func()
+	eventSignal chan struct{}
+	done        chan struct{}
 }
 
-func CreateNewRoom(cf *conf.Config, worker *Worker, roomId string) *Room {
+func CreateNewRoom(server *Server, cf *conf.Config, worker *Worker, roomId string) (*Room, error) {
 	rom := &Room{
+		server:     server,
 		cf:         cf,
 		roomId:     roomId,
 		protooRoom: nil,
@@ -32,22 +52,149 @@ func CreateNewRoom(cf *conf.Config, worker *Worker, roomId string) *Room {
 	rom.protooRoom = room.NewRoom(roomId)
 	rom.peers = make(map[string]*PeerWrapper)
 	rom.producerToPeer = make(map[string]*PeerWrapper)
+	rom.eventSignal = make(chan struct{}, 1)
+	rom.done = make(chan struct{})
+
+	router, err := worker.CreateRouter(rom)
+	if err != nil {
+		return nil, err
+	}
+	rom.router = router
+
+	// Create a mediasoup ActiveSpeakerObserver.
+	if cf.Mediasoup.RouterOptions.ActiveSpeakerObserver != nil {
+		rom.activeSpeakerObserver = rom.router.CreateActiveSpeakerObserver(cf.Mediasoup.RouterOptions.ActiveSpeakerObserver.Interval)
+	}
+
+	go rom.runEvents()
+
+	return rom, nil
+}
+
+// post runs fn with the room locked on the room's event goroutine, in order.
+// Worker notifications are handled this way: they arrive on the channel
+// reader, which must not wait for the room as its holder may be waiting for
+// a response only the reader can deliver.
+func (rom *Room) post(fn func()) {
+	rom.eventMutex.Lock()
+	rom.events = append(rom.events, fn)
+	rom.eventMutex.Unlock()
+
+	select {
+	case rom.eventSignal <- struct{}{}:
+	default:
+	}
+}
+
+func (rom *Room) runEvents() {
+	for {
+		select {
+		case <-rom.done:
+			return
+		case <-rom.eventSignal:
+		}
+
+		rom.eventMutex.Lock()
+		events := rom.events
+		rom.events = nil
+		rom.eventMutex.Unlock()
+
+		rom.mutex.Lock()
+		for _, fn := range events {
+			if rom.Closed() {
+				break
+			}
+			fn()
+		}
+		rom.mutex.Unlock()
+	}
+}
+
+// Closed reports whether the room has been closed, it is safe to call
+// without the room lock.
+func (rom *Room) Closed() bool {
+	return atomic.LoadInt32(&rom.closed) == 1
+}
+
+// ResetMedia replaces the room router with a new one on worker. All media
+// state of the peers is dropped, they are notified with "mediaReset" and
+// reconnect by creating new transports and producing again, consumers are
+// created as their receive transports come back. The room is left as it was
+// when worker does not create the router.
+func (rom *Room) ResetMedia(worker *Worker, reason string) error {
+	rom.mutex.Lock()
+	defer rom.mutex.Unlock()
+
+	if rom.Closed() {
+		return nil
+	}
+
+	router, err := worker.CreateRouter(rom)
+	if err != nil {
+		return err
+	}
+	rom.router = router
+
+	rom.activeSpeakerObserver = nil
+	if rom.cf.Mediasoup.RouterOptions.ActiveSpeakerObserver != nil {
+		rom.activeSpeakerObserver = rom.router.CreateActiveSpeakerObserver(rom.cf.Mediasoup.RouterOptions.ActiveSpeakerObserver.Interval)
+	}
+
+	rom.producerToPeer = make(map[string]*PeerWrapper)
+	for peerId, prw := range rom.peers {
+		// WHIP/WHEP sessions cannot be renegotiated, their clients start over.
+		if prw.peer == nil {
+			delete(rom.peers, peerId)
+			continue
+		}
 
-	rom.router = worker.CreateRouter(rom)
-	// Create a mediasoup AudioObserver
+		prw.transports = make(map[string]interface{})
+		prw.producers = make(map[string]*Producer)
+		prw.consumers = make(map[string]*Consumer)
+		prw.dataProducers = make(map[string]*DataProducer)
+		prw.dataConsumers = make(map[string]*DataConsumer)
 
-	return rom
+		prw.Notify("mediaReset", common.MediaResetData{
+			Reason:                reason,
+			RouterRtpCapabilities: rom.router.rtpCapabilities,
+		})
+	}
+
+	return nil
 }
 
+// CreatePeer registers a protoo peer for peerId, replacing any peer already
+// connected with it. It returns nil when the room closed meanwhile, the caller
+// gets a new room then.
 func (rom *Room) CreatePeer(peerId string, transport *transport.WebSocketTransport) *peer.Peer {
+	rom.mutex.Lock()
+	defer rom.mutex.Unlock()
+
+	if rom.Closed() {
+		return nil
+	}
 
-	pr := rom.protooRoom.GetPeer(peerId)
-	if pr != nil {
-		rom.protooRoom.RemovePeer(peerId)
-		pr.Close()
+	if old := rom.peers[peerId]; old != nil {
 		logger.Warnf("there is already a protoo Peer with same peerId, closing it [peerId:%s]", peerId)
+		delete(rom.peers, peerId)
+		rom.dropPeer(old)
+		if old.peer != nil {
+			old.peer.Close()
+		}
+	}
+	pr := peer.NewPeer(peerId, transport)
+
+	// Registered right away, the room does not close under a peer which has
+	// not sent its first request yet.
+	rom.peers[peerId] = &PeerWrapper{
+		peer:          pr,
+		data:          PeerData{PeerInfo: PeerInfo{Id: peerId}},
+		transports:    make(map[string]interface{}),
+		producers:     make(map[string]*Producer),
+		consumers:     make(map[string]*Consumer),
+		dataProducers: make(map[string]*DataProducer),
+		dataConsumers: make(map[string]*DataConsumer),
 	}
-	pr = peer.NewPeer(peerId, transport)
 
 	return pr
 }
@@ -63,8 +210,38 @@ func (rom *Room) NotifyAll(method string, data interface{}) {
 	}
 }
 
+func (rom *Room) NotifyPeers(method string, data interface{}) {
+	rom.mutex.Lock()
+	defer rom.mutex.Unlock()
+
+	for _, prw := range rom.peers {
+		prw.Notify(method, data)
+	}
+}
+
 func (rom *Room) Close() {
+	rom.mutex.Lock()
+	defer rom.mutex.Unlock()
+
+	rom.close()
+}
+
+func (rom *Room) close() {
+	if !atomic.CompareAndSwapInt32(&rom.closed, 0, 1) {
+		return
+	}
+	close(rom.done)
+
+	for _, prw := range rom.peers {
+		if prw.peer != nil {
+			prw.peer.Close()
+		}
+	}
 	rom.protooRoom.Close()
+
+	if rom.router != nil {
+		rom.router.Close()
+	}
 }
 
 func (rom *Room) HandleProtooConnection(peerId string, transport *transport.WebSocketTransport) {
@@ -75,18 +252,18 @@ func (rom *Room) HandleProtooRequest(pr *peer.Peer, request peer.Request, accept
 	method := request.Method
 	logger.Debugf("%s", string(request.Data))
 
-	peerWapper := rom.peers[pr.ID()]
-	if peerWapper == nil {
-		peerWapper = &PeerWrapper{
-			peer: pr,
-		}
-		rom.peers[pr.ID()] = peerWapper
+	rom.mutex.Lock()
+	defer rom.mutex.Unlock()
 
-		peerWapper.transports = make(map[string]interface{})
-		peerWapper.producers = make(map[string]*Producer)
-		peerWapper.consumers = make(map[string]*Consumer)
-		peerWapper.dataProducers = make(map[string]*DataProducer)
-		peerWapper.dataConsumers = make(map[string]*DataConsumer)
+	if rom.Closed() {
+		reject(410, "Room closed")
+		return
+	}
+
+	peerWapper := rom.peers[pr.ID()]
+	if peerWapper == nil || peerWapper.peer != pr {
+		reject(403, "Peer not in room")
+		return
 	}
 
 	switch method {
@@ -132,20 +309,7 @@ func (rom *Room) HandleProtooRequest(pr *peer.Peer, request peer.Request, accept
 			}
 		}
 
-		for _, v := range joinedPeers {
-			logger.Debugf("===============notify peer:%s to peer:%s================", peerWapper.peer.ID(), v.peer.ID())
-
-			v.peer.Notify("newPeer",
-				struct {
-					Id          string   `json:"id"`
-					DisplayName string   `json:"displayName"`
-					Device      Device_t `json:"device"`
-				}{
-					Id:          peerWapper.peer.ID(),
-					DisplayName: peerWapper.data.DisplayName,
-					Device:      peerWapper.data.Device,
-				})
-		}
+		rom.notifyNewPeer(peerWapper)
 		break
 	case "createWebRtcTransport":
 		// data = {"forceTcp":false,"producing":true,"consuming":false,"sctpCapabilities":{"numStreams":{"OS":1024,"MIS":1024}}}
@@ -155,7 +319,7 @@ func (rom *Room) HandleProtooRequest(pr *peer.Peer, request peer.Request, accept
 			return
 		}
 
-		logger.Debugf("=========createWebRtcTransport:add transport for peer:%s", peerWapper.peer.ID())
+		logger.Debugf("=========createWebRtcTransport:add transport for peer:%s", peerWapper.Id())
 		peerWapper.transports[transport.Id()] = transport
 		wrta := common.WebRtcTransportAccept{
 			Id:             transport.data.Id,
@@ -165,12 +329,32 @@ func (rom *Room) HandleProtooRequest(pr *peer.Peer, request peer.Request, accept
 			SctpParameter:  transport.data.SctpParameter,
 		}
 		accept(wrta)
+
+		// A joined peer recreating its receive transport (after "mediaReset")
+		// gets the producers which are already back.
+		if peerWapper.data.Joined && transport.appData.Consuming {
+			for _, otherPeer := range rom.getJoindPeers() {
+				if otherPeer == peerWapper {
+					continue
+				}
+				for _, producer := range otherPeer.producers {
+					rom.CreateConsumer(peerWapper, otherPeer, producer)
+				}
+			}
+		}
 		break
 	case "connectWebRtcTransport":
 		logger.Infof("receive connectWebRtcTransport============")
 		var cwrtd common.ConnectWebRtcTransportData
-		_ = json.Unmarshal(request.Data, &cwrtd)
-		transport := peerWapper.transports[cwrtd.TransportId].(*WebRtcTransport)
+		if err := json.Unmarshal(request.Data, &cwrtd); err != nil {
+			reject(400, "invalid request: "+err.Error())
+			break
+		}
+		transport := peerWapper.webRtcTransport(cwrtd.TransportId)
+		if transport == nil {
+			reject(404, fmt.Sprintf("transport with id %q not found", cwrtd.TransportId))
+			break
+		}
 		transport.connect(&cwrtd.DtlsParameters)
 		rom.router.channel.AddTransport(cwrtd.TransportId, rom.router)
 		accept(common.NilAccept{})
@@ -179,32 +363,34 @@ func (rom *Room) HandleProtooRequest(pr *peer.Peer, request peer.Request, accept
 		break
 	case "produce":
 		logger.Infof("receive produce============")
+		if !peerWapper.data.Joined {
+			reject(403, "Peer not yet joined")
+			break
+		}
+
 		var pd common.ClientProduceData
-		_ = json.Unmarshal(request.Data, &pd)
+		if err := json.Unmarshal(request.Data, &pd); err != nil {
+			reject(400, "invalid request: "+err.Error())
+			break
+		}
 
-		transport := peerWapper.transports[pd.TransportId].(*WebRtcTransport)
+		transport := peerWapper.webRtcTransport(pd.TransportId)
 		if transport == nil {
-			reject(400, "No transport existed")
+			reject(404, fmt.Sprintf("transport with id %q not found", pd.TransportId))
+			break
+		}
+		producer, err := transport.produce(peerWapper, &pd, "", false, 5000)
+		if err != nil {
+			logger.Warnf("produce of peer %s rejected: %s", peerWapper.Id(), err.Error())
+			reject(400, err.Error())
+			break
 		}
-		peerWapper := rom.peers[pr.ID()]
-		producer := transport.produce(peerWapper, &pd, "", false, 5000)
-		rom.router.channel.AddProducer(producer.id, rom.router)
-		peerWapper.producers[producer.id] = producer
-		rom.producerToPeer[producer.id] = peerWapper
 		logger.Infof("produce id :%s========================", producer.id)
 		accept(common.ProduceResp{
 			Id: producer.Id(),
 		})
 
-		// create consumer
-
-		logger.Debugf("==========room peer number:%d===========", len(rom.peers))
-		for _, otherPeer := range rom.peers {
-			logger.Debugf("==========otherPeer:%s,peer:%s===========", otherPeer.peer.ID(), peerWapper.peer.ID())
-			if otherPeer.peer.ID() != peerWapper.peer.ID() {
-				rom.CreateConsumer(otherPeer, peerWapper, producer)
-			}
-		}
+		rom.addProducer(peerWapper, producer)
 		break
 	case "closeProducer":
 		break
@@ -226,16 +412,26 @@ func (rom *Room) HandleProtooRequest(pr *peer.Peer, request peer.Request, accept
 		var pdd common.ProduceDataData
 
 		if !peerWapper.data.Joined {
-			logger.Errorf("Peer not yet joined")
+			reject(403, "Peer not yet joined")
+			break
+		}
+		if err := json.Unmarshal(request.Data, &pdd); err != nil {
+			reject(400, "invalid request: "+err.Error())
+			break
 		}
-		_ = json.Unmarshal(request.Data, &pdd)
 
-		transport := peerWapper.transports[pdd.TransportId].(*WebRtcTransport)
+		transport := peerWapper.webRtcTransport(pdd.TransportId)
 		if transport == nil {
-			reject(400, "No transport existed")
+			reject(404, fmt.Sprintf("transport with id %q not found", pdd.TransportId))
+			break
 		}
 
-		dataProducer := transport.produceData(&pdd)
+		dataProducer, err := transport.produceData(&pdd)
+		if err != nil {
+			logger.Warnf("produceData of peer %s rejected: %s", peerWapper.Id(), err.Error())
+			reject(400, err.Error())
+			break
+		}
 		peerWapper.dataProducers[dataProducer.Id()] = dataProducer
 
 		accept(common.DataProduceResp{
@@ -245,7 +441,7 @@ func (rom *Room) HandleProtooRequest(pr *peer.Peer, request peer.Request, accept
 		switch dataProducer.Label() {
 		case "chat":
 			for _, otherPeer := range rom.peers {
-				if otherPeer.peer.ID() != peerWapper.peer.ID() {
+				if otherPeer.Id() != peerWapper.Id() {
 					rom.CreateDataConsumer(otherPeer, peerWapper, dataProducer)
 				}
 			}
@@ -266,8 +462,15 @@ func (rom *Room) HandleProtooRequest(pr *peer.Peer, request peer.Request, accept
 		}
 
 		var transportStatReq TransportStatReq
-		_ = json.Unmarshal(request.Data, &transportStatReq)
+		if err := json.Unmarshal(request.Data, &transportStatReq); err != nil {
+			reject(400, "invalid request: "+err.Error())
+			break
+		}
 		transport := peerWapper.transports[transportStatReq.TransportId]
+		if transport == nil {
+			reject(404, fmt.Sprintf("transport with id %q not found", transportStatReq.TransportId))
+			break
+		}
 
 		wrt, ok := transport.(*WebRtcTransport)
 		if ok {
@@ -288,9 +491,16 @@ func (rom *Room) HandleProtooRequest(pr *peer.Peer, request peer.Request, accept
 		}
 
 		var psr ProducerStatReq
-		_ = json.Unmarshal(request.Data, &psr)
+		if err := json.Unmarshal(request.Data, &psr); err != nil {
+			reject(400, "invalid request: "+err.Error())
+			break
+		}
 
 		producer := peerWapper.producers[psr.ProducerId]
+		if producer == nil {
+			reject(404, fmt.Sprintf("producer with id %q not found", psr.ProducerId))
+			break
+		}
 
 		stats := producer.getStats()
 		accept(stats)
@@ -302,9 +512,16 @@ func (rom *Room) HandleProtooRequest(pr *peer.Peer, request peer.Request, accept
 		}
 
 		var csr ConsumerStatReq
-		_ = json.Unmarshal(request.Data, &csr)
+		if err := json.Unmarshal(request.Data, &csr); err != nil {
+			reject(400, "invalid request: "+err.Error())
+			break
+		}
 
-		consumer := peerWapper.producers[csr.ConsumerId]
+		consumer := peerWapper.consumers[csr.ConsumerId]
+		if consumer == nil {
+			reject(404, fmt.Sprintf("consumer with id %q not found", csr.ConsumerId))
+			break
+		}
 
 		stats := consumer.getStats()
 		accept(stats)
@@ -342,6 +559,47 @@ func (rom *Room) HandleProtooRequest(pr *peer.Peer, request peer.Request, accept
 	}
 }
 
+// addProducer registers a new producer of prw and has the other peers of the
+// room consume it.
+func (rom *Room) addProducer(prw *PeerWrapper, producer *Producer) {
+	rom.router.channel.AddProducer(producer.id, rom.router)
+	prw.producers[producer.id] = producer
+	rom.producerToPeer[producer.id] = prw
+
+	if producer.data.kind == "audio" && rom.activeSpeakerObserver != nil {
+		rom.activeSpeakerObserver.AddProducer(producer.id)
+	}
+
+	logger.Debugf("==========room peer number:%d===========", len(rom.peers))
+	for _, otherPeer := range rom.peers {
+		logger.Debugf("==========otherPeer:%s,peer:%s===========", otherPeer.Id(), prw.Id())
+		if otherPeer.Id() != prw.Id() {
+			rom.CreateConsumer(otherPeer, prw, producer)
+		}
+	}
+}
+
+// notifyNewPeer tells the joined peers about prw.
+func (rom *Room) notifyNewPeer(prw *PeerWrapper) {
+	for _, v := range rom.getJoindPeers() {
+		if v == prw {
+			continue
+		}
+		logger.Debugf("===============notify peer:%s to peer:%s================", prw.Id(), v.Id())
+
+		v.Notify("newPeer",
+			struct {
+				Id          string   `json:"id"`
+				DisplayName string   `json:"displayName"`
+				Device      Device_t `json:"device"`
+			}{
+				Id:          prw.Id(),
+				DisplayName: prw.data.DisplayName,
+				Device:      prw.data.Device,
+			})
+	}
+}
+
 func (rom *Room) GetProducerbyId(producerId string) *Producer {
 	peer := rom.producerToPeer[producerId]
 	if peer == nil {
@@ -359,7 +617,7 @@ func (rom *Room) NotifyByProducer(method string, producerId string, resp interfa
 		return
 	}
 
-	peer.peer.Notify(method, resp)
+	peer.Notify(method, resp)
 	//rom.Notify(peer.peer, method, resp)
 }
 
@@ -375,28 +633,40 @@ func (rom *Room) HandleNotification(pr *peer.Peer, notification map[string]inter
 
 func (rom *Room) CreateConsumer(consumerPeer *PeerWrapper, producerPeer *PeerWrapper, producer *Producer) {
 
-	logger.Debugf("==========CreateConsumer peer:%s,transport len:%d=========", consumerPeer.peer.ID(), len(consumerPeer.transports))
-	for _, v := range consumerPeer.transports {
-		if transport, ok := v.(*WebRtcTransport); ok {
+	logger.Debugf("==========CreateConsumer peer:%s,transport len:%d=========", consumerPeer.Id(), len(consumerPeer.transports))
 
-			codecs := make([]interface{}, 0)
-			for _, c := range consumerPeer.data.RtpCapabilities.Codecs {
-				codecs = append(codecs, c)
-			}
-			rtpCap := rtp.RtpCapabilities{
-				Codecs:           codecs,
-				HeaderExtensions: consumerPeer.data.RtpCapabilities.HeaderExtensions,
-				FecMechanisms:    consumerPeer.data.RtpCapabilities.FecMechanisms,
-			}
-			consumer := transport.consume(consumerPeer, producer.id, rtpCap, false, false)
-			if consumer == nil {
+	// Nothing to consume on, e.g. a WHIP publisher. WHEP viewers only get
+	// the consumers negotiated in their offer.
+	if consumerPeer.peer == nil || !consumerPeer.consuming() {
+		return
+	}
+
+	rtpCap := consumerPeer.data.RtpCapabilities
+
+	if !rom.router.CanConsume(producer.id, rtpCap) {
+		logger.Warnf("peer %s cannot consume producer %s", consumerPeer.Id(), producer.id)
+
+		if producerPeer != nil {
+			producerPeer.Notify("producerNotConsumable", common.ProducerNotConsumableData{
+				ProducerId: producer.id,
+				PeerId:     consumerPeer.Id(),
+			})
+		}
+		return
+	}
+
+	for _, v := range consumerPeer.transports {
+		if transport, ok := v.(*WebRtcTransport); ok && transport.appData.Consuming {
+			consumer, err := transport.consume(consumerPeer, producer.id, rtpCap, false, false, "")
+			if err != nil {
+				logger.Errorf("consume of producer %s for peer %s failed: %s", producer.id, consumerPeer.Id(), err.Error())
 				break
 			}
 
 			consumerPeer.consumers[consumer.internal.ConsumerId] = consumer
-			if producerPeer != nil {
+			if producerPeer != nil && consumerPeer.peer != nil {
 				consumerPeer.peer.Request("newConsumer", common.NewConsumerData{
-					PeerId:         producerPeer.peer.ID(),
+					PeerId:         producerPeer.Id(),
 					ProducerId:     producer.id,
 					Id:             consumer.internal.ConsumerId,
 					Kind:           consumer.data.kind,
@@ -404,7 +674,7 @@ func (rom *Room) CreateConsumer(consumerPeer *PeerWrapper, producerPeer *PeerWra
 					ConsumerType:   consumer.data.consumerType,
 					ProducerPaused: consumer.producerPaused,
 					AppData: common.NewConsumerAppData{
-						PeerId: producerPeer.peer.ID(),
+						PeerId: producerPeer.Id(),
 					},
 				},
 					func(result json.RawMessage) {
@@ -446,8 +716,56 @@ func (rom *Room) CreateDataConsumer(dataConsumerPeer *PeerWrapper, dataProducerP
 
 }
 
+// HandleClose drops the peer and its transports, the room is closed with its
+// last peer.
 func (rom *Room) HandleClose(pr *peer.Peer, code int, err string) {
+	rom.mutex.Lock()
+	defer rom.mutex.Unlock()
+
+	prw := rom.peers[pr.ID()]
+	if prw == nil || prw.peer != pr {
+		return
+	}
+
+	rom.removePeer(prw)
+}
+
+// removePeer closes the transports of prw, along with its producers and
+// consumers, and tells the other peers it left.
+func (rom *Room) removePeer(prw *PeerWrapper) {
+	delete(rom.peers, prw.Id())
+	rom.dropPeer(prw)
+	rom.closeIfEmpty()
+}
 
+// dropPeer closes the media of prw, which is no longer in rom.peers.
+func (rom *Room) dropPeer(prw *PeerWrapper) {
+	for producerId := range prw.producers {
+		delete(rom.producerToPeer, producerId)
+	}
+	for _, transport := range prw.transports {
+		if wrt, ok := transport.(*WebRtcTransport); ok {
+			wrt.Close()
+		}
+	}
+
+	if prw.data.Joined {
+		for _, otherPeer := range rom.getJoindPeers() {
+			otherPeer.Notify("peerClosed", struct {
+				PeerId string `json:"peerId"`
+			}{
+				PeerId: prw.Id(),
+			})
+		}
+	}
+}
+
+func (rom *Room) closeIfEmpty() {
+	if len(rom.peers) == 0 && rom.server != nil {
+		logger.Infof("last peer left, closing room %s", rom.roomId)
+		rom.server.OnRoomClose(rom)
+		rom.close()
+	}
 }
 
 func (rom *Room) OnSctpStateChange(sctpState string) {
@@ -2,6 +2,7 @@ package service
 
 import (
 	"encoding/json"
+	"errors"
 	"mediasoup-signal-controller/common"
 	"mediasoup-signal-controller/conf"
 	"mediasoup-signal-controller/rtp"
@@ -14,21 +15,24 @@ import (
 type Router struct {
 	Waiting_Response
 	rom             *Room
+	worker          *Worker
 	channel         *Channel
 	payloadChannel  *PayloadChannel
 	internal        *common.Internal_t
 	data            interface{}
 	appData         interface{}
 	rtpCapabilities rtp.RtpCapabilities
+	closed          bool
 
 	producers     map[string]*Producer
 	dataProducers map[string]*DataProducer
 	transports    map[string]interface{}
+	rtpObservers  map[string]*ActiveSpeakerObserver
 
 	channelRecvChan chan common.ChannelMessage
 }
 
-func CreateNewRouter(rom *Room, mediaCodecs conf.RouterOptions_t, internal *common.Internal_t, data interface{}, channel *Channel, payloadChannel *PayloadChannel, appData interface{}) *Router {
+func CreateNewRouter(rom *Room, worker *Worker, mediaCodecs conf.RouterOptions_t, internal *common.Internal_t, data interface{}, channel *Channel, payloadChannel *PayloadChannel, appData interface{}) *Router {
 
 	rtpCapabilities := rtp.GenerateRouterRtpCapabilities(mediaCodecs)
 	logger.Debugf("rtpCapabilities========%+v", *rtpCapabilities)
@@ -36,6 +40,7 @@ func CreateNewRouter(rom *Room, mediaCodecs conf.RouterOptions_t, internal *comm
 	router := &Router{
 		channel:         channel,
 		rom:             rom,
+		worker:          worker,
 		payloadChannel:  payloadChannel,
 		internal:        internal,
 		data:            data,
@@ -48,6 +53,7 @@ func CreateNewRouter(rom *Room, mediaCodecs conf.RouterOptions_t, internal *comm
 	router.producers = make(map[string]*Producer)
 	router.dataProducers = make(map[string]*DataProducer)
 	router.transports = make(map[string]interface{})
+	router.rtpObservers = make(map[string]*ActiveSpeakerObserver)
 	router.channelRecvChan = make(chan common.ChannelMessage)
 
 	return router
@@ -130,6 +136,10 @@ func (router *Router) CreateWebRtcTransport(wrto *common.WebRtcTransportOptions)
 
 	wg.Wait()
 
+	if transport == nil {
+		return nil
+	}
+
 	transport.channel.AddListener(transport.internal.TransportId, transport)
 	return transport
 }
@@ -165,9 +175,147 @@ func (router *Router) Connect(dtlspd *common.DtlsParametersData, internal *commo
 	return drf.DtlsLocalRole
 }
 
-func (router *Router) Produce(pd *common.ProducerData, internal *common.ProducerInternal) string {
+func (router *Router) RestartIce(internal *common.RTCTransportInternal) (*common.IceParameter_t, error) {
+
+	var fb common.RestartIceFB
+	var rerr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+
+		_, err := router.channel.Request("transport.restartIce", internal, nil, router,
+
+			func(result common.ChannelMessage) {
+				logger.Infof("transport.restartIce success: =>  %d", result.Id)
+
+				rerr = json.Unmarshal(result.Data, &fb)
+
+				wg.Done()
+			},
+			func(code int, err string) {
+				logger.Infof("transport.restartIce reject: %d => %s", code, err)
+				rerr = errors.New(err)
+
+				wg.Done()
+			})
+		if err != nil {
+			logger.Errorf("transport.restartIce send failed:%s", err.Error())
+			rerr = err
+			wg.Done()
+		}
+	}()
+
+	wg.Wait()
+	if rerr != nil {
+		return nil, rerr
+	}
+	return &fb.IceParameters, nil
+}
+
+func (router *Router) CreatePlainTransport(pto *common.PlainTransportOptions) (*PlainTransport, error) {
+	if len(pto.PlainTransportOptions.ListenIp.Ip) == 0 {
+		return nil, errors.New("missing plainTransportOptions.listenIp")
+	}
+
+	if pto.PlainTransportOptions.MaxSctpMessageSize == 0 {
+		pto.PlainTransportOptions.MaxSctpMessageSize = 262144
+	}
+
+	ptr := &common.PlainTransport_ReqData{
+		ListenIp: common.ListenIp_t{
+			Ip:          pto.PlainTransportOptions.ListenIp.Ip,
+			AnnouncedIp: pto.PlainTransportOptions.ListenIp.AnnouncedIp,
+		},
+		RtcpMux:            pto.RtcpMux,
+		Comedia:            pto.Comedia,
+		MaxSctpMessageSize: pto.PlainTransportOptions.MaxSctpMessageSize,
+		SctpSendBufferSize: 262144,
+	}
+
+	internal := &common.RTCTransportInternal{
+		Internal_t:  *router.internal,
+		TransportId: uuid.New(),
+	}
+
+	var transport *PlainTransport
+	var rerr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+
+		_, err := router.channel.Request("router.createPlainTransport", internal, ptr, router,
+
+			func(result common.ChannelMessage) {
+				logger.Infof("router.createPlainTransport success: =>  %d", result.Id)
+
+				transport = createPlainTransport(internal, result.Data, router.channel, router.payloadChannel, router, pto.AppData)
+
+				router.transports[internal.TransportId] = transport
+
+				wg.Done()
+			},
+			func(code int, err string) {
+				logger.Infof("router.createPlainTransport reject: %d => %s", code, err)
+				rerr = errors.New(err)
+
+				wg.Done()
+			})
+
+		if err != nil {
+			logger.Errorf("router.createPlainTransport send failed:%s", err.Error())
+			rerr = err
+			wg.Done()
+		}
+	}()
+
+	wg.Wait()
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	transport.channel.AddListener(transport.internal.TransportId, transport)
+	return transport, nil
+}
+
+func (router *Router) ConnectPlainTransport(connectData *common.PlainTransportConnectData, internal *common.RTCTransportInternal) (*common.PlainTransportConnectFB, error) {
+
+	var fb *common.PlainTransportConnectFB
+	var rerr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+
+		_, err := router.channel.Request("transport.connect", internal, connectData, router,
+
+			func(result common.ChannelMessage) {
+				logger.Infof("transport.connect success: =>  %d", result.Id)
+
+				fb = &common.PlainTransportConnectFB{}
+				rerr = json.Unmarshal(result.Data, fb)
+
+				wg.Done()
+			},
+			func(code int, err string) {
+				logger.Infof("transport.connect reject: %d => %s", code, err)
+				rerr = errors.New(err)
+
+				wg.Done()
+			})
+		if err != nil {
+			logger.Errorf("transport.connect send failed:%s", err.Error())
+			rerr = err
+			wg.Done()
+		}
+	}()
+
+	wg.Wait()
+	return fb, rerr
+}
+
+func (router *Router) Produce(pd *common.ProducerData, internal *common.ProducerInternal) (string, error) {
 
 	var pf common.ProduceFB
+	var rerr error
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -182,23 +330,26 @@ func (router *Router) Produce(pd *common.ProducerData, internal *common.Producer
 			},
 			func(code int, err string) {
 				logger.Infof("transport.produce reject: %d => %s", code, err)
+				rerr = errors.New(err)
 
 				wg.Done()
 			})
 
 		if err != nil {
 			logger.Errorf("transport.produce send failed:%s", err.Error())
+			rerr = err
 			wg.Done()
 		}
 	}()
 
 	wg.Wait()
-	return pf.Type
+	return pf.Type, rerr
 }
 
-func (router *Router) ProduceData(pd *common.DataProducerData, internal *common.DataProducerInternal) *common.DataProduceFB {
+func (router *Router) ProduceData(pd *common.DataProducerData, internal *common.DataProducerInternal) (*common.DataProduceFB, error) {
 
 	var dpf common.DataProduceFB
+	var rerr error
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -206,31 +357,34 @@ func (router *Router) ProduceData(pd *common.DataProducerData, internal *common.
 		_, err := router.channel.Request("transport.produceData", internal, pd, router,
 
 			func(result common.ChannelMessage) {
-				logger.Infof("=================transport.produceData success: =>  %d======================", result.Id)
+				logger.Infof("transport.produceData success: =>  %d", result.Id)
 
-				_ = json.Unmarshal(result.Data, &dpf)
+				rerr = json.Unmarshal(result.Data, &dpf)
 
 				wg.Done()
 			},
 			func(code int, err string) {
-				logger.Infof("==============transport.produceData reject: %d => %s===============", code, err)
+				logger.Infof("transport.produceData reject: %d => %s", code, err)
+				rerr = errors.New(err)
 
 				wg.Done()
 			})
 
 		if err != nil {
-			logger.Errorf("====================transport.produceData send failed:%s================", err.Error())
+			logger.Errorf("transport.produceData send failed:%s", err.Error())
+			rerr = err
 			wg.Done()
 		}
 	}()
 
 	wg.Wait()
-	return &dpf
+	return &dpf, rerr
 }
 
-func (router *Router) Consume(consumerData *common.ConsumeData, internal *common.ConsumerInternal) common.ConsumeFB {
+func (router *Router) Consume(consumerData *common.ConsumeData, internal *common.ConsumerInternal) (common.ConsumeFB, error) {
 
 	var cf common.ConsumeFB
+	var rerr error
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
@@ -240,23 +394,25 @@ func (router *Router) Consume(consumerData *common.ConsumeData, internal *common
 			func(result common.ChannelMessage) {
 				logger.Infof("transport.consume success: =>  %d", result.Id)
 
-				_ = json.Unmarshal(result.Data, &cf)
+				rerr = json.Unmarshal(result.Data, &cf)
 
 				wg.Done()
 			},
 			func(code int, err string) {
 				logger.Infof("transport.consume reject: %d => %s", code, err)
+				rerr = errors.New(err)
 
 				wg.Done()
 			})
 		if err != nil {
 			logger.Errorf("transport.consume send failed:%s", err.Error())
+			rerr = err
 			wg.Done()
 		}
 	}()
 
 	wg.Wait()
-	return cf
+	return cf, rerr
 }
 
 func (router *Router) getTransportStats(internal *common.RTCTransportInternal) json.RawMessage {
@@ -352,6 +508,173 @@ func (router *Router) getConsumerStats(internal *common.ConsumerInternal) json.R
 	return fb
 }
 
+func (router *Router) Id() string {
+	return router.internal.RouterId
+}
+
+func (router *Router) Close() {
+	if router.closed {
+		return
+	}
+	router.closed = true
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+
+		_, err := router.channel.Request("router.close", router.internal, nil, router,
+
+			func(result common.ChannelMessage) {
+				logger.Infof("router.close success: =>  %d", result.Id)
+
+				wg.Done()
+			},
+			func(code int, err string) {
+				logger.Infof("router.close reject: %d => %s", code, err)
+
+				wg.Done()
+			})
+		if err != nil {
+			logger.Errorf("router.close send failed:%s", err.Error())
+			wg.Done()
+		}
+	}()
+
+	wg.Wait()
+	router.close()
+
+	if router.worker != nil {
+		router.worker.OnRouterClose(router)
+	}
+}
+
+// workerClosed is called when the worker of the router is gone, taking the
+// router with it.
+func (router *Router) workerClosed() {
+	if router.closed {
+		return
+	}
+	router.closed = true
+
+	router.close()
+}
+
+// close drops the transports and RTP observers, the worker closes them along
+// with the router.
+func (router *Router) close() {
+	for _, transport := range router.transports {
+		if tb, ok := transport.(TransportBase); ok {
+			tb.routerClosed()
+		}
+	}
+	router.transports = make(map[string]interface{})
+	router.producers = make(map[string]*Producer)
+	router.dataProducers = make(map[string]*DataProducer)
+
+	for id := range router.rtpObservers {
+		router.channel.RemoveListener(id)
+	}
+	router.rtpObservers = make(map[string]*ActiveSpeakerObserver)
+
+	router.channel.RemoveRouter(router.internal.RouterId)
+	router.channel.RemoveListener(router.internal.RouterId)
+}
+
+func (router *Router) Dump() (json.RawMessage, error) {
+	return router.dump("router.dump", router.internal)
+}
+
+func (router *Router) dump(method string, internal interface{}) (json.RawMessage, error) {
+
+	var fb json.RawMessage
+	var rerr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+
+		_, err := router.channel.Request(method, internal, nil, router,
+
+			func(result common.ChannelMessage) {
+				fb = result.Data
+
+				wg.Done()
+			},
+			func(code int, err string) {
+				logger.Infof("%s reject: %d => %s", method, code, err)
+				rerr = errors.New(err)
+
+				wg.Done()
+			})
+		if err != nil {
+			logger.Errorf("%s send failed:%s", method, err.Error())
+			rerr = err
+			wg.Done()
+		}
+	}()
+
+	wg.Wait()
+	return fb, rerr
+}
+
+func (router *Router) CreateActiveSpeakerObserver(interval int) *ActiveSpeakerObserver {
+
+	if !router.worker.Supports(FeatureActiveSpeakerObserver) {
+		return nil
+	}
+
+	if interval == 0 {
+		interval = 300
+	}
+
+	internal := &common.RtpObserverInternal{
+		Internal_t:    *router.internal,
+		RtpObserverId: uuid.New(),
+	}
+
+	reqData := struct {
+		Interval int `json:"interval"`
+	}{
+		Interval: interval,
+	}
+
+	var observer *ActiveSpeakerObserver
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+
+		_, err := router.channel.Request("router.createActiveSpeakerObserver", internal, reqData, router,
+
+			func(result common.ChannelMessage) {
+				logger.Infof("router.createActiveSpeakerObserver success: =>  %d", result.Id)
+
+				observer = &ActiveSpeakerObserver{
+					internal: *internal,
+					channel:  router.channel,
+					router:   router,
+				}
+
+				wg.Done()
+			},
+			func(code int, err string) {
+				logger.Infof("router.createActiveSpeakerObserver reject: %d => %s", code, err)
+
+				wg.Done()
+			})
+		if err != nil {
+			logger.Errorf("router.createActiveSpeakerObserver send failed:%s", err.Error())
+			wg.Done()
+		}
+	}()
+
+	wg.Wait()
+
+	if observer != nil {
+		router.rtpObservers[internal.RtpObserverId] = observer
+		router.channel.AddListener(internal.RtpObserverId, observer)
+	}
+	return observer
+}
+
 func (router *Router) Notify(rom *Room, producerID string, data json.RawMessage) {
 
 	var resp common.ScoreDataResp
@@ -366,6 +689,18 @@ func (router *Router) OnChannelMessage(msg common.ChannelMessage) {
 	router.channelRecvChan <- msg
 }
 
+// CanConsume tells whether a consumer with the given RTP capabilities can
+// consume the producer.
+func (router *Router) CanConsume(producerId string, rtpCapabilities rtp.RtpCapabilities) bool {
+	producer := router.producers[producerId]
+	if producer == nil {
+		logger.Errorf("canConsume() | Producer with id %s not found", producerId)
+		return false
+	}
+
+	return rtp.CanConsume(&producer.data.consumableRtpParameters, rtpCapabilities)
+}
+
 func (router *Router) GetProducerbyId(id string) *Producer {
 	return router.producers[id]
 }
@@ -374,14 +709,19 @@ func (router *Router) GetDataProducerbyId(id string) *DataProducer {
 	return router.dataProducers[id]
 }
 
-func (router *Router) OnTransportClose() {}
+func (router *Router) OnTransportClose(transport TransportBase) {
+	delete(router.transports, transport.Id())
+}
 
 func (router *Router) OnNewProducer(producer *Producer) {
 	router.producers[producer.id] = producer
 }
 
 func (router *Router) OnProducerClose(producer *Producer) {
-	router.producers[producer.id] = nil
+	delete(router.producers, producer.id)
+	if router.rom != nil {
+		delete(router.rom.producerToPeer, producer.id)
+	}
 }
 
 func (router *Router) OnNewDataProducer(producer *DataProducer) {
@@ -389,7 +729,32 @@ func (router *Router) OnNewDataProducer(producer *DataProducer) {
 }
 
 func (router *Router) OnDataProducerClose(producer *DataProducer) {
-	router.producers[producer.internal.DataProducerId] = nil
+	delete(router.dataProducers, producer.internal.DataProducerId)
+}
+
+// lock takes the lock of the room of the router, which guards the router and
+// everything on it.
+func (router *Router) lock() {
+	if router.rom != nil {
+		router.rom.mutex.Lock()
+	}
+}
+
+func (router *Router) unlock() {
+	if router.rom != nil {
+		router.rom.mutex.Unlock()
+	}
+}
+
+// post hands a worker notification for an object of the router to the room,
+// see Room.post. Without room it is handled right away.
+func (router *Router) post(fn func()) {
+	if router.rom == nil {
+		fn()
+		return
+	}
+
+	router.rom.post(fn)
 }
 
 func (router *Router) HandleNotification(id string, msg common.ChannelMessage) {
@@ -1,25 +1,58 @@
 package service
 
 import (
+	"errors"
+	"fmt"
+	"mediasoup-signal-controller/common"
 	"mediasoup-signal-controller/conf"
-	"os"
+	"mediasoup-signal-controller/rtp"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/cloudwebrtc/go-protoo/logger"
 )
 
+const (
+	// How long rooms of a dead worker wait for another one.
+	RoomRecoveryTimeout = 30 * time.Second
+
+	// How long a worker may take to exit after SIGTERM on shutdown.
+	WorkerCloseTimeout = 5 * time.Second
+
+	// How long worker.getResourceUsage and worker.dump may take.
+	WorkerRequestTimeout = 5 * time.Second
+
+	// Time given to "serverShutdown" notifications to reach the peers.
+	ShutdownNotifyDelay = 500 * time.Millisecond
+
+	DefaultDrainTimeout = 600 * time.Second
+
+	// How many rooms a joiner tries when the room closes while joining it.
+	JoinAttempts = 3
+)
+
 type Server struct {
-	Conf                   *conf.Config
-	Rooms                  map[string]*Room
-	workers                map[int]*Worker
-	nextMediasoupWorkerIdx int
+	Conf           *conf.Config
+	Rooms          map[string]*Room
+	workers        map[int]*Worker
+	workerVersion  WorkerVersion
+	workerSelector WorkerSelector
+	supervisor     *Supervisor
+	closing        bool
+	draining       bool
+	done           chan struct{}
+	mutex          sync.Mutex
 }
 
 func CreateNewServer(cf *conf.Config) *Server {
 	server := &Server{
-		Conf:                   cf,
-		nextMediasoupWorkerIdx: 0,
+		Conf:           cf,
+		workerSelector: CreateNewWorkerSelector(cf.Mediasoup.WorkerSelection),
+		done:           make(chan struct{}),
 	}
 
+	server.supervisor = CreateNewSupervisor(server, cf.Mediasoup.Supervisor)
 	server.Rooms = make(map[string]*Room)
 	server.workers = make(map[int]*Worker, 0)
 
@@ -30,75 +63,426 @@ func (svr *Server) RunMediasoupWorkers() error {
 
 	numWorkers := svr.Conf.Mediasoup.NumWorkers
 
-	os.Setenv("MEDIASOUP_VERSION", "3.6.32")
-	for i := 0; i < numWorkers; i++ {
+	if err := rtp.ValidateRtpCapabilities(svr.Conf.Mediasoup.RouterOptions); err != nil {
+		return fmt.Errorf("invalid routerOptions: %s", err.Error())
+	}
 
-		worker := CreateNewWorker(svr, svr.Conf.Mediasoup.WorkerPath, svr.Conf.Mediasoup.WorkerSettings.LogLevel,
-			svr.Conf.Mediasoup.WorkerSettings.RtcMinPort, svr.Conf.Mediasoup.WorkerSettings.RtcMaxPort,
-			svr.Conf.Https.Tls.Cert, svr.Conf.Https.Tls.Key, i)
-		if worker != nil {
-			logger.Infof("CreateWorker success")
-			svr.workers[worker.Pid] = worker
-			worker.SetListener(svr)
-		} else {
-			logger.Errorf("Start worker %d failed", i)
-		}
+	version, source := DetectWorkerVersion(&svr.Conf.Mediasoup)
+	svr.workerVersion = version
+	logger.Infof("mediasoup worker version %s (from %s): %s=%t, %s=%t", version, source,
+		FeatureActiveSpeakerObserver, version.Supports(FeatureActiveSpeakerObserver),
+		FeatureLengthPrefixedChannel, version.Supports(FeatureLengthPrefixedChannel))
+
+	for i := 0; i < numWorkers; i++ {
+		svr.supervisor.Start(i)
 	}
+	go svr.supervisor.Run()
 
 	return nil
 }
 
 func (svr *Server) GetOrCreateRoom(roomId string) *Room {
-
-	if roomId != "" && svr.Rooms[roomId] != nil {
-		return svr.Rooms[roomId]
+	svr.mutex.Lock()
+	// A room closing with its last peer is replaced rather than joined.
+	if existing := svr.Rooms[roomId]; roomId != "" && existing != nil && !existing.Closed() {
+		svr.mutex.Unlock()
+		return existing
+	}
+	if svr.closing || svr.draining {
+		svr.mutex.Unlock()
+		logger.Warnf("refusing room %s, draining or shutting down", roomId)
+		return nil
 	}
+	svr.mutex.Unlock()
 
 	worker := svr.getMediasoupWorker()
-	room := CreateNewRoom(svr.Conf, worker, roomId)
+	if worker == nil {
+		logger.Errorf("no mediasoup worker available for room %s", roomId)
+		return nil
+	}
+
+	// Not holding the lock while the router is created, it waits on the worker.
+	room, err := CreateNewRoom(svr, svr.Conf, worker, roomId)
+	if err != nil {
+		logger.Errorf("cannot create room %s on worker %d: %s", roomId, worker.Pid, err.Error())
+		return nil
+	}
+
+	// Someone else may have created the room meanwhile, theirs wins.
+	svr.mutex.Lock()
+	if existing := svr.Rooms[roomId]; existing != nil && !existing.Closed() {
+		svr.mutex.Unlock()
+		room.Close()
+		return existing
+	}
+	if svr.closing {
+		svr.mutex.Unlock()
+		room.Close()
+		return nil
+	}
 	svr.Rooms[roomId] = room
+	svr.mutex.Unlock()
 	return room
 }
 
-func (svr *Server) getMediasoupWorker() *Worker {
-
-	var worker *Worker
-	worker = nil
+// getMediasoupWorker selects an available worker, but those in excluded.
+func (svr *Server) getMediasoupWorker(excluded ...*Worker) *Worker {
 
-	i := 0
-	for _, val := range svr.workers {
-		if i == svr.nextMediasoupWorkerIdx {
-			worker = val
+	workers := make([]*Worker, 0)
+	for _, worker := range svr.Workers() {
+		if worker.Available() && !containsWorker(excluded, worker) {
+			workers = append(workers, worker)
 		}
-		i++
 	}
 
-	svr.nextMediasoupWorkerIdx++
-	if svr.nextMediasoupWorkerIdx == len(svr.workers) {
-		svr.nextMediasoupWorkerIdx = 0
+	if len(workers) == 0 {
+		return nil
 	}
 
-	return worker
+	return svr.workerSelector.Select(workers)
 }
 
-func (svr *Server) OnWorkerExit(pid int, seq int) {
-	svr.workers[pid] = nil
-	// restart a woker
-	logger.Infof("Restart worker after worker seq:%d = %d exit", seq, pid)
+func containsWorker(workers []*Worker, worker *Worker) bool {
+	for _, w := range workers {
+		if w == worker {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (svr *Server) startWorker(seq int) *Worker {
 	worker := CreateNewWorker(svr, svr.Conf.Mediasoup.WorkerPath, svr.Conf.Mediasoup.WorkerSettings.LogLevel,
 		svr.Conf.Mediasoup.WorkerSettings.RtcMinPort, svr.Conf.Mediasoup.WorkerSettings.RtcMaxPort,
 		svr.Conf.Https.Tls.Cert, svr.Conf.Https.Tls.Key, seq)
-	if worker != nil {
-		logger.Infof("CreateWorker success")
-		svr.workers[worker.Pid] = worker
-		worker.SetListener(svr)
-	} else {
-		logger.Errorf("Restart worker failed")
+	if worker == nil {
+		logger.Errorf("Start worker %d failed", seq)
+		return nil
 	}
+
+	logger.Infof("CreateWorker success")
+	svr.mutex.Lock()
+	svr.workers[worker.Pid] = worker
+	svr.mutex.Unlock()
+	worker.SetListener(svr)
+
+	return worker
 }
 
-func (svr *Server) OnRoomClose(roomId string) {
-	rom := svr.Rooms[roomId]
-	rom.Close()
-	svr.Rooms[roomId] = nil
+func (svr *Server) OnWorkerExit(pid int, seq int) {
+	svr.mutex.Lock()
+
+	reason := "exited"
+	if worker := svr.workers[pid]; worker != nil {
+		reason = worker.ExitReason()
+	}
+	delete(svr.workers, pid)
+
+	if svr.closing {
+		svr.mutex.Unlock()
+		return
+	}
+	svr.mutex.Unlock()
+
+	svr.supervisor.OnExit(seq, pid, reason)
+
+	// Rooms whose router lived on the dead worker.
+	rooms := make([]*Room, 0)
+	for _, rom := range svr.rooms() {
+		rom.mutex.Lock()
+		if rom.router != nil && rom.router.worker != nil && rom.router.worker.Pid == pid {
+			rooms = append(rooms, rom)
+		}
+		rom.mutex.Unlock()
+	}
+
+	if len(rooms) > 0 {
+		go svr.recoverRooms(rooms)
+	}
+}
+
+// recoverRooms moves rooms off a dead worker: each gets a new router on a
+// healthy worker and its peers are told to recreate their transports. When
+// there is none, it waits for a restarted one up to RoomRecoveryTimeout. A
+// room no worker takes is closed, its peers join again from scratch.
+func (svr *Server) recoverRooms(rooms []*Room) {
+	deadline := time.Now().Add(RoomRecoveryTimeout)
+
+	for _, rom := range rooms {
+		if err := svr.recoverRoom(rom, deadline); err != nil {
+			logger.Errorf("cannot recover room %s, closing it: %s", rom.roomId, err.Error())
+			rom.Close()
+		}
+	}
+}
+
+// recoverRoom tries every available worker in turn until one creates a router
+// for rom.
+func (svr *Server) recoverRoom(rom *Room, deadline time.Time) error {
+	tried := make([]*Worker, 0)
+	for {
+		worker := svr.getMediasoupWorker(tried...)
+		if worker == nil {
+			if len(tried) > 0 || !time.Now().Before(deadline) || svr.Closing() {
+				return errors.New("no mediasoup worker available")
+			}
+			time.Sleep(200 * time.Millisecond)
+			continue
+		}
+
+		logger.Infof("Recovering room %s on worker %d", rom.roomId, worker.Pid)
+		err := rom.ResetMedia(worker, "workerDied")
+		if err == nil {
+			return nil
+		}
+		logger.Warnf("cannot recover room %s on worker %d: %s", rom.roomId, worker.Pid, err.Error())
+		tried = append(tried, worker)
+	}
+}
+
+func (svr *Server) Closing() bool {
+	svr.mutex.Lock()
+	defer svr.mutex.Unlock()
+
+	return svr.closing
+}
+
+// Shutdown tells every peer the server is going away, closes all rooms and
+// stops the workers. New rooms are refused from the start.
+func (svr *Server) Shutdown(timeout time.Duration) {
+	svr.mutex.Lock()
+	if svr.closing {
+		svr.mutex.Unlock()
+		return
+	}
+	svr.closing = true
+	svr.supervisor.Stop()
+
+	rooms := make([]*Room, 0, len(svr.Rooms))
+	for _, rom := range svr.Rooms {
+		if rom != nil {
+			rooms = append(rooms, rom)
+		}
+	}
+	svr.Rooms = make(map[string]*Room)
+	svr.mutex.Unlock()
+
+	logger.Infof("Shutting down, %d rooms", len(rooms))
+
+	for _, rom := range rooms {
+		rom.NotifyPeers("serverShutdown", common.NilAccept{})
+	}
+	if len(rooms) > 0 {
+		time.Sleep(ShutdownNotifyDelay)
+	}
+
+	for _, rom := range rooms {
+		rom.Close()
+	}
+
+	var wg sync.WaitGroup
+	for _, worker := range svr.Workers() {
+		wg.Add(1)
+		go func(worker *Worker) {
+			worker.Close(timeout)
+			wg.Done()
+		}(worker)
+	}
+	wg.Wait()
+
+	logger.Infof("Shutdown complete")
+	close(svr.done)
+}
+
+func (svr *Server) Supervision() []WorkerSupervision {
+	return svr.supervisor.States()
+}
+
+// RestartWorker restarts a worker seq the supervisor gave up on.
+func (svr *Server) RestartWorker(seq int) bool {
+	if svr.Closing() {
+		return false
+	}
+
+	return svr.supervisor.Reset(seq)
+}
+
+// DrainTimeout is the configured drainTimeout.
+func (svr *Server) DrainTimeout() time.Duration {
+	if svr.Conf.DrainTimeout > 0 {
+		return time.Duration(svr.Conf.DrainTimeout) * time.Second
+	}
+	return DefaultDrainTimeout
+}
+
+// Done is closed once Shutdown has completed.
+func (svr *Server) Done() <-chan struct{} {
+	return svr.done
+}
+
+func (svr *Server) Draining() bool {
+	svr.mutex.Lock()
+	defer svr.mutex.Unlock()
+
+	return svr.draining
+}
+
+// Drain refuses new rooms and shuts the server down once the last room has
+// closed, or when deadline has passed.
+func (svr *Server) Drain(deadline time.Duration) {
+	svr.mutex.Lock()
+	if svr.draining || svr.closing {
+		svr.mutex.Unlock()
+		return
+	}
+	svr.draining = true
+	svr.mutex.Unlock()
+
+	logger.Infof("Draining, %d rooms, deadline %s", svr.RoomCount(), deadline)
+
+	go func() {
+		expire := time.After(deadline)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for svr.RoomCount() > 0 {
+			select {
+			case <-svr.done:
+				return
+			case <-expire:
+				logger.Warnf("Drain deadline passed with %d rooms", svr.RoomCount())
+				svr.Shutdown(WorkerCloseTimeout)
+				return
+			case <-ticker.C:
+			}
+		}
+
+		logger.Infof("Drained")
+		svr.Shutdown(WorkerCloseTimeout)
+	}()
+}
+
+// DrainWorker drains the worker with the given pid, false when there is none.
+func (svr *Server) DrainWorker(pid int, deadline time.Duration) bool {
+	svr.mutex.Lock()
+	worker := svr.workers[pid]
+	svr.mutex.Unlock()
+
+	if worker == nil {
+		return false
+	}
+
+	worker.Drain(deadline)
+	return true
+}
+
+// GetRoom returns the room if it exists, without creating it.
+func (svr *Server) GetRoom(roomId string) *Room {
+	svr.mutex.Lock()
+	defer svr.mutex.Unlock()
+
+	return svr.Rooms[roomId]
+}
+
+func (svr *Server) RoomCount() int {
+	svr.mutex.Lock()
+	defer svr.mutex.Unlock()
+
+	return len(svr.Rooms)
+}
+
+// OnRoomClose forgets a room which is closing, unless it has already been
+// replaced.
+func (svr *Server) OnRoomClose(rom *Room) {
+	svr.mutex.Lock()
+	defer svr.mutex.Unlock()
+
+	if svr.Rooms[rom.roomId] == rom {
+		delete(svr.Rooms, rom.roomId)
+	}
+}
+
+// Workers returns the running workers ordered by seq.
+func (svr *Server) Workers() []*Worker {
+	svr.mutex.Lock()
+	defer svr.mutex.Unlock()
+
+	workers := make([]*Worker, 0, len(svr.workers))
+	for _, worker := range svr.workers {
+		workers = append(workers, worker)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i].seq < workers[j].seq })
+
+	return workers
+}
+
+// rooms returns the rooms, to be used without the server lock.
+func (svr *Server) rooms() []*Room {
+	svr.mutex.Lock()
+	defer svr.mutex.Unlock()
+
+	rooms := make([]*Room, 0, len(svr.Rooms))
+	for _, rom := range svr.Rooms {
+		if rom != nil {
+			rooms = append(rooms, rom)
+		}
+	}
+	return rooms
+}
+
+func (svr *Server) Routers() []*Router {
+	routers := make([]*Router, 0)
+	for _, rom := range svr.rooms() {
+		rom.mutex.Lock()
+		if rom.router != nil {
+			routers = append(routers, rom.router)
+		}
+		rom.mutex.Unlock()
+	}
+	sort.Slice(routers, func(i, j int) bool { return routers[i].Id() < routers[j].Id() })
+
+	return routers
+}
+
+func (svr *Server) GetRouterById(routerId string) *Router {
+	for _, router := range svr.Routers() {
+		if router.Id() == routerId {
+			return router
+		}
+	}
+	return nil
+}
+
+// GetTransportById returns a transport along with its router, whose lock has
+// to be held to use it.
+func (svr *Server) GetTransportById(transportId string) (TransportBase, *Router) {
+	for _, router := range svr.Routers() {
+		router.lock()
+		transport, ok := router.transports[transportId].(TransportBase)
+		router.unlock()
+
+		if ok {
+			return transport, router
+		}
+	}
+	return nil, nil
+}
+
+// GetConsumerById returns a consumer along with its transport and router,
+// whose lock has to be held to use them.
+func (svr *Server) GetConsumerById(consumerId string) (*Consumer, TransportBase, *Router) {
+	for _, router := range svr.Routers() {
+		router.lock()
+		for _, transport := range router.transports {
+			if transport, ok := transport.(TransportBase); ok {
+				if consumer := transport.getConsumer(consumerId); consumer != nil {
+					router.unlock()
+					return consumer, transport, router
+				}
+			}
+		}
+		router.unlock()
+	}
+	return nil, nil, nil
 }
@@ -0,0 +1,664 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mediasoup-signal-controller/common"
+	"mediasoup-signal-controller/conf"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Path of cmd/fakeworker, built once by TestMain.
+var fakeWorkerPath string
+
+func TestMain(m *testing.M) {
+	dir, err := ioutil.TempDir("", "fakeworker")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fakeWorkerPath = filepath.Join(dir, "fakeworker")
+	build := exec.Command("go", "build", "-o", fakeWorkerPath, "mediasoup-signal-controller/cmd/fakeworker")
+	build.Stderr = os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "building fakeworker failed: %s\n", err.Error())
+		os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// startTestServer runs a Server on numWorkers fakeworkers with the router codecs of
+// conf/config.json and waits for the workers to be running.
+// testConfig is conf/config.json running numWorkers fakeworkers, with its
+// sockets in a directory removed when t ends.
+func testConfig(t *testing.T, numWorkers int) *conf.Config {
+	data, err := ioutil.ReadFile("../conf/config.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cf conf.Config
+	if err := json.Unmarshal(data, &cf); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "mediasoup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	cf.Mediasoup.NumWorkers = numWorkers
+	cf.Mediasoup.WorkerPath = fakeWorkerPath
+	cf.Mediasoup.UnixPath = dir
+	cf.Mediasoup.CaptureDir = ""
+
+	return &cf
+}
+
+func startTestServer(t *testing.T, numWorkers int) *Server {
+	svr := CreateNewServer(testConfig(t, numWorkers))
+	t.Cleanup(func() { svr.Shutdown(time.Second) })
+	if err := svr.RunMediasoupWorkers(); err != nil {
+		t.Fatal(err)
+	}
+
+	available := func() int {
+		n := 0
+		for _, worker := range svr.Workers() {
+			if worker.Available() {
+				n++
+			}
+		}
+		return n
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for available() < numWorkers {
+		if time.Now().After(deadline) {
+			t.Fatal("fakeworker not running")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	return svr
+}
+
+func doRequest(h http.Handler, method string, path string, contentType string, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	if len(contentType) > 0 {
+		req.Header.Set("Content-Type", contentType)
+	}
+	h.ServeHTTP(rec, req)
+
+	return rec
+}
+
+const testPublishOffer = `v=0
+o=- 1 2 IN IP4 127.0.0.1
+s=-
+t=0 0
+a=group:BUNDLE 0 1
+a=fingerprint:sha-256 AA:BB:CC:DD
+a=setup:actpass
+a=ice-ufrag:pub1
+a=ice-pwd:pubpubpubpubpubpubpubpub
+m=audio 9 UDP/TLS/RTP/SAVPF 111
+c=IN IP4 0.0.0.0
+a=mid:0
+a=sendonly
+a=rtcp-mux
+a=rtpmap:111 opus/48000/2
+a=fmtp:111 minptime=10;useinbandfec=1
+a=ssrc:1001 cname:pub
+m=video 9 UDP/TLS/RTP/SAVPF 96 97
+c=IN IP4 0.0.0.0
+a=mid:1
+a=sendonly
+a=rtcp-mux
+a=extmap:4 urn:ietf:params:rtp-hdrext:sdes:mid
+a=rtpmap:96 VP8/90000
+a=rtcp-fb:96 nack
+a=rtcp-fb:96 nack pli
+a=rtpmap:97 rtx/90000
+a=fmtp:97 apt=96
+a=ssrc-group:FID 2001 2002
+a=ssrc:2001 cname:pub
+a=ssrc:2002 cname:pub
+`
+
+const testPlayOffer = `v=0
+o=- 2 2 IN IP4 127.0.0.1
+s=-
+t=0 0
+a=group:BUNDLE a v
+a=fingerprint:sha-256 DD:EE:FF:00
+a=setup:actpass
+a=ice-ufrag:view
+a=ice-pwd:viewviewviewviewviewview
+m=audio 9 UDP/TLS/RTP/SAVPF 111
+c=IN IP4 0.0.0.0
+a=mid:a
+a=recvonly
+a=rtcp-mux
+a=rtpmap:111 opus/48000/2
+a=fmtp:111 minptime=10;useinbandfec=1
+m=video 9 UDP/TLS/RTP/SAVPF 102 103
+c=IN IP4 0.0.0.0
+a=mid:v
+a=recvonly
+a=rtcp-mux
+a=rtpmap:102 VP8/90000
+a=rtcp-fb:102 nack
+a=rtcp-fb:102 nack pli
+a=rtpmap:103 rtx/90000
+a=fmtp:103 apt=102
+`
+
+// A WHIP publisher and a WHEP viewer in the same room: the room gets a router
+// on the fakeworker, the publisher's tracks become producers and the viewer
+// consumes both of them.
+func TestServerPublishPlay(t *testing.T) {
+	svr := startTestServer(t, 1)
+	whip := CreateNewWhipServer(svr).Handler()
+	whep := CreateNewWhepServer(svr).Handler()
+
+	pub := doRequest(whip, http.MethodPost, "/whip/room1", "application/sdp", testPublishOffer)
+	if pub.Code != http.StatusCreated {
+		t.Fatalf("WHIP POST = %d %s", pub.Code, pub.Body.String())
+	}
+	if !strings.HasPrefix(pub.Header().Get("Location"), "/whip/room1/") {
+		t.Errorf("WHIP Location = %q", pub.Header().Get("Location"))
+	}
+
+	rom := svr.GetRoom("room1")
+	if rom == nil || rom.router == nil {
+		t.Fatal("room1 has no router")
+	}
+	if n := len(rom.producerToPeer); n != 2 {
+		t.Fatalf("room1 has %d producers, want 2", n)
+	}
+
+	play := doRequest(whep, http.MethodPost, "/whep/room1", "application/sdp", testPlayOffer)
+	if play.Code != http.StatusCreated {
+		t.Fatalf("WHEP POST = %d %s", play.Code, play.Body.String())
+	}
+	answer := play.Body.String()
+	// The answer keeps the payload types the viewer offered.
+	for _, want := range []string{"a=mid:a", "a=mid:v", "a=sendonly", "a=rtpmap:111 opus/48000/2",
+		"a=rtpmap:102 VP8/90000", "a=rtpmap:103 rtx/90000", "a=fmtp:103 apt=102"} {
+		if !strings.Contains(answer, want) {
+			t.Errorf("WHEP answer lacks %q:\n%s", want, answer)
+		}
+	}
+	if got := play.Header().Get("Access-Control-Expose-Headers"); got != "Location" {
+		t.Errorf("WHEP Access-Control-Expose-Headers = %q, want Location", got)
+	}
+
+	consumers := 0
+	for _, transport := range rom.router.transports {
+		if transport, ok := transport.(*WebRtcTransport); ok {
+			consumers += len(transport.consumers)
+		}
+	}
+	if consumers != 2 {
+		t.Errorf("router has %d consumers, want 2", consumers)
+	}
+
+	if rec := doRequest(whep, http.MethodDelete, play.Header().Get("Location"), "", ""); rec.Code != http.StatusOK {
+		t.Errorf("WHEP DELETE = %d", rec.Code)
+	}
+	if rec := doRequest(whip, http.MethodDelete, pub.Header().Get("Location"), "", ""); rec.Code != http.StatusOK {
+		t.Errorf("WHIP DELETE = %d", rec.Code)
+	}
+}
+
+// Browsers playing from another origin send a preflight before the offer, it
+// is answered whether the room exists or not.
+func TestServerWhepPreflight(t *testing.T) {
+	svr := startTestServer(t, 1)
+	whep := CreateNewWhepServer(svr).Handler()
+
+	rec := doRequest(whep, http.MethodOptions, "/whep/room1", "", "")
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("WHEP OPTIONS = %d", rec.Code)
+	}
+	for header, want := range map[string]string{
+		"Access-Control-Allow-Origin":   "*",
+		"Access-Control-Allow-Methods":  "POST, PATCH, DELETE, OPTIONS",
+		"Access-Control-Expose-Headers": "Location",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("WHEP OPTIONS %s = %q, want %q", header, got, want)
+		}
+	}
+}
+
+// Trickle PATCHes may carry candidates only, without an m= section or a
+// changed ufrag, they are acknowledged without an ICE restart.
+func TestServerWhepTrickleCandidates(t *testing.T) {
+	svr := startTestServer(t, 1)
+	whip := CreateNewWhipServer(svr).Handler()
+	whep := CreateNewWhepServer(svr).Handler()
+
+	if pub := doRequest(whip, http.MethodPost, "/whip/room1", "application/sdp", testPublishOffer); pub.Code != http.StatusCreated {
+		t.Fatalf("WHIP POST = %d %s", pub.Code, pub.Body.String())
+	}
+	play := doRequest(whep, http.MethodPost, "/whep/room1", "application/sdp", testPlayOffer)
+	if play.Code != http.StatusCreated {
+		t.Fatalf("WHEP POST = %d %s", play.Code, play.Body.String())
+	}
+
+	fragment := "a=candidate:1 1 udp 2122260223 192.0.2.1 54400 typ host\r\na=end-of-candidates\r\n"
+	rec := doRequest(whep, http.MethodPatch, play.Header().Get("Location"), "application/trickle-ice-sdpfrag", fragment)
+	if rec.Code != http.StatusNoContent {
+		t.Errorf("WHEP PATCH = %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// WHIP and WHEP requests run on their own net/http goroutines, the room has
+// to stay consistent when they hit it at the same time.
+func TestServerConcurrentSessions(t *testing.T) {
+	svr := startTestServer(t, 1)
+	whip := CreateNewWhipServer(svr).Handler()
+	whep := CreateNewWhepServer(svr).Handler()
+
+	pub := doRequest(whip, http.MethodPost, "/whip/room1", "application/sdp", testPublishOffer)
+	if pub.Code != http.StatusCreated {
+		t.Fatalf("WHIP POST = %d %s", pub.Code, pub.Body.String())
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 16)
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			rec := doRequest(whip, http.MethodPost, "/whip/room1", "application/sdp", testPublishOffer)
+			if rec.Code != http.StatusCreated {
+				errs <- fmt.Sprintf("WHIP POST = %d %s", rec.Code, rec.Body.String())
+				return
+			}
+			doRequest(whip, http.MethodDelete, rec.Header().Get("Location"), "", "")
+		}()
+		go func() {
+			defer wg.Done()
+			rec := doRequest(whep, http.MethodPost, "/whep/room1", "application/sdp", testPlayOffer)
+			if rec.Code != http.StatusCreated {
+				errs <- fmt.Sprintf("WHEP POST = %d %s", rec.Code, rec.Body.String())
+				return
+			}
+			doRequest(whep, http.MethodDelete, rec.Header().Get("Location"), "", "")
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	rom := svr.GetRoom("room1")
+	if rom == nil {
+		t.Fatal("room1 closed while its first publisher is still there")
+	}
+	rom.mutex.Lock()
+	peers, producers := len(rom.peers), len(rom.producerToPeer)
+	rom.mutex.Unlock()
+	if peers != 1 || producers != 2 {
+		t.Errorf("room1 has %d peers and %d producers, want 1 and 2", peers, producers)
+	}
+
+	doRequest(whip, http.MethodDelete, pub.Header().Get("Location"), "", "")
+	if svr.GetRoom("room1") != nil {
+		t.Error("room1 still open after its last peer left")
+	}
+}
+
+// Rooms created at the same time for the same id end up as one room, the
+// routers of the others are closed.
+func TestServerGetOrCreateRoomConcurrently(t *testing.T) {
+	svr := startTestServer(t, 1)
+
+	rooms := make(chan *Room, 8)
+	for i := 0; i < cap(rooms); i++ {
+		go func() { rooms <- svr.GetOrCreateRoom("room1") }()
+	}
+
+	first := <-rooms
+	for i := 1; i < cap(rooms); i++ {
+		if rom := <-rooms; rom != first {
+			t.Fatalf("GetOrCreateRoom() returned rooms %p and %p", first, rom)
+		}
+	}
+	if rom := svr.GetRoom("room1"); rom != first {
+		t.Errorf("GetRoom() = %p, want %p", rom, first)
+	}
+	if n := svr.Workers()[0].RouterCount(); n != 1 {
+		t.Errorf("worker has %d routers, want 1", n)
+	}
+}
+
+// A worker which stops answering does not block its callers, and the request
+// left pending is dropped.
+func TestWorkerRequestTimeout(t *testing.T) {
+	os.Setenv("FAKEWORKER_STALL", "worker.dump")
+	defer os.Unsetenv("FAKEWORKER_STALL")
+
+	svr := startTestServer(t, 1)
+	worker := svr.Workers()[0]
+
+	started := time.Now()
+	if _, err := worker.dump(100 * time.Millisecond); err == nil {
+		t.Fatal("dump() of a stalled worker succeeded")
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("dump() returned after %s", elapsed)
+	}
+
+	worker.channel.mutex.Lock()
+	pending := len(worker.channel.sents)
+	worker.channel.mutex.Unlock()
+	if pending != 0 {
+		t.Errorf("%d requests pending after the timeout", pending)
+	}
+
+	if _, err := worker.GetResourceUsage(); err != nil {
+		t.Errorf("GetResourceUsage() = %s", err.Error())
+	}
+}
+
+// The rooms of a worker which dies get a router on another worker.
+func TestServerRecoverRooms(t *testing.T) {
+	svr := startTestServer(t, 2)
+	whip := CreateNewWhipServer(svr).Handler()
+
+	if rec := doRequest(whip, http.MethodPost, "/whip/room1", "application/sdp", testPublishOffer); rec.Code != http.StatusCreated {
+		t.Fatalf("WHIP POST = %d %s", rec.Code, rec.Body.String())
+	}
+	rom := svr.GetRoom("room1")
+	rom.mutex.Lock()
+	dead := rom.router.worker
+	rom.mutex.Unlock()
+
+	dead.Kill("test")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		rom.mutex.Lock()
+		worker, peers := rom.router.worker, len(rom.peers)
+		rom.mutex.Unlock()
+
+		if worker != dead {
+			if !worker.Available() {
+				t.Errorf("room moved to unavailable worker %d", worker.Pid)
+			}
+			// WHIP sessions cannot be renegotiated, they are dropped.
+			if peers != 0 {
+				t.Errorf("room has %d peers after recovery, want 0", peers)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("room not recovered")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// A router the worker refuses to create is not handed out to a room.
+func TestServerRouterRejected(t *testing.T) {
+	os.Setenv("FAKEWORKER_REJECT", "worker.createRouter")
+	defer os.Unsetenv("FAKEWORKER_REJECT")
+
+	svr := startTestServer(t, 1)
+
+	if rom := svr.GetOrCreateRoom("room1"); rom != nil {
+		t.Fatalf("GetOrCreateRoom() = %p, want nil", rom)
+	}
+	if svr.GetRoom("room1") != nil {
+		t.Error("room without a router registered")
+	}
+	if n := svr.Workers()[0].RouterCount(); n != 0 {
+		t.Errorf("worker has %d routers, want 0", n)
+	}
+}
+
+// A room of a dead worker which no other worker takes is closed rather than
+// left with a router which does not exist.
+func TestServerRecoverRoomsRejected(t *testing.T) {
+	svr := startTestServer(t, 1)
+
+	rom := svr.GetOrCreateRoom("room1")
+	if rom == nil {
+		t.Fatal("GetOrCreateRoom() = nil")
+	}
+	rom.mutex.Lock()
+	dead := rom.router.worker
+	rom.mutex.Unlock()
+
+	// The restarted worker refuses the router.
+	os.Setenv("FAKEWORKER_REJECT", "worker.createRouter")
+	defer os.Unsetenv("FAKEWORKER_REJECT")
+	dead.Kill("test")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !rom.Closed() {
+		if time.Now().After(deadline) {
+			t.Fatal("room not closed")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	rom.mutex.Lock()
+	worker := rom.router.worker
+	rom.mutex.Unlock()
+	if worker != dead {
+		t.Errorf("closed room moved to worker %d", worker.Pid)
+	}
+}
+
+// A data producer the worker refuses is not registered.
+func TestTransportProduceDataRejected(t *testing.T) {
+	os.Setenv("FAKEWORKER_REJECT", "transport.produceData")
+	defer os.Unsetenv("FAKEWORKER_REJECT")
+
+	svr := startTestServer(t, 1)
+	whip := CreateNewWhipServer(svr).Handler()
+
+	if rec := doRequest(whip, http.MethodPost, "/whip/room1", "application/sdp", testPublishOffer); rec.Code != http.StatusCreated {
+		t.Fatalf("WHIP POST = %d %s", rec.Code, rec.Body.String())
+	}
+	rom := svr.GetRoom("room1")
+	rom.mutex.Lock()
+	defer rom.mutex.Unlock()
+
+	for _, transport := range rom.router.transports {
+		wrt, ok := transport.(*WebRtcTransport)
+		if !ok {
+			continue
+		}
+		if dp, err := wrt.produceData(&common.ProduceDataData{Label: "chat"}); err == nil {
+			t.Errorf("produceData() = %s, want an error", dp.Id())
+		}
+		if n := len(wrt.dataProducers); n != 0 {
+			t.Errorf("transport has %d data producers, want 0", n)
+		}
+		return
+	}
+	t.Fatal("room1 has no WebRTC transport")
+}
+
+// A room which closed with its last peer is not handed out to joiners.
+func TestServerReplacesClosedRoom(t *testing.T) {
+	svr := startTestServer(t, 1)
+
+	rom := svr.GetOrCreateRoom("room1")
+	if rom == nil {
+		t.Fatal("GetOrCreateRoom() = nil")
+	}
+	rom.Close()
+	if rom.CreatePeer("peer1", nil) != nil {
+		t.Error("CreatePeer() on a closed room != nil")
+	}
+
+	again := svr.GetOrCreateRoom("room1")
+	if again == nil || again == rom || again.Closed() {
+		t.Fatalf("GetOrCreateRoom() = %p, want a new open room", again)
+	}
+	if svr.GetRoom("room1") != again {
+		t.Error("new room not registered")
+	}
+}
+
+// A worker exiting right after start counts against its restarts, and a seq
+// given up on runs again once reset.
+func TestSupervisorReset(t *testing.T) {
+	cf := testConfig(t, 1)
+	cf.Mediasoup.WorkerPath = "/bin/true"
+	cf.Mediasoup.Supervisor.MaxRestarts = 2
+	cf.Mediasoup.Supervisor.MinBackoff = 10
+	cf.Mediasoup.Supervisor.MaxBackoff = 10
+
+	svr := CreateNewServer(cf)
+	t.Cleanup(func() { svr.Shutdown(time.Second) })
+	if err := svr.RunMediasoupWorkers(); err != nil {
+		t.Fatal(err)
+	}
+
+	waitFor := func(what string, done func() bool) {
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("%s: supervision %+v", what, svr.Supervision())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	waitFor("failed", func() bool { return svr.Supervision()[0].State == SupervisionFailed })
+	if n := len(svr.Workers()); n != 0 {
+		t.Errorf("%d workers left after they exited", n)
+	}
+
+	admin := CreateNewAdminServer(svr).Handler()
+	if rec := doRequest(admin, http.MethodPost, "/supervisor/1/restart", "", ""); rec.Code != http.StatusConflict {
+		t.Errorf("restart of unknown seq = %d, want 409", rec.Code)
+	}
+
+	cf.Mediasoup.WorkerPath = fakeWorkerPath
+	if rec := doRequest(admin, http.MethodPost, "/supervisor/0/restart", "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("restart = %d %s", rec.Code, rec.Body.String())
+	}
+	waitFor("running", func() bool {
+		workers := svr.Workers()
+		return len(workers) == 1 && workers[0].Available()
+	})
+	if state := svr.Supervision()[0]; state.State != SupervisionRunning || state.RecentRestarts != 0 {
+		t.Errorf("supervision after reset %+v", state)
+	}
+}
+
+// A worker which never sends "running" is killed and restarted like one which
+// stops answering probes.
+func TestSupervisorStartTimeout(t *testing.T) {
+	cf := testConfig(t, 1)
+	cf.Mediasoup.WorkerPath = filepath.Join(cf.Mediasoup.UnixPath, "hanging-worker")
+	if err := ioutil.WriteFile(cf.Mediasoup.WorkerPath, []byte("#!/bin/sh\nexec sleep 60\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	cf.Mediasoup.Supervisor.ProbeInterval = 1
+	cf.Mediasoup.Supervisor.StartTimeout = 1
+	cf.Mediasoup.Supervisor.MinBackoff = 10
+	cf.Mediasoup.Supervisor.MaxBackoff = 10
+
+	svr := CreateNewServer(cf)
+	t.Cleanup(func() { svr.Shutdown(time.Second) })
+	if err := svr.RunMediasoupWorkers(); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		state := svr.Supervision()[0]
+		if state.Restarts > 0 {
+			if state.LastExitReason != "unresponsive" {
+				t.Errorf("last exit reason = %q, want unresponsive", state.LastExitReason)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("hanging worker not restarted: supervision %+v", state)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// Closing the transport of a publisher drops its producers from the room and
+// the consumers of them from the players.
+func TestServerTransportCloseCascade(t *testing.T) {
+	svr := startTestServer(t, 1)
+	whip := CreateNewWhipServer(svr).Handler()
+	whep := CreateNewWhepServer(svr).Handler()
+	admin := CreateNewAdminServer(svr).Handler()
+
+	if rec := doRequest(whip, http.MethodPost, "/whip/room1", "application/sdp", testPublishOffer); rec.Code != http.StatusCreated {
+		t.Fatalf("WHIP POST = %d %s", rec.Code, rec.Body.String())
+	}
+	if rec := doRequest(whep, http.MethodPost, "/whep/room1", "application/sdp", testPlayOffer); rec.Code != http.StatusCreated {
+		t.Fatalf("WHEP POST = %d %s", rec.Code, rec.Body.String())
+	}
+
+	rom := svr.GetRoom("room1")
+	var publisherTransport string
+	rom.mutex.Lock()
+	for _, prw := range rom.peers {
+		if len(prw.producers) > 0 {
+			for id := range prw.transports {
+				publisherTransport = id
+			}
+		}
+	}
+	rom.mutex.Unlock()
+
+	if rec := doRequest(admin, http.MethodDelete, "/transports/"+publisherTransport, "", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("DELETE transport = %d %s", rec.Code, rec.Body.String())
+	}
+
+	left := func() (producers int, consumers int) {
+		rom.mutex.Lock()
+		defer rom.mutex.Unlock()
+
+		producers = len(rom.producerToPeer)
+		for _, prw := range rom.peers {
+			producers += len(prw.producers)
+			consumers += len(prw.consumers)
+		}
+		return
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		producers, consumers := left()
+		if producers == 0 && consumers == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d producers and %d consumers left", producers, consumers)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
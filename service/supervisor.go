@@ -0,0 +1,315 @@
+package service
+
+import (
+	"fmt"
+	"mediasoup-signal-controller/conf"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/cloudwebrtc/go-protoo/logger"
+)
+
+const (
+	SupervisionRunning = "running"
+	SupervisionBackoff = "backoff"
+	SupervisionFailed  = "failed"
+	SupervisionStopped = "stopped"
+
+	// Consecutive failed probes after which a worker is killed.
+	MaxProbeFailures = 2
+
+	// Exit reason of workers closed on purpose, they are replaced right away.
+	WorkerExitClosed = "closed"
+)
+
+// Supervision state of one worker seq, kept across restarts.
+type WorkerSupervision struct {
+	Seq            int        `json:"seq"`
+	Pid            int        `json:"pid"`
+	State          string     `json:"state"`
+	Restarts       int        `json:"restarts"`
+	RecentRestarts int        `json:"recentRestarts"`
+	LastExit       *time.Time `json:"lastExit,omitempty"`
+	LastExitReason string     `json:"lastExitReason,omitempty"`
+	NextRestart    *time.Time `json:"nextRestart,omitempty"`
+	LastProbe      *time.Time `json:"lastProbe,omitempty"`
+	LastProbeOk    bool       `json:"lastProbeOk"`
+	ProbeFailures  int        `json:"probeFailures"`
+
+	restartTimes []time.Time
+}
+
+// Supervisor restarts exited workers with exponential backoff, gives up on a
+// seq restarting more than maxRestarts times within restartWindow, and kills
+// workers which stop answering "worker.dump" probes or are not running
+// startTimeout after their start.
+type Supervisor struct {
+	server *Server
+
+	probeInterval time.Duration
+	probeTimeout  time.Duration
+	startTimeout  time.Duration
+	maxRestarts   int
+	restartWindow time.Duration
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+
+	mutex  sync.Mutex
+	states map[int]*WorkerSupervision
+	stop   chan struct{}
+}
+
+func CreateNewSupervisor(server *Server, cf conf.Supervisor_t) *Supervisor {
+	spv := &Supervisor{
+		server:        server,
+		probeInterval: 10 * time.Second,
+		probeTimeout:  5 * time.Second,
+		startTimeout:  10 * time.Second,
+		maxRestarts:   5,
+		restartWindow: 300 * time.Second,
+		minBackoff:    time.Second,
+		maxBackoff:    60 * time.Second,
+		states:        make(map[int]*WorkerSupervision),
+		stop:          make(chan struct{}),
+	}
+
+	if cf.ProbeInterval > 0 {
+		spv.probeInterval = time.Duration(cf.ProbeInterval) * time.Second
+	}
+	if cf.ProbeTimeout > 0 {
+		spv.probeTimeout = time.Duration(cf.ProbeTimeout) * time.Second
+	}
+	if cf.StartTimeout > 0 {
+		spv.startTimeout = time.Duration(cf.StartTimeout) * time.Second
+	}
+	if cf.MaxRestarts > 0 {
+		spv.maxRestarts = cf.MaxRestarts
+	}
+	if cf.RestartWindow > 0 {
+		spv.restartWindow = time.Duration(cf.RestartWindow) * time.Second
+	}
+	if cf.MinBackoff > 0 {
+		spv.minBackoff = time.Duration(cf.MinBackoff) * time.Millisecond
+	}
+	if cf.MaxBackoff > 0 {
+		spv.maxBackoff = time.Duration(cf.MaxBackoff) * time.Millisecond
+	}
+
+	return spv
+}
+
+func (spv *Supervisor) state(seq int) *WorkerSupervision {
+	state := spv.states[seq]
+	if state == nil {
+		state = &WorkerSupervision{
+			Seq:   seq,
+			State: SupervisionStopped,
+		}
+		spv.states[seq] = state
+	}
+	return state
+}
+
+// States returns a copy of the supervision state of every seq.
+func (spv *Supervisor) States() []WorkerSupervision {
+	spv.mutex.Lock()
+	defer spv.mutex.Unlock()
+
+	states := make([]WorkerSupervision, 0, len(spv.states))
+	for _, state := range spv.states {
+		states = append(states, *state)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Seq < states[j].Seq })
+
+	return states
+}
+
+// Start launches the worker for seq, a failed start is handled like an exit.
+func (spv *Supervisor) Start(seq int) {
+	worker := spv.server.startWorker(seq)
+
+	spv.mutex.Lock()
+	state := spv.state(seq)
+	state.NextRestart = nil
+	state.ProbeFailures = 0
+	if worker != nil {
+		state.Pid = worker.Pid
+		state.State = SupervisionRunning
+	}
+	spv.mutex.Unlock()
+
+	if worker == nil {
+		spv.OnExit(seq, 0, "start failed")
+		return
+	}
+	go worker.ExitMonitor()
+}
+
+// Reset restarts seq after the supervisor gave up on it, forgetting its
+// recent restarts. It returns false when seq is not in SupervisionFailed.
+func (spv *Supervisor) Reset(seq int) bool {
+	spv.mutex.Lock()
+	defer spv.mutex.Unlock()
+
+	select {
+	case <-spv.stop:
+		return false
+	default:
+	}
+
+	state := spv.states[seq]
+	if state == nil || state.State != SupervisionFailed {
+		return false
+	}
+
+	logger.Infof("Restart worker seq:%d, reset after %d recent restarts", seq, state.RecentRestarts)
+	state.restartTimes = nil
+	state.RecentRestarts = 0
+	state.State = SupervisionBackoff
+	state.Restarts++
+	go spv.Start(seq)
+
+	return true
+}
+
+// OnExit schedules the restart of seq, unless it keeps failing.
+func (spv *Supervisor) OnExit(seq int, pid int, reason string) {
+	spv.mutex.Lock()
+	defer spv.mutex.Unlock()
+
+	state := spv.state(seq)
+	if state.Pid != pid && pid != 0 {
+		// A worker we already replaced.
+		return
+	}
+
+	now := time.Now()
+	state.Pid = 0
+	state.LastExit = &now
+	state.LastExitReason = reason
+
+	recent := make([]time.Time, 0, len(state.restartTimes))
+	for _, at := range state.restartTimes {
+		if now.Sub(at) < spv.restartWindow {
+			recent = append(recent, at)
+		}
+	}
+	state.restartTimes = recent
+	state.RecentRestarts = len(recent)
+
+	if reason == WorkerExitClosed {
+		state.State = SupervisionBackoff
+		state.Restarts++
+		go spv.Start(seq)
+		return
+	}
+
+	if len(recent) >= spv.maxRestarts {
+		state.State = SupervisionFailed
+		logger.Errorf("worker seq:%d restarted %d times in %s, giving up (last exit: %s)",
+			seq, len(recent), spv.restartWindow, reason)
+		return
+	}
+
+	backoff := spv.minBackoff << uint(len(recent))
+	if backoff > spv.maxBackoff || backoff <= 0 {
+		backoff = spv.maxBackoff
+	}
+
+	state.State = SupervisionBackoff
+	nextRestart := now.Add(backoff)
+	state.NextRestart = &nextRestart
+	state.Restarts++
+	state.restartTimes = append(state.restartTimes, now)
+
+	logger.Infof("Restart worker seq:%d in %s (exit: %s)", seq, backoff, reason)
+
+	time.AfterFunc(backoff, func() {
+		select {
+		case <-spv.stop:
+			return
+		default:
+		}
+		if spv.server.Closing() {
+			return
+		}
+		spv.Start(seq)
+	})
+}
+
+// Run probes every worker each probeInterval until Stop.
+func (spv *Supervisor) Run() {
+	ticker := time.NewTicker(spv.probeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-spv.stop:
+			return
+		case <-ticker.C:
+			for _, worker := range spv.server.Workers() {
+				go spv.probe(worker)
+			}
+		}
+	}
+}
+
+func (spv *Supervisor) Stop() {
+	spv.mutex.Lock()
+	defer spv.mutex.Unlock()
+
+	select {
+	case <-spv.stop:
+	default:
+		close(spv.stop)
+	}
+
+	for _, state := range spv.states {
+		state.State = SupervisionStopped
+		state.NextRestart = nil
+	}
+}
+
+func (spv *Supervisor) probe(worker *Worker) {
+	if worker.Closed() {
+		return
+	}
+
+	var err error
+	if worker.Running() {
+		_, err = worker.dump(spv.probeTimeout)
+	} else if time.Since(worker.startedAt) < spv.startTimeout {
+		return
+	} else {
+		err = fmt.Errorf("not running %s after its start", spv.startTimeout)
+	}
+
+	spv.mutex.Lock()
+	state := spv.state(worker.seq)
+	if state.Pid != worker.Pid || len(worker.ExitReason()) > 0 {
+		spv.mutex.Unlock()
+		return
+	}
+	now := time.Now()
+	state.LastProbe = &now
+	state.LastProbeOk = err == nil
+	if err == nil {
+		state.ProbeFailures = 0
+	} else {
+		state.ProbeFailures++
+	}
+	failures := state.ProbeFailures
+	spv.mutex.Unlock()
+
+	worker.setHealthy(err == nil)
+	if err == nil {
+		return
+	}
+
+	logger.Warnf("worker %d seq:%d probe failed (%d/%d): %s", worker.Pid, worker.seq, failures, MaxProbeFailures, err.Error())
+	if failures >= MaxProbeFailures {
+		logger.Errorf("worker %d seq:%d unresponsive, killing it", worker.Pid, worker.seq)
+		worker.Kill("unresponsive")
+	}
+}
@@ -1,9 +1,21 @@
 package service
 
-import "mediasoup-signal-controller/common"
+import (
+	"encoding/json"
+	"fmt"
+	"mediasoup-signal-controller/common"
+	"mediasoup-signal-controller/rtp"
+
+	"github.com/cloudwebrtc/go-protoo/logger"
+	"github.com/go-basic/uuid"
+)
 
 type TransportBase interface {
 	Id() string
+	Close()
+	Dump() (json.RawMessage, error)
+	getConsumer(consumerId string) *Consumer
+	routerClosed()
 }
 
 type Transport struct {
@@ -20,3 +32,112 @@ type Transport struct {
 	internal            common.RTCTransportInternal
 	appData             common.TransportAppData
 }
+
+// closeChildren drops the producers, consumers and data producers of a closed
+// transport. The worker closes whatever is on a router or a transport along
+// with it without notifying, so routerClosed, transportClosed and the like
+// only drop the objects from the controller and tell the peers.
+func (transport *Transport) closeChildren() {
+	for _, producer := range transport.producers {
+		producer.transportClosed()
+	}
+	for _, consumer := range transport.consumers {
+		consumer.close()
+	}
+	for _, dataProducer := range transport.dataProducers {
+		dataProducer.transportClosed()
+	}
+
+	transport.producers = make(map[string]*Producer)
+	transport.consumers = make(map[string]*Consumer)
+	transport.dataProducers = make(map[string]*DataProducer)
+	transport.dataConsumers = make(map[string]*DataConsumer)
+}
+
+func (transport *Transport) getConsumer(consumerId string) *Consumer {
+	return transport.consumers[consumerId]
+}
+
+// consume creates a consumer of the producer. mid is the one of the media
+// section negotiated for it, if any, otherwise the next one of the transport.
+func (transport *Transport) consume(consumerPeer *PeerWrapper, producerId string, rtpCapabilities rtp.RtpCapabilities, paused bool, pipe bool, mid string) (*Consumer, error) {
+
+	logger.Debugf("==============Transport consume:producerID:%s, tranport:%p==============", producerId, transport)
+	producer := transport.router.GetProducerbyId(producerId)
+	if producer == nil {
+		logger.Errorf("There is no producer for id:%s", producerId)
+		return nil, fmt.Errorf("producer %s not found", producerId)
+	}
+
+	rtpParameters := rtp.GetConsumerRtpParameters(&producer.data.consumableRtpParameters, rtpCapabilities, pipe)
+
+	if rtpParameters == nil {
+		logger.Debugf("Transport consume rtpParameter is nil")
+		return nil, fmt.Errorf("cannot consume producer %s", producerId)
+	}
+
+	if !pipe {
+		rtp.MapConsumerRtpParameters(rtpParameters, rtpCapabilities)
+	}
+
+	logger.Debugf("Transport consume rtpParameter:%+v", rtpParameters)
+	if len(mid) > 0 {
+		rtpParameters.Mid = mid
+	} else if !pipe {
+		rtpParameters.Mid = fmt.Sprintf("%d", transport.nextMidForConsumers)
+		transport.nextMidForConsumers++
+
+		if transport.nextMidForConsumers == 100000000 {
+			transport.nextMidForConsumers = 0
+		}
+	}
+
+	internal := &common.ConsumerInternal{
+		RTCTransportInternal: transport.internal,
+		ConsumerId:           uuid.New(),
+		ProducerId:           producerId,
+	}
+
+	consumerType := "pipe"
+	if !pipe {
+		consumerType = producer.data.producerType
+	}
+
+	consumerData := &common.ConsumeData{
+		Kind:                   producer.data.kind,
+		RtpParameters:          rtpParameters,
+		ConsumableRtpEncodings: producer.data.consumableRtpParameters.Encodings,
+		ConsumerType:           consumerType,
+		Paused:                 paused,
+	}
+
+	status, err := transport.router.Consume(consumerData, internal)
+	if err != nil {
+		return nil, err
+	}
+
+	consumerProperty := ConsumerProperty{
+		kind:          producer.data.kind,
+		rtpParameters: *rtpParameters,
+		consumerType:  consumerType,
+	}
+
+	consumer := &Consumer{
+		internal:       *internal,
+		data:           consumerProperty,
+		channel:        transport.channel,
+		payloadChannel: transport.payloadChannel,
+		paused:         status.Paused,
+		producerPaused: status.ProducerPaused,
+		score:          status.Score,
+		peer:           consumerPeer,
+		router:         transport.router,
+		transport:      transport,
+	}
+
+	transport.consumers[internal.ConsumerId] = consumer
+
+	transport.channel.AddListener(internal.ConsumerId, consumer)
+
+	return consumer, nil
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"mediasoup-signal-controller/conf"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/cloudwebrtc/go-protoo/logger"
+)
+
+// Worker version used when neither the config nor the worker installation
+// tells us which mediasoup-worker we are driving.
+const DefaultWorkerVersion = "3.6.32"
+
+type WorkerVersion struct {
+	Major int
+	Minor int
+	Patch int
+}
+
+type WorkerFeature string
+
+const (
+	FeatureActiveSpeakerObserver WorkerFeature = "ActiveSpeakerObserver"
+	// Channel messages are framed with a uint32 length prefix instead of a
+	// netstring.
+	FeatureLengthPrefixedChannel WorkerFeature = "LengthPrefixedChannel"
+)
+
+// First mediasoup-worker release shipping each feature.
+var workerFeatureVersions = map[WorkerFeature]WorkerVersion{
+	FeatureActiveSpeakerObserver: {3, 8, 0},
+	FeatureLengthPrefixedChannel: {3, 9, 0},
+}
+
+func ParseWorkerVersion(str string) (WorkerVersion, error) {
+	var version WorkerVersion
+
+	str = strings.TrimPrefix(strings.TrimSpace(str), "v")
+	// Drop pre-release and build suffixes (e.g. "3.9.0-beta.1").
+	if i := strings.IndexAny(str, "-+"); i >= 0 {
+		str = str[:i]
+	}
+
+	parts := strings.Split(str, ".")
+	if len(parts) != 3 {
+		return version, fmt.Errorf("invalid mediasoup worker version %q", str)
+	}
+
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return version, fmt.Errorf("invalid mediasoup worker version %q", str)
+		}
+		numbers[i] = n
+	}
+
+	version.Major, version.Minor, version.Patch = numbers[0], numbers[1], numbers[2]
+	return version, nil
+}
+
+func (v WorkerVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+func (v WorkerVersion) AtLeast(other WorkerVersion) bool {
+	if v.Major != other.Major {
+		return v.Major > other.Major
+	}
+	if v.Minor != other.Minor {
+		return v.Minor > other.Minor
+	}
+	return v.Patch >= other.Patch
+}
+
+func (v WorkerVersion) Supports(feature WorkerFeature) bool {
+	required, ok := workerFeatureVersions[feature]
+	if !ok {
+		return false
+	}
+	return v.AtLeast(required)
+}
+
+// DetectWorkerVersion returns the mediasoup-worker version and where it was
+// found. The configured version wins, then the package.json of the mediasoup
+// installation the worker binary was built in, then DefaultWorkerVersion.
+func DetectWorkerVersion(cf *conf.MediaSoup_t) (WorkerVersion, string) {
+
+	if len(cf.WorkerVersion) > 0 {
+		version, err := ParseWorkerVersion(cf.WorkerVersion)
+		if err == nil {
+			return version, "config"
+		}
+		logger.Errorf("Ignoring workerVersion from config: %s", err.Error())
+	}
+
+	if str, path := workerPackageVersion(cf.WorkerPath); len(str) > 0 {
+		version, err := ParseWorkerVersion(str)
+		if err == nil {
+			return version, path
+		}
+		logger.Errorf("Ignoring version from %s: %s", path, err.Error())
+	}
+
+	version, _ := ParseWorkerVersion(DefaultWorkerVersion)
+	return version, "default"
+}
+
+// workerPackageVersion walks up from the worker binary looking for the
+// package.json of the mediasoup module (e.g. node_modules/mediasoup/worker/out/Release/mediasoup-worker).
+func workerPackageVersion(workerPath string) (string, string) {
+
+	type packageJson struct {
+		Name    string `json:"name"`
+		Version string `json:"version"`
+	}
+
+	dir, err := filepath.Abs(filepath.Dir(workerPath))
+	if err != nil {
+		return "", ""
+	}
+
+	for {
+		path := filepath.Join(dir, "package.json")
+		if data, err := ioutil.ReadFile(path); err == nil {
+			var pkg packageJson
+			if json.Unmarshal(data, &pkg) == nil && strings.Contains(pkg.Name, "mediasoup") && len(pkg.Version) > 0 {
+				return pkg.Version, path
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir || parent == string(os.PathSeparator) {
+			return "", ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"io/ioutil"
+	"mediasoup-signal-controller/conf"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseWorkerVersion(t *testing.T) {
+	tests := []struct {
+		str     string
+		want    WorkerVersion
+		wantErr bool
+	}{
+		{str: "3.9.2", want: WorkerVersion{3, 9, 2}},
+		{str: "v3.10.0", want: WorkerVersion{3, 10, 0}},
+		{str: " 3.6.32\n", want: WorkerVersion{3, 6, 32}},
+		{str: "3.9.0-beta.1", want: WorkerVersion{3, 9, 0}},
+		{str: "3.9.0+build.7", want: WorkerVersion{3, 9, 0}},
+		{str: "", wantErr: true},
+		{str: "3.9", wantErr: true},
+		{str: "3.9.0.1", wantErr: true},
+		{str: "3.x.0", wantErr: true},
+		{str: "3.-1.0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseWorkerVersion(tt.str)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseWorkerVersion(%q) = %v, want error", tt.str, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("ParseWorkerVersion(%q) = %v, %v, want %v", tt.str, got, err, tt.want)
+		}
+	}
+}
+
+func TestWorkerVersionSupports(t *testing.T) {
+	tests := []struct {
+		version WorkerVersion
+		feature WorkerFeature
+		want    bool
+	}{
+		{WorkerVersion{3, 6, 32}, FeatureActiveSpeakerObserver, false},
+		{WorkerVersion{3, 8, 0}, FeatureActiveSpeakerObserver, true},
+		{WorkerVersion{3, 8, 4}, FeatureLengthPrefixedChannel, false},
+		{WorkerVersion{3, 9, 0}, FeatureLengthPrefixedChannel, true},
+		{WorkerVersion{4, 0, 0}, FeatureLengthPrefixedChannel, true},
+		{WorkerVersion{4, 0, 0}, WorkerFeature("Unknown"), false},
+	}
+
+	for _, tt := range tests {
+		if got := tt.version.Supports(tt.feature); got != tt.want {
+			t.Errorf("%v.Supports(%s) = %t, want %t", tt.version, tt.feature, got, tt.want)
+		}
+	}
+}
+
+func TestDetectWorkerVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mediasoup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	workerDir := filepath.Join(dir, "worker", "out", "Release")
+	if err := os.MkdirAll(workerDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	packageJson := filepath.Join(dir, "package.json")
+	if err := ioutil.WriteFile(packageJson, []byte(`{"name": "mediasoup", "version": "3.9.5"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// A package.json of another module nearer the worker is skipped.
+	if err := ioutil.WriteFile(filepath.Join(dir, "worker", "package.json"), []byte(`{"name": "other", "version": "1.0.0"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	workerPath := filepath.Join(workerDir, "mediasoup-worker")
+
+	tests := []struct {
+		name       string
+		cf         conf.MediaSoup_t
+		want       WorkerVersion
+		wantSource string
+	}{
+		{
+			name:       "config",
+			cf:         conf.MediaSoup_t{WorkerVersion: "3.8.1", WorkerPath: workerPath},
+			want:       WorkerVersion{3, 8, 1},
+			wantSource: "config",
+		},
+		{
+			name:       "package.json",
+			cf:         conf.MediaSoup_t{WorkerPath: workerPath},
+			want:       WorkerVersion{3, 9, 5},
+			wantSource: packageJson,
+		},
+		{
+			name:       "invalid config",
+			cf:         conf.MediaSoup_t{WorkerVersion: "latest", WorkerPath: workerPath},
+			want:       WorkerVersion{3, 9, 5},
+			wantSource: packageJson,
+		},
+		{
+			name:       "default",
+			cf:         conf.MediaSoup_t{WorkerPath: filepath.Join(os.TempDir(), "no-mediasoup", "mediasoup-worker")},
+			want:       WorkerVersion{3, 6, 32},
+			wantSource: "default",
+		},
+	}
+
+	for _, tt := range tests {
+		got, source := DetectWorkerVersion(&tt.cf)
+		if got != tt.want || source != tt.wantSource {
+			t.Errorf("%s: DetectWorkerVersion() = %v, %s, want %v, %s", tt.name, got, source, tt.want, tt.wantSource)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mediasoup-signal-controller/common"
+	"mediasoup-signal-controller/rtp"
+	"mediasoup-signal-controller/sdp"
+	"strings"
+)
+
+// SDP offer/answer with WebRTC endpoints not speaking protoo, as used by WHIP
+// and WHEP. Every media section of a session is bundled on one transport.
+
+// remoteDtlsParameters returns the DTLS parameters of the offering endpoint
+// and the setup of the answer. An endpoint offering actpass or active is the
+// DTLS client.
+func remoteDtlsParameters(media *sdp.Media) (*common.DtlsParameter_t, string, error) {
+	if len(media.Fingerprints) == 0 {
+		return nil, "", errors.New("missing fingerprint")
+	}
+
+	dtlsParameters := &common.DtlsParameter_t{
+		Role:         "client",
+		Fingerprints: make([]common.Fingerprint_t, 0, len(media.Fingerprints)),
+	}
+	for _, fingerprint := range media.Fingerprints {
+		dtlsParameters.Fingerprints = append(dtlsParameters.Fingerprints, common.Fingerprint_t{
+			Algorithm: fingerprint.Algorithm,
+			Value:     fingerprint.Value,
+		})
+	}
+
+	switch media.Setup {
+	case "", "actpass", "active":
+		return dtlsParameters, "passive", nil
+	case "passive":
+		dtlsParameters.Role = "server"
+		return dtlsParameters, "active", nil
+	}
+
+	return nil, "", fmt.Errorf("invalid setup: %s", media.Setup)
+}
+
+// offeredHeaderExtensions keeps the header extensions of the offer the router
+// supports for the kind of the media section, with the offered ids.
+func offeredHeaderExtensions(media *sdp.Media, caps *rtp.RtpCapabilities) []rtp.RtpHeaderExtensionParameters {
+	headerExtensions := make([]rtp.RtpHeaderExtensionParameters, 0)
+
+	for _, ext := range media.HeaderExtensions {
+		for _, capExt := range caps.HeaderExtensions {
+			if capExt.Uri == ext.Uri && (len(capExt.Kind) == 0 || capExt.Kind == media.Kind) {
+				headerExtensions = append(headerExtensions, ext)
+				break
+			}
+		}
+	}
+
+	return headerExtensions
+}
+
+// producerRtpParameters translates a sending media section of an offer into
+// the RTP parameters of a producer. Simulcast streams are told apart by rid,
+// others by ssrc.
+func producerRtpParameters(media *sdp.Media, caps *rtp.RtpCapabilities) (*rtp.ClientRtpParameters, error) {
+	rtpParameters := &rtp.ClientRtpParameters{
+		Mid:              media.Mid,
+		Codecs:           rtp.ReduceCodecs(media.Codecs, caps),
+		HeaderExtensions: offeredHeaderExtensions(media, caps),
+		Encodings:        make([]rtp.RtpEncodingParameters, 0),
+		Rtcp: rtp.RtcpParameters{
+			Cname:       media.Cname,
+			ReducedSize: true,
+			Mux:         true,
+		},
+	}
+
+	if len(rtpParameters.Codecs) == 0 {
+		return nil, fmt.Errorf("no supported codec for %s", media.Kind)
+	}
+
+	for _, rid := range media.Rids {
+		if rid.Direction == "send" {
+			rtpParameters.Encodings = append(rtpParameters.Encodings, rtp.RtpEncodingParameters{
+				Rid: rid.Id,
+			})
+		}
+	}
+	if len(rtpParameters.Encodings) > 0 {
+		return rtpParameters, nil
+	}
+
+	for _, group := range media.SsrcGroups {
+		if group.Semantics == "FID" && len(group.Ssrcs) == 2 {
+			rtpParameters.Encodings = append(rtpParameters.Encodings, rtp.RtpEncodingParameters{
+				Ssrc:    group.Ssrcs[0],
+				RtxSsrc: &rtp.RtxSsrc_t{Ssrc: group.Ssrcs[1]},
+			})
+			return rtpParameters, nil
+		}
+	}
+
+	encoding := rtp.RtpEncodingParameters{}
+	if len(media.Ssrcs) > 0 {
+		encoding.Ssrc = media.Ssrcs[0].Id
+	}
+	// Without ssrc the stream is told apart by mid.
+	rtpParameters.Encodings = append(rtpParameters.Encodings, encoding)
+
+	return rtpParameters, nil
+}
+
+// offeredCapabilities are the RTP capabilities of a receiving media section
+// of an offer, to consume with.
+func offeredCapabilities(media *sdp.Media) rtp.RtpCapabilities {
+	caps := rtp.RtpCapabilities{
+		Codecs:           make([]rtp.RtpCodecCapability, 0, len(media.Codecs)),
+		HeaderExtensions: make([]rtp.RtpHeaderExtension, 0, len(media.HeaderExtensions)),
+	}
+
+	for _, codec := range media.Codecs {
+		caps.Codecs = append(caps.Codecs, rtp.RtpCodecCapability{
+			Kind:                 media.Kind,
+			MimeType:             codec.MimeType,
+			PreferredPayloadType: codec.PayloadType,
+			ClockRate:            codec.ClockRate,
+			Channels:             codec.Channels,
+			Parameters:           codec.Parameters,
+			RtcpFeedback:         codec.RtcpFeedback,
+		})
+	}
+
+	for _, ext := range media.HeaderExtensions {
+		caps.HeaderExtensions = append(caps.HeaderExtensions, rtp.RtpHeaderExtension{
+			Kind:        media.Kind,
+			Uri:         ext.Uri,
+			PreferredId: ext.Id,
+			Direction:   "sendrecv",
+		})
+	}
+
+	return caps
+}
+
+// answerMedia starts the answer to a media section of an offer, rejected
+// until it gets a port.
+func answerMedia(offer *sdp.Media) *sdp.Media {
+	media := &sdp.Media{
+		Kind:      offer.Kind,
+		Port:      0,
+		Protocol:  offer.Protocol,
+		Address:   "0.0.0.0",
+		Mid:       offer.Mid,
+		Direction: "inactive",
+		Codecs:    offer.Codecs,
+		Formats:   offer.Formats,
+	}
+	if len(media.Codecs) > 1 {
+		media.Codecs = media.Codecs[:1]
+	}
+
+	return media
+}
+
+// acceptMedia makes an answer media section use the transport.
+func (wrt *WebRtcTransport) acceptMedia(media *sdp.Media, setup string) error {
+	var iceParameters common.IceParameter_t
+	var iceCandidates []common.IceCandidate_t
+	var dtlsParameters common.DtlsParameter_t
+
+	if err := json.Unmarshal(wrt.data.IceParameters, &iceParameters); err != nil {
+		return fmt.Errorf("invalid iceParameters: %s", err.Error())
+	}
+	if err := json.Unmarshal(wrt.data.IceCandidates, &iceCandidates); err != nil {
+		return fmt.Errorf("invalid iceCandidates: %s", err.Error())
+	}
+	if err := json.Unmarshal(wrt.data.DtlsParameters, &dtlsParameters); err != nil {
+		return fmt.Errorf("invalid dtlsParameters: %s", err.Error())
+	}
+
+	media.Port = 7
+	media.Address = "127.0.0.1"
+	media.Protocol = "UDP/TLS/RTP/SAVPF"
+	media.RtcpMux = true
+	media.RtcpRsize = true
+	media.IceUfrag = iceParameters.UsernameFragment
+	media.IcePwd = iceParameters.Password
+	media.Setup = setup
+
+	media.Fingerprints = make([]sdp.Fingerprint, 0, len(dtlsParameters.Fingerprints))
+	for _, fingerprint := range dtlsParameters.Fingerprints {
+		media.Fingerprints = append(media.Fingerprints, sdp.Fingerprint{
+			Algorithm: fingerprint.Algorithm,
+			Value:     strings.ToUpper(fingerprint.Value),
+		})
+	}
+
+	media.Candidates = make([]string, 0, len(iceCandidates))
+	for _, candidate := range iceCandidates {
+		line := fmt.Sprintf("%s 1 %s %d %s %d typ %s", candidate.Foundation, candidate.Protocol,
+			candidate.Priority, candidate.Ip, candidate.Port, candidate.Type)
+		if candidate.Protocol == "tcp" {
+			line += " tcptype " + candidate.TcpType
+		}
+		media.Candidates = append(media.Candidates, line)
+	}
+
+	return nil
+}
+
+// answerSession wraps the answer media sections, bundling the accepted ones.
+func answerSession(media []*sdp.Media) *sdp.Session {
+	session := sdp.NewSession("127.0.0.1")
+	session.Media = media
+
+	mids := make([]string, 0, len(media))
+	for _, m := range media {
+		if m.Port != 0 && len(m.Mid) > 0 {
+			mids = append(mids, m.Mid)
+		}
+	}
+
+	session.Attributes = append(session.Attributes, "ice-lite")
+	if len(mids) > 0 {
+		session.Attributes = append(session.Attributes, "group:BUNDLE "+strings.Join(mids, " "))
+	}
+	session.Attributes = append(session.Attributes, "msid-semantic: WMS *")
+
+	return session
+}
+
+// iceFragment is the trickle-ice-sdpfrag (RFC 8840) answering an ICE restart
+// requested for the media sections of fragment.
+func (wrt *WebRtcTransport) iceFragment(fragment *sdp.Session) (string, error) {
+	media := &sdp.Media{}
+	if err := wrt.acceptMedia(media, ""); err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	b.WriteString("a=ice-lite\r\n")
+	fmt.Fprintf(&b, "a=ice-ufrag:%s\r\n", media.IceUfrag)
+	fmt.Fprintf(&b, "a=ice-pwd:%s\r\n", media.IcePwd)
+	for _, m := range fragment.Media {
+		fmt.Fprintf(&b, "m=%s 9 %s 0\r\n", m.Kind, m.Protocol)
+		fmt.Fprintf(&b, "a=mid:%s\r\n", m.Mid)
+		for _, candidate := range media.Candidates {
+			fmt.Fprintf(&b, "a=candidate:%s\r\n", candidate)
+		}
+		b.WriteString("a=end-of-candidates\r\n")
+	}
+
+	return b.String(), nil
+}
@@ -15,6 +15,10 @@ type WebRtcTransport struct {
 
 	data common.WebRtcTransportData
 	role string
+
+	// ICE username fragment of the remote endpoint of a WHEP session, to tell
+	// ICE restarts from trickled candidates.
+	remoteIceUfrag string
 }
 
 func createWebRtcTransport(internal *common.RTCTransportInternal, data json.RawMessage,
@@ -29,6 +33,7 @@ func createWebRtcTransport(internal *common.RTCTransportInternal, data json.RawM
 			payloadChannel:      payloadChannel,
 			internal:            *internal,
 			nextMidForConsumers: 0,
+			appData:             appData,
 		},
 	}
 
@@ -49,11 +54,30 @@ func (wrt *WebRtcTransport) Close() {
 		return
 	}
 
+	wrt.channel.Request("transport.close", wrt.internal, nil, wrt.router, nil, nil)
+	wrt.close()
+
+	wrt.router.OnTransportClose(wrt)
+}
+
+func (wrt *WebRtcTransport) routerClosed() {
+	if wrt.closed {
+		return
+	}
+
+	wrt.close()
+}
+
+func (wrt *WebRtcTransport) close() {
+	wrt.closed = true
+
 	wrt.data.IceState = "closed"
 	wrt.data.IceSelectedTuple = nil
 	wrt.data.SctpState = "closed"
 
-	wrt.channel.Request("transport.close", wrt.internal, nil, wrt.router, nil, nil)
+	wrt.channel.RemoveListener(wrt.Id())
+	wrt.channel.RemoveTransport(wrt.Id())
+	wrt.closeChildren()
 }
 
 func (wrt *WebRtcTransport) Id() string {
@@ -68,16 +92,38 @@ func (wrt *WebRtcTransport) connect(dtlsParameter *common.DtlsParameter_t) {
 	wrt.role = role
 }
 
-func (wrt *WebRtcTransport) produce(prw *PeerWrapper, cpd *common.ClientProduceData, id string, paused bool, keyFrameRequestDelay int) *Producer {
+// RestartIce gets new local ICE parameters, the remote endpoint has to
+// restart ICE with them.
+func (wrt *WebRtcTransport) RestartIce() (*common.IceParameter_t, error) {
+	iceParameters, err := wrt.router.RestartIce(&wrt.internal)
+	if err != nil {
+		return nil, err
+	}
+
+	wrt.data.IceParameters, _ = json.Marshal(iceParameters)
+	return iceParameters, nil
+}
+
+// produce creates a producer of the RTP parameters sent by the peer. The error
+// tells what is wrong with them, or that the worker refused the producer.
+func (wrt *WebRtcTransport) produce(prw *PeerWrapper, cpd *common.ClientProduceData, id string, paused bool, keyFrameRequestDelay int) (*Producer, error) {
 
 	if len(id) > 0 {
 		if wrt.producers[id] != nil {
-			return nil
+			return nil, fmt.Errorf("a Producer with same id %q already exists", id)
 		}
 	}
 
-	if cpd.Kind != "audio" && cpd.Kind != "video" {
-		return nil
+	if err := rtp.ValidateRtpParameters(cpd.Kind, &cpd.RtpParameters); err != nil {
+		return nil, fmt.Errorf("invalid rtpParameters: %s", err.Error())
+	}
+
+	if len(cpd.RtpParameters.Mid) > 0 {
+		for _, producer := range wrt.producers {
+			if producer.data.rtpParameters.Mid == cpd.RtpParameters.Mid {
+				return nil, fmt.Errorf("mid %q already used by Producer %s", cpd.RtpParameters.Mid, producer.id)
+			}
+		}
 	}
 
 	routerRtpCapabilities := &wrt.router.rtpCapabilities
@@ -86,7 +132,10 @@ func (wrt *WebRtcTransport) produce(prw *PeerWrapper, cpd *common.ClientProduceD
 
 	logger.Debugf("client request RtpParameters========%+v", cpd.RtpParameters)
 
-	rtpMapping := rtp.GetProducerRtpParametersMapping(&cpd.RtpParameters, routerRtpCapabilities)
+	rtpMapping, err := rtp.GetProducerRtpParametersMapping(&cpd.RtpParameters, routerRtpCapabilities)
+	if err != nil {
+		return nil, err
+	}
 
 	logger.Debugf("rtpMapping========%+v", *rtpMapping)
 
@@ -107,7 +156,10 @@ func (wrt *WebRtcTransport) produce(prw *PeerWrapper, cpd *common.ClientProduceD
 		Paused:               paused,
 	}
 
-	producerType := wrt.router.Produce(producerData, internal)
+	producerType, err := wrt.router.Produce(producerData, internal)
+	if err != nil {
+		return nil, err
+	}
 
 	producerProperty := &ProducerProperty{
 		kind:                    cpd.Kind,
@@ -133,10 +185,10 @@ func (wrt *WebRtcTransport) produce(prw *PeerWrapper, cpd *common.ClientProduceD
 
 	wrt.channel.AddListener(producer.id, producer)
 
-	return producer
+	return producer, nil
 }
 
-func (wrt *WebRtcTransport) produceData(pdd *common.ProduceDataData) *DataProducer {
+func (wrt *WebRtcTransport) produceData(pdd *common.ProduceDataData) (*DataProducer, error) {
 
 	internal := &common.DataProducerInternal{
 		RTCTransportInternal: wrt.internal,
@@ -150,7 +202,10 @@ func (wrt *WebRtcTransport) produceData(pdd *common.ProduceDataData) *DataProduc
 		Protocol:             pdd.Protocol,
 	}
 
-	data := wrt.router.ProduceData(dataProducerData, internal)
+	data, err := wrt.router.ProduceData(dataProducerData, internal)
+	if err != nil {
+		return nil, err
+	}
 
 	dp := &DataProducer{
 		internal: *internal,
@@ -160,83 +215,16 @@ func (wrt *WebRtcTransport) produceData(pdd *common.ProduceDataData) *DataProduc
 			DataProduceType:      "sctp",
 			sctpStreamParameters: data.SctpStreamParameters,
 		},
+		channel: wrt.channel,
+		router:  wrt.router,
 	}
 
-	wrt.channel.AddListener(internal.DataProducerId, dp)
-
-	return dp
-}
-
-func (wrt *WebRtcTransport) consume(consumerPeer *PeerWrapper, producerId string, rtpCapabilities rtp.RtpCapabilities, paused bool, pipe bool) *Consumer {
+	wrt.dataProducers[dp.Id()] = dp
+	wrt.router.OnNewDataProducer(dp)
 
-	logger.Debugf("==============WebRtcTransport consume:producerID:%s, tranport:%p==============", producerId, wrt)
-	producer := wrt.router.GetProducerbyId(producerId)
-	if producer == nil {
-		logger.Errorf("There is no producer for id:%s", producerId)
-		return nil
-	}
-
-	rtpParameters := rtp.GetConsumerRtpParameters(&producer.data.consumableRtpParameters, rtpCapabilities, false)
-
-	if rtpParameters == nil {
-		logger.Debugf("WebRtcTransport consume rtpParameter is nil")
-		return nil
-	}
-
-	logger.Debugf("WebRtcTransport consume rtpParameter:%+v", rtpParameters)
-	if !pipe {
-		rtpParameters.Mid = fmt.Sprintf("%d", wrt.nextMidForConsumers)
-		wrt.nextMidForConsumers++
-
-		if wrt.nextMidForConsumers == 100000000 {
-			wrt.nextMidForConsumers = 0
-		}
-	}
-
-	internal := &common.ConsumerInternal{
-		RTCTransportInternal: wrt.internal,
-		ConsumerId:           uuid.New(),
-		ProducerId:           producerId,
-	}
-
-	consumerType := "pipe"
-	if !pipe {
-		consumerType = producer.data.producerType
-	}
-
-	consumerData := &common.ConsumeData{
-		Kind:                   producer.data.kind,
-		RtpParameters:          rtpParameters,
-		ConsumableRtpEncodings: producer.data.consumableRtpParameters.Encodings,
-		ConsumerType:           consumerType,
-		Paused:                 paused,
-	}
-
-	status := wrt.router.Consume(consumerData, internal)
-
-	consumerProperty := ConsumerProperty{
-		kind:          producer.data.kind,
-		rtpParameters: *rtpParameters,
-		consumerType:  consumerType,
-	}
-
-	consumer := &Consumer{
-		internal:       *internal,
-		data:           consumerProperty,
-		channel:        wrt.channel,
-		payloadChannel: wrt.payloadChannel,
-		paused:         status.Paused,
-		producerPaused: status.ProducerPaused,
-		score:          status.Score,
-		peer:           consumerPeer,
-		router:         wrt.router,
-	}
-
-	wrt.consumers[internal.ConsumerId] = consumer
-
-	wrt.channel.AddListener(internal.ConsumerId, consumer)
+	wrt.channel.AddListener(internal.DataProducerId, dp)
 
-	return consumer
+	return dp, nil
 }
 
 func (wrt *WebRtcTransport) consumeData(dataProducerId string) *DataConsumer {
@@ -249,6 +237,11 @@ func (wrt *WebRtcTransport) consumeData(dataProducerId string) *DataConsumer {
 	return nil
 }
 
+func (wrt *WebRtcTransport) Dump() (json.RawMessage, error) {
+
+	return wrt.router.dump("transport.dump", &wrt.internal)
+}
+
 func (wrt *WebRtcTransport) getStats() json.RawMessage {
 
 	return wrt.router.getTransportStats(&wrt.internal)
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mediasoup-signal-controller/common"
+	"mediasoup-signal-controller/sdp"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/cloudwebrtc/go-protoo/logger"
+	"github.com/go-basic/uuid"
+)
+
+// WhepServer lets WebRTC-HTTP egress (WHEP) players, e.g. a browser with a
+// plain RTCPeerConnection, watch a room. Each receiving media section of the
+// offer gets a consumer of a producer of that kind.
+//
+//	POST /whep/{roomId}             SDP offer in, SDP answer out, the
+//	                                Location header is the session resource.
+//	                                ?peerId= or ?producerId= (repeated) pick
+//	                                what to watch, all producers by default
+//	PATCH /whep/{roomId}/{peerId}   trickle ICE or ICE restart, with an
+//	                                application/trickle-ice-sdpfrag body
+//	DELETE /whep/{roomId}/{peerId}  stop playing
+//	OPTIONS /whep/...               CORS preflight of browsers playing from
+//	                                another origin
+//
+// Media is sent with the payload types and header extension ids of the offer.
+// Players are peers of the room which do not join it, the other peers are not
+// told about them.
+type WhepServer struct {
+	server *Server
+	mux    *http.ServeMux
+}
+
+func CreateNewWhepServer(server *Server) *WhepServer {
+	whep := &WhepServer{
+		server: server,
+		mux:    http.NewServeMux(),
+	}
+
+	whep.mux.HandleFunc("/whep/", whep.handleWhep)
+
+	return whep
+}
+
+func (whep *WhepServer) Handler() http.Handler {
+	return whep.mux
+}
+
+func (whep *WhepServer) handleWhep(w http.ResponseWriter, r *http.Request) {
+	// Players on another origin read Location to tear the session down.
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Expose-Headers", "Location")
+	if r.Method == http.MethodOptions {
+		w.Header().Set("Access-Control-Allow-Methods", "POST, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-Match")
+		w.Header().Set("Accept-Post", "application/sdp")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/whep/"), "/")
+	if len(parts[0]) == 0 || len(parts) > 2 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	rom := whep.server.GetRoom(parts[0])
+	if rom == nil {
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		whep.handlePlay(w, r, rom)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		if !rom.ClosePeer(parts[1]) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		whep.handleTrickle(w, r, rom, parts[1])
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (whep *WhepServer) handlePlay(w http.ResponseWriter, r *http.Request, rom *Room) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/sdp") {
+		http.Error(w, "expected application/sdp", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offer, err := sdp.Parse(string(body))
+	if err != nil {
+		http.Error(w, "invalid offer: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rom.mutex.Lock()
+	defer rom.mutex.Unlock()
+
+	if rom.Closed() {
+		http.Error(w, "room not found", http.StatusNotFound)
+		return
+	}
+
+	producers, err := rom.selectProducers(r.URL.Query().Get("peerId"), r.URL.Query()["producerId"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	peerInfo := PeerInfo{
+		Id:          uuid.New(),
+		DisplayName: "WHEP player",
+		Device: Device_t{
+			Flag: "whep",
+			Name: r.UserAgent(),
+		},
+	}
+
+	answer, err := rom.play(peerInfo, offer, producers)
+	if err != nil {
+		logger.Warnf("WHEP play of room %s failed: %s", rom.roomId, err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/sdp")
+	w.Header().Set("Location", fmt.Sprintf("/whep/%s/%s", rom.roomId, peerInfo.Id))
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write([]byte(answer.String()))
+}
+
+// handleTrickle accepts candidates of the player, which are not needed with
+// an ICE lite transport, or restarts ICE when the fragment has a new ufrag.
+func (whep *WhepServer) handleTrickle(w http.ResponseWriter, r *http.Request, rom *Room, peerId string) {
+	rom.mutex.Lock()
+	defer rom.mutex.Unlock()
+
+	transport := rom.playerTransport(peerId)
+	if transport == nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/trickle-ice-sdpfrag") {
+		http.Error(w, "expected application/trickle-ice-sdpfrag", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fragment, err := sdp.ParseFragment(string(body))
+	if err != nil {
+		http.Error(w, "invalid fragment: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ufrag := fragment.IceUfrag
+	if len(fragment.Media) > 0 {
+		ufrag = fragment.Media[0].IceUfrag
+	}
+	if len(ufrag) == 0 || ufrag == transport.remoteIceUfrag {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	if _, err := transport.RestartIce(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	transport.remoteIceUfrag = ufrag
+
+	answer, err := transport.iceFragment(fragment)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/trickle-ice-sdpfrag")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write([]byte(answer))
+}
+
+// selectProducers returns the producers of a peer, the given ones, or else all
+// producers of the room, grouped by peer.
+func (rom *Room) selectProducers(peerId string, producerIds []string) ([]*Producer, error) {
+	producers := make([]*Producer, 0)
+
+	if len(producerIds) > 0 {
+		for _, producerId := range producerIds {
+			producer := rom.GetProducerbyId(producerId)
+			if producer == nil {
+				return nil, fmt.Errorf("producer %s not found", producerId)
+			}
+			producers = append(producers, producer)
+		}
+		return producers, nil
+	}
+
+	peers := make([]*PeerWrapper, 0, len(rom.peers))
+	if len(peerId) > 0 {
+		prw := rom.peers[peerId]
+		if prw == nil {
+			return nil, fmt.Errorf("peer %s not found", peerId)
+		}
+		peers = append(peers, prw)
+	} else {
+		for _, prw := range rom.peers {
+			peers = append(peers, prw)
+		}
+		sort.Slice(peers, func(i, j int) bool { return peers[i].Id() < peers[j].Id() })
+	}
+
+	for _, prw := range peers {
+		peerProducers := make([]*Producer, 0, len(prw.producers))
+		for _, producer := range prw.producers {
+			peerProducers = append(peerProducers, producer)
+		}
+		sort.Slice(peerProducers, func(i, j int) bool { return peerProducers[i].id < peerProducers[j].id })
+		producers = append(producers, peerProducers...)
+	}
+
+	return producers, nil
+}
+
+// play adds a peer consuming producers in the receiving media sections of
+// offer, in order and by kind, and returns the answer. Sections left without
+// a producer are rejected. The peer leaves with ClosePeer.
+func (rom *Room) play(peerInfo PeerInfo, offer *sdp.Session, producers []*Producer) (*sdp.Session, error) {
+	answer := make([]*sdp.Media, 0, len(offer.Media))
+	consumes := make(map[int]*Producer)
+	used := make(map[*Producer]bool)
+	for i, media := range offer.Media {
+		answer = append(answer, answerMedia(media))
+
+		if media.Port == 0 || (media.Kind != "audio" && media.Kind != "video") ||
+			(media.Direction != "recvonly" && media.Direction != "sendrecv") {
+			continue
+		}
+
+		caps := offeredCapabilities(media)
+		for _, producer := range producers {
+			if !used[producer] && producer.data.kind == media.Kind && rom.router.CanConsume(producer.id, caps) {
+				consumes[i] = producer
+				used[producer] = true
+				break
+			}
+		}
+	}
+
+	if len(consumes) == 0 {
+		return nil, errors.New("nothing to play")
+	}
+
+	dtlsParameters, setup, err := remoteDtlsParameters(offer.Media[0])
+	if err != nil {
+		return nil, err
+	}
+
+	transport := rom.router.CreateWebRtcTransport(&common.WebRtcTransportOptions{
+		WebRtcTransportOptions: rom.cf.Mediasoup.WebRtcTransportOptions,
+		AppData: common.TransportAppData{
+			Consuming: true,
+		},
+		EnableUdp: true,
+		EnableTcp: true,
+		PreferUdp: true,
+	})
+	if transport == nil {
+		return nil, errors.New("cannot create transport")
+	}
+	transport.remoteIceUfrag = offer.Media[0].IceUfrag
+
+	prw := &PeerWrapper{
+		data: PeerData{PeerInfo: peerInfo},
+	}
+	prw.transports = map[string]interface{}{transport.Id(): transport}
+	prw.producers = make(map[string]*Producer)
+	prw.consumers = make(map[string]*Consumer)
+	prw.dataProducers = make(map[string]*DataProducer)
+	prw.dataConsumers = make(map[string]*DataConsumer)
+	rom.peers[prw.Id()] = prw
+
+	transport.connect(dtlsParameters)
+	rom.router.channel.AddTransport(transport.Id(), rom.router)
+
+	for i, media := range offer.Media {
+		producer, ok := consumes[i]
+		if !ok {
+			continue
+		}
+
+		consumer, err := transport.consume(prw, producer.id, offeredCapabilities(media), false, false, media.Mid)
+		if err != nil {
+			rom.removePeer(prw)
+			return nil, err
+		}
+		prw.consumers[consumer.internal.ConsumerId] = consumer
+
+		answerMedia := sdp.NewMedia(media.Kind, &consumer.data.rtpParameters)
+		if err := transport.acceptMedia(answerMedia, setup); err != nil {
+			rom.removePeer(prw)
+			return nil, err
+		}
+		answerMedia.Direction = "sendonly"
+		answerMedia.Attributes = append(answerMedia.Attributes,
+			fmt.Sprintf("msid:%s %s", producer.PeerInfo.Id(), consumer.internal.ConsumerId))
+		answer[i] = answerMedia
+	}
+
+	return answerSession(answer), nil
+}
+
+// playerTransport is the transport of a WHEP player.
+func (rom *Room) playerTransport(peerId string) *WebRtcTransport {
+	prw := rom.peers[peerId]
+	if prw == nil || prw.peer != nil {
+		return nil
+	}
+
+	for _, v := range prw.transports {
+		if transport, ok := v.(*WebRtcTransport); ok && transport.appData.Consuming {
+			return transport
+		}
+	}
+
+	return nil
+}
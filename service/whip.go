@@ -0,0 +1,264 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mediasoup-signal-controller/common"
+	"mediasoup-signal-controller/sdp"
+	"net/http"
+	"strings"
+
+	"github.com/cloudwebrtc/go-protoo/logger"
+	"github.com/go-basic/uuid"
+)
+
+// WhipServer lets WebRTC-HTTP ingestion (WHIP) clients, e.g. OBS or GStreamer,
+// publish into a room. The publisher joins the room as a peer without protoo.
+//
+//	POST /whip/{roomId}             SDP offer in, SDP answer out, the
+//	                                Location header is the session resource
+//	DELETE /whip/{roomId}/{peerId}  stop publishing
+//
+// The answer carries every candidate of the transport, trickle ICE is not
+// supported.
+type WhipServer struct {
+	server *Server
+	mux    *http.ServeMux
+}
+
+func CreateNewWhipServer(server *Server) *WhipServer {
+	whip := &WhipServer{
+		server: server,
+		mux:    http.NewServeMux(),
+	}
+
+	whip.mux.HandleFunc("/whip/", whip.handleWhip)
+
+	return whip
+}
+
+func (whip *WhipServer) Handler() http.Handler {
+	return whip.mux
+}
+
+func (whip *WhipServer) handleWhip(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/whip/"), "/")
+	if len(parts[0]) == 0 || len(parts) > 2 {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if len(parts) == 1 {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		whip.handlePublish(w, r, parts[0])
+		return
+	}
+
+	switch r.Method {
+	case http.MethodDelete:
+		rom := whip.server.GetRoom(parts[0])
+		if rom == nil || !rom.ClosePeer(parts[1]) {
+			http.Error(w, "not found", http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case http.MethodPatch:
+		http.Error(w, "trickle ICE is not supported", http.StatusMethodNotAllowed)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (whip *WhipServer) handlePublish(w http.ResponseWriter, r *http.Request, roomId string) {
+	if !strings.HasPrefix(r.Header.Get("Content-Type"), "application/sdp") {
+		http.Error(w, "expected application/sdp", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offer, err := sdp.Parse(string(body))
+	if err != nil {
+		http.Error(w, "invalid offer: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	displayName := r.URL.Query().Get("displayName")
+	if len(displayName) == 0 {
+		displayName = "WHIP publisher"
+	}
+
+	peerInfo := PeerInfo{
+		Id:          uuid.New(),
+		DisplayName: displayName,
+		Device: Device_t{
+			Flag: "whip",
+			Name: r.UserAgent(),
+		},
+	}
+
+	// The room may close with its last peer before the publisher is added,
+	// a new room is created then.
+	var answer *sdp.Session
+	for attempt := 0; attempt < JoinAttempts; attempt++ {
+		rom := whip.server.GetOrCreateRoom(roomId)
+		if rom == nil {
+			http.Error(w, "room not available", http.StatusServiceUnavailable)
+			return
+		}
+		if answer, err = rom.Publish(peerInfo, offer); err != errRoomClosed {
+			break
+		}
+	}
+	if err == errRoomClosed {
+		logger.Warnf("WHIP publish to room %s failed, closed on every attempt", roomId)
+		http.Error(w, "room not available", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		logger.Warnf("WHIP publish to room %s failed: %s", roomId, err.Error())
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/sdp")
+	w.Header().Set("Location", fmt.Sprintf("/whip/%s/%s", roomId, peerInfo.Id))
+	w.WriteHeader(http.StatusCreated)
+	_, _ = w.Write([]byte(answer.String()))
+}
+
+// Publish adds a peer producing the media sent in offer, and returns the
+// answer. The peer has no protoo peer, it leaves with ClosePeer.
+func (rom *Room) Publish(peerInfo PeerInfo, offer *sdp.Session) (*sdp.Session, error) {
+	rom.mutex.Lock()
+	defer rom.mutex.Unlock()
+
+	if rom.Closed() {
+		return nil, errRoomClosed
+	}
+
+	caps := &rom.router.rtpCapabilities
+
+	answer := make([]*sdp.Media, 0, len(offer.Media))
+	produces := make(map[*sdp.Media]*common.ClientProduceData)
+	for _, media := range offer.Media {
+		answerMedia := answerMedia(media)
+		answer = append(answer, answerMedia)
+
+		if media.Port == 0 || (media.Kind != "audio" && media.Kind != "video") ||
+			(media.Direction != "sendonly" && media.Direction != "sendrecv") {
+			continue
+		}
+
+		rtpParameters, err := producerRtpParameters(media, caps)
+		if err != nil {
+			logger.Warnf("rejecting %s section %s: %s", media.Kind, media.Mid, err.Error())
+			continue
+		}
+
+		produces[answerMedia] = &common.ClientProduceData{
+			Kind:          media.Kind,
+			RtpParameters: *rtpParameters,
+		}
+	}
+
+	if len(produces) == 0 {
+		rom.closeIfEmpty()
+		return nil, errors.New("nothing to publish")
+	}
+
+	dtlsParameters, setup, err := remoteDtlsParameters(offer.Media[0])
+	if err != nil {
+		rom.closeIfEmpty()
+		return nil, err
+	}
+
+	transport := rom.router.CreateWebRtcTransport(&common.WebRtcTransportOptions{
+		WebRtcTransportOptions: rom.cf.Mediasoup.WebRtcTransportOptions,
+		AppData: common.TransportAppData{
+			Producing: true,
+		},
+		EnableUdp: true,
+		EnableTcp: true,
+		PreferUdp: true,
+	})
+	if transport == nil {
+		rom.closeIfEmpty()
+		return nil, errors.New("cannot create transport")
+	}
+
+	prw := &PeerWrapper{
+		data: PeerData{PeerInfo: peerInfo},
+	}
+	prw.data.Joined = true
+	prw.transports = map[string]interface{}{transport.Id(): transport}
+	prw.producers = make(map[string]*Producer)
+	prw.consumers = make(map[string]*Consumer)
+	prw.dataProducers = make(map[string]*DataProducer)
+	prw.dataConsumers = make(map[string]*DataConsumer)
+	rom.peers[prw.Id()] = prw
+
+	transport.connect(dtlsParameters)
+	rom.router.channel.AddTransport(transport.Id(), rom.router)
+
+	for _, media := range answer {
+		pd, ok := produces[media]
+		if !ok {
+			continue
+		}
+
+		if err := transport.acceptMedia(media, setup); err != nil {
+			rom.removePeer(prw)
+			return nil, err
+		}
+		media.Direction = "recvonly"
+		media.Codecs = pd.RtpParameters.Codecs
+		media.HeaderExtensions = pd.RtpParameters.HeaderExtensions
+		for _, encoding := range pd.RtpParameters.Encodings {
+			if len(encoding.Rid) > 0 {
+				media.Rids = append(media.Rids, sdp.Rid{Id: encoding.Rid, Direction: "recv"})
+			}
+		}
+		if len(media.Rids) > 0 {
+			rids := make([]string, 0, len(media.Rids))
+			for _, rid := range media.Rids {
+				rids = append(rids, rid.Id)
+			}
+			media.Simulcast = "recv " + strings.Join(rids, ";")
+		}
+
+		producer, err := transport.produce(prw, pd, "", false, 5000)
+		if err != nil {
+			rom.removePeer(prw)
+			return nil, fmt.Errorf("cannot produce %s: %s", pd.Kind, err.Error())
+		}
+		rom.addProducer(prw, producer)
+	}
+
+	rom.notifyNewPeer(prw)
+
+	return answerSession(answer), nil
+}
+
+// ClosePeer removes a peer without protoo, a WHIP publisher or WHEP player.
+// False if there is no such peer.
+func (rom *Room) ClosePeer(peerId string) bool {
+	rom.mutex.Lock()
+	defer rom.mutex.Unlock()
+
+	prw := rom.peers[peerId]
+	if prw == nil || prw.peer != nil {
+		return false
+	}
+
+	rom.removePeer(prw)
+	return true
+}
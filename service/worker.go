@@ -1,12 +1,16 @@
 package service
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"mediasoup-signal-controller/common"
 	"mediasoup-signal-controller/conf"
 	"os"
 	"os/exec"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/cloudwebrtc/go-protoo/logger"
 	"github.com/go-basic/uuid"
@@ -15,12 +19,22 @@ import (
 type Worker struct {
 	Waiting_Response
 	Pid            int
+	Version        WorkerVersion
 	seq            int
 	cf             *conf.Config
 	channel        *Channel
 	payloadChannel *PayloadChannel
 	closed         bool
+	healthy        bool
+	draining       bool
+	startedAt      time.Time
+	running        chan struct{}
+	runningOnce    sync.Once
+	exited         chan struct{}
+	exitReason     string
 	routers        []*Router
+	mutex          sync.Mutex
+	log            *WorkerLog
 
 	cmd    *exec.Cmd
 	server *Server
@@ -29,7 +43,11 @@ type Worker struct {
 func CreateNewWorker(server *Server, workerBin string, logLevel string, rtcMinPort int, rtcMaxPort int, cert string, key string, seq int) *Worker {
 	worker := &Worker{
 		seq:            seq,
+		Version:        server.workerVersion,
 		server:         server,
+		healthy:        true,
+		running:        make(chan struct{}),
+		exited:         make(chan struct{}),
 		cmd:            nil,
 		channel:        nil,
 		payloadChannel: nil,
@@ -39,15 +57,26 @@ func CreateNewWorker(server *Server, workerBin string, logLevel string, rtcMinPo
 	}
 
 	worker.cf = server.Conf
+	worker.log = CreateNewWorkerLog(worker.cf.Mediasoup.WorkerSettings.LogTail)
 	channelP := fmt.Sprintf("%s/channelProducer_%d", worker.cf.Mediasoup.UnixPath, seq)
 	channelC := fmt.Sprintf("%s/channelConsumer_%d", worker.cf.Mediasoup.UnixPath, seq)
 	channelPP := fmt.Sprintf("%s/channelPayloadProducer_%d", worker.cf.Mediasoup.UnixPath, seq)
 	channelPC := fmt.Sprintf("%s/channelPayloadConsumer_%d", worker.cf.Mediasoup.UnixPath, seq)
 	worker.channel = CreateNewChannel(channelP, channelC)
 	worker.channel.SetListener(worker)
+	worker.channel.SetLengthPrefixed(worker.Version.Supports(FeatureLengthPrefixedChannel))
 	worker.payloadChannel = CreateNewPayloadChannel(channelPP, channelPC)
 	worker.payloadChannel.SetListener(worker)
 
+	if len(worker.cf.Mediasoup.CaptureDir) > 0 {
+		recorder, err := CreateNewChannelRecorder(worker.cf.Mediasoup.CaptureDir, seq)
+		if err != nil {
+			logger.Errorf("Channel capture disabled:%s", err.Error())
+		} else {
+			worker.channel.SetRecorder(recorder)
+		}
+	}
+
 	worker.channel.Start()
 	worker.payloadChannel.Start()
 
@@ -66,20 +95,30 @@ func CreateNewWorker(server *Server, workerBin string, logLevel string, rtcMinPo
 	logger.Infof("start worker %s", workerBin)
 
 	worker.cmd = exec.Command(workerBin, parameters...)
+	worker.cmd.Env = append(os.Environ(), fmt.Sprintf("MEDIASOUP_VERSION=%s", worker.Version))
+	worker.cmd.Stdout = worker.log.Writer("stdout", "debug")
+	worker.cmd.Stderr = worker.log.Writer("stderr", "error")
 	logger.Infof("exec args: %v", worker.cmd.Args)
-	//pp, err := worker._cmd.CombinedOutput()
 
-	logger.Infof("MEDIASOUP_VERSION:%s", os.Getenv("MEDIASOUP_VERSION"))
+	logger.Infof("MEDIASOUP_VERSION:%s", worker.Version)
 
 	err := worker.cmd.Start()
 
 	if err != nil {
 		logger.Errorf("Mediasoup worker start failed:%s", err.Error())
+		if worker.channel.recorder != nil {
+			worker.channel.recorder.Close()
+		}
 		return nil
 	}
 	worker.Pid = worker.cmd.Process.Pid
+	worker.startedAt = time.Now()
+	worker.log.SetProcess(worker.Pid, seq)
 	logger.Debugf("process id:%d", worker.Pid)
-	go worker.ExitMonitor()
+
+	if worker.channel.recorder != nil {
+		worker.channel.recorder.SetPid(worker.Pid)
+	}
 	return worker
 }
 
@@ -87,40 +126,347 @@ func (worker *Worker) SetListener(server *Server) {
 	worker.server = server
 }
 
-func (worker *Worker) CreateRouter(rom *Room) *Router {
+// Supports reports whether this worker implements the given feature, logging
+// an error when it does not so callers can simply skip the request.
+func (worker *Worker) Supports(feature WorkerFeature) bool {
+	if worker.Version.Supports(feature) {
+		return true
+	}
+
+	logger.Errorf("worker %d (mediasoup %s) does not support %s, requires >= %s",
+		worker.Pid, worker.Version, feature, workerFeatureVersions[feature])
+	return false
+}
+
+// Available reports whether new rooms may be placed on this worker.
+func (worker *Worker) Available() bool {
+	worker.mutex.Lock()
+	available := !worker.closed && worker.healthy && !worker.draining
+	worker.mutex.Unlock()
+
+	return available && worker.Running()
+}
+
+// Closed reports whether the worker is closing or has exited.
+func (worker *Worker) Closed() bool {
+	worker.mutex.Lock()
+	defer worker.mutex.Unlock()
+
+	return worker.closed
+}
+
+func (worker *Worker) setHealthy(healthy bool) {
+	worker.mutex.Lock()
+	defer worker.mutex.Unlock()
+
+	worker.healthy = healthy
+}
+
+// ExitReason is empty while the worker is running and not being closed.
+func (worker *Worker) ExitReason() string {
+	worker.mutex.Lock()
+	defer worker.mutex.Unlock()
+
+	return worker.exitReason
+}
+
+// Running reports whether the worker has sent "running".
+func (worker *Worker) Running() bool {
+	select {
+	case <-worker.running:
+		return true
+	default:
+		return false
+	}
+}
+
+// Kill kills the worker process right away, reason is reported as its exit
+// reason.
+func (worker *Worker) Kill(reason string) {
+	worker.mutex.Lock()
+	worker.exitReason = reason
+	worker.mutex.Unlock()
+
+	worker.cmd.Process.Kill()
+}
+
+func (worker *Worker) Draining() bool {
+	worker.mutex.Lock()
+	defer worker.mutex.Unlock()
+
+	return worker.draining
+}
+
+func (worker *Worker) RouterCount() int {
+	worker.mutex.Lock()
+	defer worker.mutex.Unlock()
+
+	return len(worker.routers)
+}
+
+func (worker *Worker) ConsumerCount() int {
+	worker.mutex.Lock()
+	routers := append([]*Router(nil), worker.routers...)
+	worker.mutex.Unlock()
+
+	count := 0
+	for _, router := range routers {
+		router.lock()
+		for _, transport := range router.transports {
+			switch t := transport.(type) {
+			case *WebRtcTransport:
+				count += len(t.consumers)
+			case *PlainTransport:
+				count += len(t.consumers)
+			}
+		}
+		router.unlock()
+	}
+	return count
+}
+
+// CreateRouter creates a router for rom on the worker. Nothing is registered
+// when the worker does not create it.
+func (worker *Worker) CreateRouter(rom *Room) (*Router, error) {
 
 	internal := &common.Internal_t{
 		RouterId: uuid.New(),
 	}
+	var rerr error
 	var wg sync.WaitGroup
 	wg.Add(1)
 	go func() {
-		worker.channel.Request("worker.createRouter", internal, nil, nil, nil, nil)
-		wg.Done()
+		_, err := worker.channel.Request("worker.createRouter", internal, nil, nil,
+			func(result common.ChannelMessage) {
+				wg.Done()
+			},
+			func(code int, err string) {
+				logger.Errorf("worker.createRouter reject: %d => %s", code, err)
+				rerr = errors.New(err)
+
+				wg.Done()
+			})
+		if err != nil {
+			logger.Errorf("worker.createRouter send failed:%s", err.Error())
+			rerr = err
+			wg.Done()
+		}
 	}()
 
-	router := CreateNewRouter(rom, worker.cf.Mediasoup.RouterOptions, internal, nil, worker.channel, worker.payloadChannel, nil)
+	// Requests on the router must not overtake its creation.
+	wg.Wait()
+	if rerr != nil {
+		return nil, rerr
+	}
+
+	router := CreateNewRouter(rom, worker, worker.cf.Mediasoup.RouterOptions, internal, nil, worker.channel, worker.payloadChannel, nil)
+	worker.mutex.Lock()
 	worker.routers = append(worker.routers, router)
+	worker.mutex.Unlock()
 
 	router.channel.AddListener(router.internal.RouterId, router)
-	return router
+	return router, nil
+}
+
+func (worker *Worker) GetResourceUsage() (*common.WorkerResourceUsage, error) {
+	return worker.getResourceUsage(WorkerRequestTimeout)
+}
+
+func (worker *Worker) getResourceUsage(timeout time.Duration) (*common.WorkerResourceUsage, error) {
+
+	var usage *common.WorkerResourceUsage
+	var rerr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+
+		_, err := worker.channel.RequestWithTimeout("worker.getResourceUsage", nil, nil, nil, timeout,
+
+			func(result common.ChannelMessage) {
+				usage = &common.WorkerResourceUsage{}
+				rerr = json.Unmarshal(result.Data, usage)
+
+				wg.Done()
+			},
+			func(code int, err string) {
+				logger.Infof("worker.getResourceUsage reject: %d => %s", code, err)
+				rerr = errors.New(err)
+
+				wg.Done()
+			})
+		if err != nil {
+			logger.Errorf("worker.getResourceUsage send failed:%s", err.Error())
+			rerr = err
+			wg.Done()
+		}
+	}()
+
+	wg.Wait()
+	return usage, rerr
+}
+
+func (worker *Worker) Dump() (*common.WorkerDump, error) {
+	return worker.dump(WorkerRequestTimeout)
+}
+
+func (worker *Worker) dump(timeout time.Duration) (*common.WorkerDump, error) {
+
+	var dump *common.WorkerDump
+	var rerr error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+
+		_, err := worker.channel.RequestWithTimeout("worker.dump", nil, nil, nil, timeout,
+
+			func(result common.ChannelMessage) {
+				dump = &common.WorkerDump{}
+				rerr = json.Unmarshal(result.Data, dump)
+
+				wg.Done()
+			},
+			func(code int, err string) {
+				logger.Infof("worker.dump reject: %d => %s", code, err)
+				rerr = errors.New(err)
+
+				wg.Done()
+			})
+		if err != nil {
+			logger.Errorf("worker.dump send failed:%s", err.Error())
+			rerr = err
+			wg.Done()
+		}
+	}()
+
+	wg.Wait()
+	return dump, rerr
 }
 
 func (worker *Worker) OnRouterClose(router *Router) {
-	// todo
+	worker.mutex.Lock()
+	defer worker.mutex.Unlock()
+
+	for i, r := range worker.routers {
+		if r == router {
+			worker.routers = append(worker.routers[:i], worker.routers[i+1:]...)
+			break
+		}
+	}
+}
+
+// closeRouters closes the routers of a worker which is gone.
+func (worker *Worker) closeRouters() {
+	worker.mutex.Lock()
+	routers := worker.routers
+	worker.routers = make([]*Router, 0)
+	worker.mutex.Unlock()
+
+	for _, router := range routers {
+		router.lock()
+		router.workerClosed()
+		router.unlock()
+	}
 }
 
 func (worker *Worker) HandleMessage(msg common.ChannelMessage, channelType string) {
 
 	if len(msg.Event) > 0 && msg.Event == "running" {
-		logger.Debugf("worker process running [pid:%s], %s, %p", msg.TargetId, channelType, worker)
+		logger.Infof("worker process running [pid:%s seq:%d], %s", msg.TargetId, worker.seq, channelType)
+		worker.runningOnce.Do(func() { close(worker.running) })
+	}
+}
+
+// Close asks the worker process to exit with SIGTERM and kills it when it is
+// still there after timeout.
+func (worker *Worker) Close(timeout time.Duration) {
+	worker.mutex.Lock()
+	worker.closed = true
+	worker.exitReason = WorkerExitClosed
+	worker.mutex.Unlock()
+
+	logger.Infof("closing worker %d", worker.Pid)
+	worker.cmd.Process.Signal(syscall.SIGTERM)
+
+	select {
+	case <-worker.exited:
+	case <-time.After(timeout):
+		logger.Warnf("worker %d still running after %s, killing it", worker.Pid, timeout)
+		worker.cmd.Process.Kill()
+		<-worker.exited
 	}
 }
 
+// Drain stops placing new rooms on the worker. Once its last router is closed,
+// or deadline has passed, the worker is closed and the server replaces it,
+// moving any room still on it to another worker.
+func (worker *Worker) Drain(deadline time.Duration) {
+	worker.mutex.Lock()
+	if worker.draining || worker.closed {
+		worker.mutex.Unlock()
+		return
+	}
+	worker.draining = true
+	worker.mutex.Unlock()
+
+	logger.Infof("draining worker %d, %d routers, deadline %s", worker.Pid, worker.RouterCount(), deadline)
+
+	go func() {
+		expire := time.After(deadline)
+		ticker := time.NewTicker(time.Second)
+		defer ticker.Stop()
+
+		for worker.RouterCount() > 0 {
+			select {
+			case <-worker.exited:
+				return
+			case <-expire:
+				logger.Warnf("worker %d drain deadline passed with %d routers", worker.Pid, worker.RouterCount())
+				worker.Close(WorkerCloseTimeout)
+				return
+			case <-ticker.C:
+			}
+		}
+
+		logger.Infof("worker %d drained", worker.Pid)
+		worker.Close(WorkerCloseTimeout)
+	}()
+}
+
+// ExitMonitor waits for the worker process and reports its exit to the server.
+// The supervisor runs it once the pid is registered, so that an exit right
+// after start is not taken for one of a replaced worker.
 func (worker *Worker) ExitMonitor() {
 
-	worker.cmd.Wait()
-	logger.Errorf("worker %d exited", worker.Pid)
+	err := worker.cmd.Wait()
+	worker.log.Flush()
+	worker.mutex.Lock()
+	worker.closed = true
+	if len(worker.exitReason) == 0 && err != nil {
+		worker.exitReason = err.Error()
+	} else if len(worker.exitReason) == 0 {
+		worker.exitReason = "exited"
+	}
+	worker.mutex.Unlock()
+	if err != nil {
+		logger.Errorf("worker %d exited abnormally: %s, last output:", worker.Pid, err.Error())
+		for _, line := range worker.log.Tail() {
+			logger.Errorf("worker[pid:%d seq:%d] %s", worker.Pid, worker.seq, line)
+		}
+	} else {
+		logger.Errorf("worker %d exited", worker.Pid)
+	}
+
+	// Requests still waiting are rejected, which frees rooms locked on them.
+	// The replacement worker reuses the socket paths, stop listening first.
+	worker.channel.Close()
+	worker.payloadChannel.Close()
+
+	worker.closeRouters()
+	if worker.channel.recorder != nil {
+		worker.channel.recorder.Close()
+	}
+	close(worker.exited)
+
 	worker.server.OnWorkerExit(worker.Pid, worker.seq)
 }
 
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/cloudwebrtc/go-protoo/logger"
+)
+
+// Number of worker log lines kept for crash reports by default.
+const DefaultWorkerLogTail = 100
+
+/*
+mediasoup-worker log lines look like
+
+	D(ice) RTC::WebRtcTransport::OnIceServerSelectedTuple() | ICE selected tuple
+	RTC::Router::HandleRequest() | request failed
+	(ABORT) RTC::Producer::Producer() | failed assertion `...': ...
+
+The level letter and tag are only present for lines sent through the channel
+(or with MS_*_TAG_STD), the rest carry the class name instead.
+*/
+var workerLogRegexp = regexp.MustCompile(`^(\(ABORT\) )?(?:([DWEX])(?:\(([^)]*)\))? )?((?:((?:\w+::)*\w+)::\w+\(\) \| )?.*)$`)
+
+type WorkerLogLine struct {
+	Level string
+	Tag   string
+	Text  string
+}
+
+func ParseWorkerLogLine(line string, defaultLevel string) WorkerLogLine {
+	parsed := WorkerLogLine{
+		Level: defaultLevel,
+		Text:  line,
+	}
+
+	match := workerLogRegexp.FindStringSubmatch(line)
+	if match == nil {
+		return parsed
+	}
+
+	switch match[2] {
+	case "D", "X":
+		parsed.Level = "debug"
+	case "W":
+		parsed.Level = "warn"
+	case "E":
+		parsed.Level = "error"
+	}
+	if len(match[1]) > 0 {
+		parsed.Level = "error"
+	}
+
+	parsed.Tag = match[3]
+	if len(parsed.Tag) == 0 {
+		parsed.Tag = match[5]
+	}
+
+	// Keep the Class::method() part, it is what people grep for.
+	parsed.Text = match[1] + match[4]
+
+	return parsed
+}
+
+// WorkerLog re-emits the output of a worker process through the controller
+// logger and keeps its last lines around for when the worker dies.
+type WorkerLog struct {
+	mutex   sync.Mutex
+	pid     int
+	seq     int
+	lines   []string
+	next    int
+	full    bool
+	writers []*WorkerLogWriter
+}
+
+func CreateNewWorkerLog(size int) *WorkerLog {
+	if size <= 0 {
+		size = DefaultWorkerLogTail
+	}
+
+	return &WorkerLog{
+		lines: make([]string, size),
+	}
+}
+
+func (wl *WorkerLog) SetProcess(pid int, seq int) {
+	wl.mutex.Lock()
+	defer wl.mutex.Unlock()
+
+	wl.pid = pid
+	wl.seq = seq
+}
+
+func (wl *WorkerLog) Log(stream string, line string, defaultLevel string) {
+	parsed := ParseWorkerLogLine(line, defaultLevel)
+
+	wl.mutex.Lock()
+	pid, seq := wl.pid, wl.seq
+	wl.lines[wl.next] = fmt.Sprintf("(%s) %s", stream, line)
+	wl.next = (wl.next + 1) % len(wl.lines)
+	if wl.next == 0 {
+		wl.full = true
+	}
+	wl.mutex.Unlock()
+
+	format := "worker[pid:%d seq:%d] (%s) [%s] %s"
+	switch parsed.Level {
+	case "error":
+		logger.Errorf(format, pid, seq, stream, parsed.Tag, parsed.Text)
+	case "warn":
+		logger.Warnf(format, pid, seq, stream, parsed.Tag, parsed.Text)
+	case "info":
+		logger.Infof(format, pid, seq, stream, parsed.Tag, parsed.Text)
+	default:
+		logger.Debugf(format, pid, seq, stream, parsed.Tag, parsed.Text)
+	}
+}
+
+// Tail returns the kept lines, oldest first.
+func (wl *WorkerLog) Tail() []string {
+	wl.mutex.Lock()
+	defer wl.mutex.Unlock()
+
+	tail := make([]string, 0, len(wl.lines))
+	if wl.full {
+		tail = append(tail, wl.lines[wl.next:]...)
+	}
+	return append(tail, wl.lines[:wl.next]...)
+}
+
+// Writer returns an io.Writer splitting a worker output stream into lines.
+func (wl *WorkerLog) Writer(stream string, defaultLevel string) *WorkerLogWriter {
+	writer := &WorkerLogWriter{
+		log:          wl,
+		stream:       stream,
+		defaultLevel: defaultLevel,
+	}
+
+	wl.mutex.Lock()
+	wl.writers = append(wl.writers, writer)
+	wl.mutex.Unlock()
+
+	return writer
+}
+
+// Flush logs what the streams wrote after their last newline, to be called
+// once the process has exited and its output has been copied.
+func (wl *WorkerLog) Flush() {
+	wl.mutex.Lock()
+	writers := wl.writers
+	wl.mutex.Unlock()
+
+	for _, writer := range writers {
+		writer.Flush()
+	}
+}
+
+type WorkerLogWriter struct {
+	log          *WorkerLog
+	stream       string
+	defaultLevel string
+	buffer       []byte
+}
+
+func (wlw *WorkerLogWriter) Write(data []byte) (int, error) {
+	wlw.buffer = append(wlw.buffer, data...)
+
+	for {
+		i := bytes.IndexByte(wlw.buffer, '\n')
+		if i < 0 {
+			break
+		}
+
+		line := wlw.buffer[:i]
+		wlw.buffer = wlw.buffer[i+1:]
+		wlw.logLine(line)
+	}
+
+	return len(data), nil
+}
+
+// Flush logs a trailing line without newline, e.g. an abort message.
+func (wlw *WorkerLogWriter) Flush() {
+	line := wlw.buffer
+	wlw.buffer = nil
+	wlw.logLine(line)
+}
+
+func (wlw *WorkerLogWriter) logLine(data []byte) {
+	line := strings.TrimRight(string(data), "\r")
+	if len(line) > 0 {
+		wlw.log.Log(wlw.stream, line, wlw.defaultLevel)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWorkerLogLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want WorkerLogLine
+	}{
+		{
+			line: "D(ice) RTC::WebRtcTransport::OnIceServerSelectedTuple() | ICE selected tuple",
+			want: WorkerLogLine{Level: "debug", Tag: "ice", Text: "RTC::WebRtcTransport::OnIceServerSelectedTuple() | ICE selected tuple"},
+		},
+		{
+			line: "W(rtp) RTC::Producer::ReceiveRtpPacket() | no stream found",
+			want: WorkerLogLine{Level: "warn", Tag: "rtp", Text: "RTC::Producer::ReceiveRtpPacket() | no stream found"},
+		},
+		{
+			line: "E RTC::Router::HandleRequest() | request failed",
+			want: WorkerLogLine{Level: "error", Tag: "RTC::Router", Text: "RTC::Router::HandleRequest() | request failed"},
+		},
+		{
+			line: "X(dtls) RTC::DtlsTransport::Run() | running",
+			want: WorkerLogLine{Level: "debug", Tag: "dtls", Text: "RTC::DtlsTransport::Run() | running"},
+		},
+		{
+			line: "RTC::Router::HandleRequest() | request failed",
+			want: WorkerLogLine{Level: "info", Tag: "RTC::Router", Text: "RTC::Router::HandleRequest() | request failed"},
+		},
+		{
+			line: "(ABORT) RTC::Producer::Producer() | failed assertion `ssrc != 0': no ssrc",
+			want: WorkerLogLine{Level: "error", Tag: "RTC::Producer", Text: "(ABORT) RTC::Producer::Producer() | failed assertion `ssrc != 0': no ssrc"},
+		},
+		{
+			line: "Worker::Worker() | starting mediasoup-worker process",
+			want: WorkerLogLine{Level: "info", Tag: "Worker", Text: "Worker::Worker() | starting mediasoup-worker process"},
+		},
+		{
+			line: "segmentation fault",
+			want: WorkerLogLine{Level: "info", Text: "segmentation fault"},
+		},
+		{
+			line: "Error: not a level letter",
+			want: WorkerLogLine{Level: "info", Text: "Error: not a level letter"},
+		},
+	}
+
+	for _, tt := range tests {
+		if got := ParseWorkerLogLine(tt.line, "info"); got != tt.want {
+			t.Errorf("ParseWorkerLogLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+		}
+	}
+}
+
+// Output is split into lines and a last line without newline is kept until
+// the process exits.
+func TestWorkerLogWriter(t *testing.T) {
+	wl := CreateNewWorkerLog(3)
+	stdout := wl.Writer("stdout", "debug")
+	stderr := wl.Writer("stderr", "error")
+
+	stdout.Write([]byte("first\r\nsec"))
+	stdout.Write([]byte("ond\n\nthird"))
+	stderr.Write([]byte("(ABORT) RTC::Worker::Worker() | failed"))
+
+	want := []string{"(stdout) first", "(stdout) second"}
+	if got := wl.Tail(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tail() = %q, want %q", got, want)
+	}
+
+	wl.Flush()
+	want = []string{"(stdout) second", "(stdout) third", "(stderr) (ABORT) RTC::Worker::Worker() | failed"}
+	if got := wl.Tail(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tail() after Flush() = %q, want %q", got, want)
+	}
+
+	wl.Flush()
+	if got := wl.Tail(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Tail() after second Flush() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,168 @@
+package service
+
+import (
+	"mediasoup-signal-controller/common"
+	"sync"
+	"time"
+
+	"github.com/cloudwebrtc/go-protoo/logger"
+)
+
+const (
+	WorkerSelectionRoundRobin     = "roundRobin"
+	WorkerSelectionLeastRouters   = "leastRouters"
+	WorkerSelectionLeastConsumers = "leastConsumers"
+	WorkerSelectionLowestCpu      = "lowestCpu"
+)
+
+// How long lowestCpu waits for the resource usage of the workers.
+const CpuUsageTimeout = 500 * time.Millisecond
+
+// WorkerSelector picks the worker a new room is created on. It is given the
+// available workers ordered by seq and never an empty slice.
+type WorkerSelector interface {
+	Select(workers []*Worker) *Worker
+}
+
+func CreateNewWorkerSelector(strategy string) WorkerSelector {
+	switch strategy {
+	case WorkerSelectionLeastRouters:
+		return &leastLoadSelector{load: func(worker *Worker) float64 { return float64(worker.RouterCount()) }}
+	case WorkerSelectionLeastConsumers:
+		return &leastLoadSelector{load: func(worker *Worker) float64 { return float64(worker.ConsumerCount()) }}
+	case WorkerSelectionLowestCpu:
+		return createCpuSelector()
+	case WorkerSelectionRoundRobin, "":
+		return &roundRobinSelector{lastSeq: -1}
+	}
+
+	logger.Warnf("unknown workerSelection %s, using %s", strategy, WorkerSelectionRoundRobin)
+	return &roundRobinSelector{lastSeq: -1}
+}
+
+// Round robin by seq, so it keeps its order across worker restarts.
+type roundRobinSelector struct {
+	mutex   sync.Mutex
+	lastSeq int
+}
+
+func (rrs *roundRobinSelector) Select(workers []*Worker) *Worker {
+	rrs.mutex.Lock()
+	defer rrs.mutex.Unlock()
+
+	selected := workers[0]
+	for _, worker := range workers {
+		if worker.seq > rrs.lastSeq {
+			selected = worker
+			break
+		}
+	}
+
+	rrs.lastSeq = selected.seq
+	return selected
+}
+
+// Lowest load wins, ties go to the lowest seq.
+type leastLoadSelector struct {
+	load func(worker *Worker) float64
+}
+
+func (lls *leastLoadSelector) Select(workers []*Worker) *Worker {
+	selected := workers[0]
+	selectedLoad := lls.load(selected)
+
+	for _, worker := range workers[1:] {
+		if load := lls.load(worker); load < selectedLoad {
+			selected = worker
+			selectedLoad = load
+		}
+	}
+
+	return selected
+}
+
+type cpuSample struct {
+	at      time.Time
+	cpuTime float64
+}
+
+// Compares the CPU time each worker used since the previous selection,
+// workers seen for the first time are compared on their whole lifetime.
+// Workers are asked for their usage all at once, rooms are placed round robin
+// when one of them does not answer within CpuUsageTimeout.
+type cpuSelector struct {
+	fallback roundRobinSelector
+
+	mutex   sync.Mutex
+	samples map[int]cpuSample
+}
+
+func createCpuSelector() *cpuSelector {
+	return &cpuSelector{
+		fallback: roundRobinSelector{lastSeq: -1},
+		samples:  make(map[int]cpuSample),
+	}
+}
+
+func (cs *cpuSelector) cpuLoad(worker *Worker, usage *common.WorkerResourceUsage, at time.Time) float64 {
+	now := cpuSample{
+		at:      at,
+		cpuTime: usage.Utime + usage.Stime,
+	}
+
+	last, ok := cs.samples[worker.Pid]
+	cs.samples[worker.Pid] = now
+
+	if !ok {
+		return now.cpuTime / float64(now.at.Sub(worker.startedAt).Milliseconds()+1)
+	}
+	return (now.cpuTime - last.cpuTime) / float64(now.at.Sub(last.at).Milliseconds()+1)
+}
+
+func (cs *cpuSelector) Select(workers []*Worker) *Worker {
+	usages := make([]*common.WorkerResourceUsage, len(workers))
+	errs := make([]error, len(workers))
+
+	var wg sync.WaitGroup
+	for i, worker := range workers {
+		wg.Add(1)
+		go func(i int, worker *Worker) {
+			defer wg.Done()
+			usages[i], errs[i] = worker.getResourceUsage(CpuUsageTimeout)
+		}(i, worker)
+	}
+	wg.Wait()
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	// Forget workers which have gone away.
+	for pid := range cs.samples {
+		found := false
+		for _, worker := range workers {
+			found = found || worker.Pid == pid
+		}
+		if !found {
+			delete(cs.samples, pid)
+		}
+	}
+
+	for i, worker := range workers {
+		if errs[i] != nil {
+			logger.Warnf("worker %d resource usage unavailable: %s, selecting round robin", worker.Pid, errs[i].Error())
+			return cs.fallback.Select(workers)
+		}
+	}
+
+	at := time.Now()
+	selected := workers[0]
+	selectedLoad := cs.cpuLoad(selected, usages[0], at)
+	for i, worker := range workers[1:] {
+		if load := cs.cpuLoad(worker, usages[i+1], at); load < selectedLoad {
+			selected = worker
+			selectedLoad = load
+		}
+	}
+
+	return selected
+}
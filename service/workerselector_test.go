@@ -0,0 +1,38 @@
+package service
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestCpuSelector(t *testing.T) {
+	svr := startTestServer(t, 2)
+	workers := svr.Workers()
+	selector := createCpuSelector()
+
+	if selected := selector.Select(workers); selected != workers[0] && selected != workers[1] {
+		t.Errorf("Select() = %v", selected)
+	}
+}
+
+// Room creation does not wait for workers which do not tell their usage.
+func TestCpuSelectorFallback(t *testing.T) {
+	os.Setenv("FAKEWORKER_STALL", "worker.getResourceUsage")
+	defer os.Unsetenv("FAKEWORKER_STALL")
+
+	svr := startTestServer(t, 2)
+	workers := svr.Workers()
+	selector := createCpuSelector()
+
+	for i := 0; i < 3; i++ {
+		started := time.Now()
+		selected := selector.Select(workers)
+		if elapsed := time.Since(started); elapsed > 2*CpuUsageTimeout {
+			t.Errorf("Select() took %s", elapsed)
+		}
+		if want := workers[i%2]; selected != want {
+			t.Errorf("Select() #%d = worker seq:%d, want seq:%d", i, selected.seq, want.seq)
+		}
+	}
+}